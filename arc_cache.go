@@ -0,0 +1,188 @@
+package lru
+
+import "container/list"
+
+// arcList identifies which of the four ARC lists holds an entry
+type arcList int
+
+const (
+	arcT1 arcList = iota // Recently used once
+	arcT2                // Frequently used (at least twice)
+	arcB1                // Ghosts of entries evicted from T1
+	arcB2                // Ghosts of entries evicted from T2
+)
+
+type arcEntry struct {
+	key   Key
+	value interface{}
+	list  arcList
+}
+
+// arc is an Adaptive Replacement Cache, see https://en.wikipedia.org/wiki/Adaptive_replacement_cache.
+// T1 and T2 hold cached entries, whilst B1 and B2 hold only the keys of entries recently
+// evicted from T1 and T2 respectively.  Hits on these ghost entries adjust the target size p
+// of T1, so that the cache adapts between favouring recency and frequency.
+// It is not safe for concurrent access.
+type arc struct {
+	// capacity is the maximum number of cached entries; must be positive.
+	capacity int
+	// p is the target size of T1
+	p int
+
+	lists map[arcList]*list.List
+	cache map[interface{}]*list.Element
+}
+
+func newARC(maxEntries int) *arc {
+	return &arc{
+		capacity: maxEntries,
+		lists: map[arcList]*list.List{
+			arcT1: list.New(),
+			arcT2: list.New(),
+			arcB1: list.New(),
+			arcB2: list.New(),
+		},
+		cache: make(map[interface{}]*list.Element),
+	}
+}
+
+func (a *arc) size(l arcList) int {
+	return a.lists[l].Len()
+}
+
+// moveToFront relocates the element to the front of the specified list
+func (a *arc) moveToFront(e *list.Element, to arcList) {
+	ae := e.Value.(*arcEntry)
+	a.lists[ae.list].Remove(e)
+	ae.list = to
+	if to == arcB1 || to == arcB2 {
+		ae.value = nil // Ghosts retain only the key
+	}
+	a.cache[ae.key] = a.lists[to].PushFront(ae)
+}
+
+// removeLRU discards the least recently used element of the specified list
+func (a *arc) removeLRU(l arcList) {
+	if e := a.lists[l].Back(); e != nil {
+		a.removeElement(e)
+	}
+}
+
+func (a *arc) removeElement(e *list.Element) {
+	ae := e.Value.(*arcEntry)
+	a.lists[ae.list].Remove(e)
+	delete(a.cache, ae.key)
+}
+
+// replace evicts an entry from T1 or T2 into its ghost list, based on the target size p
+func (a *arc) replace(hitInB2 bool) {
+	t1 := a.size(arcT1)
+	if t1 > 0 && (t1 > a.p || (hitInB2 && t1 == a.p) || a.size(arcT2) == 0) {
+		a.moveToFront(a.lists[arcT1].Back(), arcB1)
+	} else if a.size(arcT2) > 0 {
+		a.moveToFront(a.lists[arcT2].Back(), arcB2)
+	}
+}
+
+// put adds a value to the cache.
+func (a *arc) put(key Key, value interface{}) {
+	if e, ok := a.cache[key]; ok {
+		ae := e.Value.(*arcEntry)
+		switch ae.list {
+		case arcT1, arcT2:
+			ae.value = value
+			a.moveToFront(e, arcT2)
+		case arcB1:
+			// Recency would have helped, so increase the target size of T1
+			delta := 1
+			if b1, b2 := a.size(arcB1), a.size(arcB2); b2 > b1 {
+				delta = b2 / b1
+			}
+			a.p = min(a.capacity, a.p+delta)
+			if a.len() >= a.capacity {
+				a.replace(false)
+			}
+			a.moveToFront(e, arcT2)
+			ae.value = value
+		case arcB2:
+			// Frequency would have helped, so decrease the target size of T1
+			delta := 1
+			if b1, b2 := a.size(arcB1), a.size(arcB2); b1 > b2 {
+				delta = b1 / b2
+			}
+			a.p = max(0, a.p-delta)
+			if a.len() >= a.capacity {
+				a.replace(true)
+			}
+			a.moveToFront(e, arcT2)
+			ae.value = value
+		}
+		return
+	}
+
+	l1 := a.size(arcT1) + a.size(arcB1)
+	total := l1 + a.size(arcT2) + a.size(arcB2)
+	// Ghost entries are trimmed only when their lists overflow, and live entries are
+	// only moved to the ghost lists when there is no room for the new entry, which
+	// may not be the case after a remove, even though the lists are full
+	if l1 >= a.capacity {
+		if a.size(arcT1) < a.capacity {
+			a.removeLRU(arcB1)
+			if a.len() >= a.capacity {
+				a.replace(false)
+			}
+		} else {
+			a.removeLRU(arcT1)
+		}
+	} else if total >= a.capacity {
+		if total >= 2*a.capacity {
+			a.removeLRU(arcB2)
+		}
+		if a.len() >= a.capacity {
+			a.replace(false)
+		}
+	}
+
+	ae := &arcEntry{key: key, value: value, list: arcT1}
+	a.cache[key] = a.lists[arcT1].PushFront(ae)
+}
+
+// get looks up a key's value from the cache.
+func (a *arc) get(key Key) (value interface{}, ok bool) {
+	e, hit := a.cache[key]
+	if !hit {
+		return
+	}
+	ae := e.Value.(*arcEntry)
+	if ae.list == arcB1 || ae.list == arcB2 {
+		return
+	}
+	a.moveToFront(e, arcT2)
+	return ae.value, true
+}
+
+// remove removes the provided key from the cache, including any ghost entry,
+// returning true if the key was cached (rather than only a ghost).
+func (a *arc) remove(key Key) bool {
+	e, hit := a.cache[key]
+	if !hit {
+		return false
+	}
+	l := e.Value.(*arcEntry).list
+	a.removeElement(e)
+	return l == arcT1 || l == arcT2
+}
+
+// len returns the number of items in the cache.
+func (a *arc) len() int {
+	return a.size(arcT1) + a.size(arcT2)
+}
+
+// clear purges all stored items from the cache.
+func (a *arc) clear() {
+	for _, l := range a.lists {
+		l.Init()
+	}
+	a.cache = make(map[interface{}]*list.Element)
+	a.p = 0
+}
@@ -0,0 +1,84 @@
+package lru
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// EstimateSize returns a best-effort estimate of the number of bytes used by v.
+// The estimate includes the contents of strings, slices, arrays and structs,
+// but not the values referenced by pointers, nor the contents of maps, channels
+// or nested interfaces, so is an under-estimate for values that use these.
+// Shared data (for example, two slices of the same array) is counted each time.
+func EstimateSize(v any) int64 {
+	if v == nil {
+		return 0
+	}
+	rv := reflect.ValueOf(v)
+	return int64(rv.Type().Size()) + indirectSize(rv)
+}
+
+// indirectSize returns the size of the data referenced by v, that is not held inline
+func indirectSize(v reflect.Value) int64 {
+	switch v.Kind() {
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Slice:
+		n := int64(v.Len()) * int64(v.Type().Elem().Size())
+		if hasIndirect(v.Type().Elem()) {
+			for i := 0; i < v.Len(); i++ {
+				n += indirectSize(v.Index(i))
+			}
+		}
+		return n
+	case reflect.Array:
+		var n int64
+		if hasIndirect(v.Type().Elem()) {
+			for i := 0; i < v.Len(); i++ {
+				n += indirectSize(v.Index(i))
+			}
+		}
+		return n
+	case reflect.Struct:
+		var n int64
+		for i := 0; i < v.NumField(); i++ {
+			n += indirectSize(v.Field(i))
+		}
+		return n
+	}
+	return 0
+}
+
+// hasIndirect returns true if values of type t may reference data counted by indirectSize
+func hasIndirect(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Slice:
+		return true
+	case reflect.Array:
+		return hasIndirect(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if hasIndirect(t.Field(i).Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NewAutoSizedCache creates a new LRU cache whose capacity is the maximum total size,
+// in bytes, of its keys and values, as estimated by EstimateSize.  The least recently
+// used items are evicted to keep the estimated total within maxBytes.
+// As the estimate does not include all memory used by the cache (nor, for some types,
+// by the values themselves; see EstimateSize), maxBytes is a guide rather than a
+// guarantee.  Where the size of values can be calculated precisely, use NewBasicCache
+// with WithWeigher instead.
+// Additional behaviour can be configured using opts, although any Weigher is replaced.
+// Close() should be called when the cache is no longer needed, to release resources.
+func NewAutoSizedCache(ctx context.Context, maxBytes int, timeout time.Duration, opts ...Option) (*BasicCache, error) {
+	weigher := func(key Key, value any) int {
+		return int(EstimateSize(key) + EstimateSize(value))
+	}
+	return NewBasicCache(ctx, maxBytes, timeout, append(opts[:len(opts):len(opts)], WithWeigher(weigher))...)
+}
@@ -0,0 +1,54 @@
+package lru
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEstimateSize(t *testing.T) {
+	type record struct {
+		ID   int64
+		Name string
+		Tags []string
+	}
+
+	tests := []struct {
+		v        any
+		expected int64
+	}{
+		{nil, 0},
+		{int64(1), 8},
+		{"hello", 16 + 5},
+		{[]byte("hello"), 24 + 5},
+		{[]string{"a", "bc"}, 24 + 2*16 + 3},
+		{record{ID: 1, Name: "abc", Tags: []string{"x"}}, 8 + 16 + 24 + 3 + 16 + 1},
+	}
+
+	for _, test := range tests {
+		if n := EstimateSize(test.v); n != test.expected {
+			t.Fatalf("TestEstimateSize failed.  Expected %v for %v, got %v", test.expected, test.v, n)
+		}
+	}
+}
+
+func TestNewAutoSizedCache(t *testing.T) {
+	ctx := context.Background()
+
+	// Each entry is estimated at 16 + 1 bytes for the key, and 24 + 100 for the value
+	lru, err := NewAutoSizedCache(ctx, 500, 0)
+	if err != nil {
+		t.Fatalf("TestNewAutoSizedCache failed.  Expected success, but got error %v", err)
+	}
+	defer lru.Close()
+
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		lru.Put(ctx, k, make([]byte, 100))
+	}
+
+	if l, _ := lru.Len(); l != 3 {
+		t.Fatalf("TestNewAutoSizedCache failed.  Expected Len = 3, got %v", l)
+	}
+	if w, _ := lru.Weight(); w > 500 {
+		t.Fatalf("TestNewAutoSizedCache failed.  Expected Weight <= 500, got %v", w)
+	}
+}
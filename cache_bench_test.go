@@ -0,0 +1,199 @@
+package lru
+
+import (
+	"context"
+	"encoding/binary"
+	"sync/atomic"
+	"testing"
+)
+
+// benchmarkable is the set of operations that are benchmarked.  Any cache
+// implementation can be benchmarked by the same workloads by providing an
+// adapter to it, and adding a constructor to benchmarkCaches.
+type benchmarkable interface {
+	Get(ctx context.Context, key Key) (bool, error)
+	Put(ctx context.Context, key Key, n int64) error
+	GetBatch(ctx context.Context, keys []Key) error
+	Close()
+}
+
+// benchmarkableCache adapts any implementation of Cache
+type benchmarkableCache struct {
+	c Cache
+}
+
+func (b benchmarkableCache) Get(ctx context.Context, key Key) (bool, error) {
+	_, ok, err := b.c.Get(ctx, key)
+	return ok, err
+}
+
+func (b benchmarkableCache) Put(ctx context.Context, key Key, n int64) error {
+	return b.c.Put(ctx, key, n)
+}
+
+func (b benchmarkableCache) GetBatch(ctx context.Context, keys []Key) error {
+	_, err := b.c.GetBatch(ctx, keys)
+	return err
+}
+
+func (b benchmarkableCache) Close() {
+	b.c.Close()
+}
+
+// benchmarkableSlabbedCache adapts a SlabbedCache, holding n in each buffer
+type benchmarkableSlabbedCache struct {
+	s *SlabbedCache
+}
+
+func (b benchmarkableSlabbedCache) Get(ctx context.Context, key Key) (bool, error) {
+	_, ok, err := b.s.Get(ctx, key)
+	return ok, err
+}
+
+func (b benchmarkableSlabbedCache) Put(ctx context.Context, key Key, n int64) error {
+	buf := b.s.Buffer()
+	binary.LittleEndian.PutUint64(buf, uint64(n))
+	return b.s.Put(ctx, key, buf)
+}
+
+func (b benchmarkableSlabbedCache) GetBatch(ctx context.Context, keys []Key) error {
+	for _, key := range keys {
+		if _, _, err := b.s.Get(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b benchmarkableSlabbedCache) Close() {
+	b.s.Close()
+}
+
+// benchmarkCache constructs a cache of the specified capacity, so that each
+// implementation is benchmarked by the same workloads
+type benchmarkCache struct {
+	name string
+	new  func(ctx context.Context, maxEntries int) (benchmarkable, error)
+}
+
+// adapt returns a constructor of a benchmarkable for a constructor of a Cache
+func adapt[C Cache](fn func(ctx context.Context, maxEntries int) (C, error)) func(ctx context.Context, maxEntries int) (benchmarkable, error) {
+	return func(ctx context.Context, maxEntries int) (benchmarkable, error) {
+		c, err := fn(ctx, maxEntries)
+		if err != nil {
+			return nil, err
+		}
+		return benchmarkableCache{c: c}, nil
+	}
+}
+
+var benchmarkCaches = []benchmarkCache{
+	{"Basic", adapt(func(ctx context.Context, maxEntries int) (*BasicCache, error) {
+		return NewBasicCache(ctx, maxEntries, 0, WithTracingDisabled())
+	})},
+	{"ARC", adapt(func(ctx context.Context, maxEntries int) (*ARCCache, error) {
+		return NewARCCache(ctx, maxEntries, 0)
+	})},
+	{"Loading", adapt(func(ctx context.Context, maxEntries int) (*LoadingCache, error) {
+		return NewLoadingCache(ctx, NewMapLoader(map[Key]any{}), maxEntries, 0, WithTracingDisabled())
+	})},
+	{"Partitioned", adapt(func(ctx context.Context, maxEntries int) (*PartitionedCache, error) {
+		partitioner := func(key Key) (Partition, error) {
+			if key.(int)%2 == 0 {
+				return "A", nil
+			}
+			return "B", nil
+		}
+		a, _ := NewBasicCache(ctx, maxEntries/2, 0, WithTracingDisabled())
+		b, _ := NewBasicCache(ctx, maxEntries/2, 0, WithTracingDisabled())
+		return NewPartitionedCache(ctx, partitioner, []PartitionInfo{{Name: "A", Cache: a}, {Name: "B", Cache: b}}, WithTracingDisabled())
+	})},
+	{"Tiered", adapt(func(ctx context.Context, maxEntries int) (*TieredCache, error) {
+		l1, _ := NewBasicCache(ctx, maxEntries/10, 0, WithTracingDisabled())
+		l2, _ := NewBasicCache(ctx, maxEntries, 0, WithTracingDisabled())
+		return NewTieredCache(ctx, l1, l2)
+	})},
+	{"Slabbed", func(ctx context.Context, maxEntries int) (benchmarkable, error) {
+		s, err := NewSlabbedCache(ctx, maxEntries, 0, 8, nil, WithTracingDisabled())
+		if err != nil {
+			return nil, err
+		}
+		return benchmarkableSlabbedCache{s: s}, nil
+	}},
+}
+
+const benchmarkEntries = 10000
+
+// runCacheBenchmark runs fn in parallel against each implementation of Cache,
+// after filling the cache with keys 0 to benchmarkEntries-1.  fn is passed a
+// sequence number that is unique across the goroutines.
+func runCacheBenchmark(b *testing.B, maxEntries int, fn func(ctx context.Context, c benchmarkable, n int64)) {
+	ctx := context.Background()
+
+	for _, bc := range benchmarkCaches {
+		b.Run(bc.name, func(b *testing.B) {
+			c, err := bc.new(ctx, maxEntries)
+			if err != nil {
+				b.Fatalf("%s failed.  Unexpected error: %v", b.Name(), err)
+			}
+			defer c.Close()
+
+			for i := 0; i < benchmarkEntries; i++ {
+				c.Put(ctx, i, int64(i))
+			}
+
+			// Ensure several goroutines contend for the cache, even with few CPUs
+			b.SetParallelism(8)
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			var seq atomic.Int64
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					fn(ctx, c, seq.Add(1))
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkCache_Get(b *testing.B) {
+	runCacheBenchmark(b, benchmarkEntries, func(ctx context.Context, c benchmarkable, n int64) {
+		c.Get(ctx, int(n%benchmarkEntries))
+	})
+}
+
+func BenchmarkCache_Put(b *testing.B) {
+	runCacheBenchmark(b, benchmarkEntries, func(ctx context.Context, c benchmarkable, n int64) {
+		c.Put(ctx, int(n%benchmarkEntries), n)
+	})
+}
+
+func BenchmarkCache_GetBatch(b *testing.B) {
+	const batchSize = 16
+
+	runCacheBenchmark(b, benchmarkEntries, func(ctx context.Context, c benchmarkable, n int64) {
+		keys := make([]Key, batchSize)
+		for i := range keys {
+			keys[i] = int((n*batchSize + int64(i)) % benchmarkEntries)
+		}
+		c.GetBatch(ctx, keys)
+	})
+}
+
+// BenchmarkCache_Evict adds keys that are not held to a full cache, so that each Put evicts
+func BenchmarkCache_Evict(b *testing.B) {
+	runCacheBenchmark(b, benchmarkEntries, func(ctx context.Context, c benchmarkable, n int64) {
+		c.Put(ctx, benchmarkEntries+int(n), n)
+	})
+}
+
+// BenchmarkCache_Mixed Gets keys from a range twice the capacity of the cache, adding
+// those that are missing, so that misses evict keys that will later be requested
+func BenchmarkCache_Mixed(b *testing.B) {
+	runCacheBenchmark(b, benchmarkEntries/2, func(ctx context.Context, c benchmarkable, n int64) {
+		if ok, _ := c.Get(ctx, int(n%benchmarkEntries)); !ok {
+			c.Put(ctx, int(n%benchmarkEntries), n)
+		}
+	})
+}
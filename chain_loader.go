@@ -0,0 +1,83 @@
+package lru
+
+import (
+	"context"
+	"fmt"
+)
+
+// ChainLoaders returns a Loader that tries each of the loaders in turn, for example
+// to fall back from a fast backend to a slower authoritative one.  Each key is first
+// requested of the first loader, and is requested of the next loader only if it fails,
+// either because an error is returned for the key, or because the call fails entirely
+// (including by a panic), in which case every key of the call has failed.  Keys that a
+// loader does not find are not passed on.  The result of each key is therefore that of
+// the last loader to which it was requested, with the failure of a whole call reported
+// against each of its keys, so the returned Loader does not itself fail.
+// Keys that have not succeeded when ctx completes keep their most recent result.
+// nil loaders are skipped; if there are no other loaders, the Loader returns ErrInvalidLoader.
+func ChainLoaders(loaders ...Loader) Loader {
+	chain := make([]Loader, 0, len(loaders))
+	for _, l := range loaders {
+		if l != nil {
+			chain = append(chain, l)
+		}
+	}
+
+	return func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		if len(chain) == 0 {
+			return nil, ErrInvalidLoader
+		}
+
+		results := map[Key]LoaderResult{}
+		pending := keys
+		for _, loader := range chain {
+			if len(pending) == 0 || ctx.Err() != nil {
+				break
+			}
+
+			res, err := callLoader(ctx, loader, pending)
+			if err != nil {
+				for _, key := range pending {
+					results[key] = LoaderResult{Key: key, Err: err}
+				}
+				continue
+			}
+
+			requested := map[Key]bool{}
+			for _, key := range pending {
+				requested[key] = true
+				delete(results, key)
+			}
+			failed := []Key{}
+			for _, r := range res {
+				if _, ok := results[r.Key]; ok || !requested[r.Key] {
+					continue
+				}
+				results[r.Key] = r
+				if r.Err != nil {
+					failed = append(failed, r.Key)
+				}
+			}
+			pending = failed
+		}
+
+		out := make([]LoaderResult, 0, len(keys))
+		for _, key := range keys {
+			if r, ok := results[key]; ok {
+				out = append(out, r)
+				delete(results, key)
+			}
+		}
+		return out, nil
+	}
+}
+
+// callLoader calls the loader, reporting a panic as an error
+func callLoader(ctx context.Context, loader Loader, keys []Key) (res []LoaderResult, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			res, err = nil, fmt.Errorf("unexpected error: %v", p)
+		}
+	}()
+	return loader(ctx, keys)
+}
@@ -0,0 +1,79 @@
+package lru
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestChainLoaders(t *testing.T) {
+	errPrimary := errors.New("primary failed")
+	errSecondary := errors.New("secondary failed")
+
+	primary := func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		res := []LoaderResult{}
+		for _, k := range keys {
+			switch k {
+			case "fast":
+				res = append(res, LoaderResult{Key: k, Value: "primary"})
+			case "missing":
+				res = append(res, LoaderResult{Key: k})
+			default:
+				res = append(res, LoaderResult{Key: k, Err: errPrimary})
+			}
+		}
+		return res, nil
+	}
+
+	requested := []Key{}
+	secondary := func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		requested = append(requested, keys...)
+		res := []LoaderResult{}
+		for _, k := range keys {
+			if k == "bad" {
+				res = append(res, LoaderResult{Key: k, Err: errSecondary})
+				continue
+			}
+			res = append(res, LoaderResult{Key: k, Value: "secondary"})
+		}
+		return res, nil
+	}
+
+	ctx := context.Background()
+
+	lru, _ := NewLoadingCache(ctx, ChainLoaders(primary, nil, secondary), 0, 0)
+	defer lru.Close()
+
+	res, err := lru.GetBatch(ctx, []Key{"fast", "slow", "missing", "bad"})
+	if err != nil {
+		t.Fatalf("TestChainLoaders failed.  Unexpected error: %v", err)
+	}
+	if res[0].Value != "primary" || res[1].Value != "secondary" {
+		t.Fatalf("TestChainLoaders failed.  Expected values from each loader, got %v, %v", res[0].Value, res[1].Value)
+	}
+	if !errors.Is(res[2].Err, ErrLoaderReturnedNil) {
+		t.Fatalf("TestChainLoaders failed.  Expected missing not to be found, got %v", res[2])
+	}
+	// The error of the last loader is reported
+	if !errors.Is(res[3].Err, errSecondary) {
+		t.Fatalf("TestChainLoaders failed.  Expected error: %v, got error: %v", errSecondary, res[3].Err)
+	}
+	if len(requested) != 2 {
+		t.Fatalf("TestChainLoaders failed.  Expected only the failed keys to be requested of the secondary, got %v", requested)
+	}
+
+	// A primary that fails entirely, or panics, falls back for every key
+	for _, failing := range []Loader{
+		func(ctx context.Context, keys []Key) ([]LoaderResult, error) { return nil, errPrimary },
+		func(ctx context.Context, keys []Key) ([]LoaderResult, error) { panic("primary panicked") },
+	} {
+		res, err := ChainLoaders(failing, secondary)(ctx, []Key{"a", "b"})
+		if err != nil || len(res) != 2 || res[0].Value != "secondary" || res[1].Value != "secondary" {
+			t.Fatalf("TestChainLoaders failed.  Expected values from the secondary, got %v, %v", res, err)
+		}
+	}
+
+	if _, err := ChainLoaders()(ctx, []Key{"a"}); err != ErrInvalidLoader {
+		t.Fatalf("TestChainLoaders failed.  Expected error: %v, got error: %v", ErrInvalidLoader, err)
+	}
+}
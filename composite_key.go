@@ -0,0 +1,49 @@
+package lru
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// compositeKey is the Key returned by CompositeKey, which is distinct from
+// any string key, even one holding the same encoding
+type compositeKey struct {
+	encoded string
+}
+
+// String returns the encoding of the parts of the key
+func (k compositeKey) String() string {
+	return k.encoded
+}
+
+// CompositeKey returns a Key built from the parts, which is equal to another
+// CompositeKey only if it has the same number of parts, and each part has the
+// same type and value as its counterpart.  Unlike keys built by concatenating
+// strings, parts cannot run into each other, so ("ab", "c") and ("a", "bc") differ.
+// Each part is encoded using its type, qualified by its package path so that types
+// of the same name from different packages differ, and its Go-syntax representation
+// (the %#v verb), so parts should be comparable values, such as strings, numbers, booleans and
+// structs or arrays of these, whose representation identifies their value.
+// Pointers are encoded by address rather than by the value they reference,
+// and parts such as slices and maps are encoded by their contents at the time
+// of the call, which will not match a later key if the contents are changed.
+func CompositeKey(parts ...any) Key {
+	var b strings.Builder
+	for _, part := range parts {
+		s := fmt.Sprintf("%s:%#v", partType(part), part)
+		b.WriteString(strconv.Itoa(len(s)))
+		b.WriteByte('|')
+		b.WriteString(s)
+	}
+	return compositeKey{encoded: b.String()}
+}
+
+// partType returns the name of the type of the part, as used by typeName
+func partType(part any) string {
+	if part == nil {
+		return "<nil>"
+	}
+	return typeName(reflect.TypeOf(part))
+}
@@ -0,0 +1,58 @@
+package lru
+
+import (
+	"context"
+	"math/rand"
+	randv2 "math/rand/v2"
+	"testing"
+)
+
+func TestCompositeKey(t *testing.T) {
+	if CompositeKey("user", 42) != CompositeKey("user", 42) {
+		t.Fatal("TestCompositeKey failed.  Expected keys with equal parts to be equal")
+	}
+
+	distinct := []Key{
+		CompositeKey("ab", "c"),
+		CompositeKey("a", "bc"),
+		CompositeKey("a|b"),
+		CompositeKey("a", "b"),
+		CompositeKey(1, 2),
+		CompositeKey(int64(1), 2),
+		CompositeKey("1", "2"),
+		CompositeKey(1, 2, nil),
+		CompositeKey((*rand.Zipf)(nil)),
+		CompositeKey((*randv2.Zipf)(nil)),
+		CompositeKey(),
+		"ab",
+	}
+	for i := range distinct {
+		for j := range distinct {
+			if i != j && distinct[i] == distinct[j] {
+				t.Fatalf("TestCompositeKey failed.  Expected %v and %v to differ", distinct[i], distinct[j])
+			}
+		}
+	}
+}
+
+func TestCompositeKey_Cache(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+	defer lru.Close()
+
+	type region struct {
+		Country string
+		Zone    int
+	}
+
+	lru.Put(ctx, CompositeKey("tenant", region{"GB", 1}), 1)
+	lru.Put(ctx, CompositeKey("tenant", region{"GB", 2}), 2)
+
+	if v, ok, _ := lru.Get(ctx, CompositeKey("tenant", region{"GB", 1})); !ok || v != 1 {
+		t.Fatalf("TestCompositeKey_Cache failed.  Expected 1, got %v, %v", v, ok)
+	}
+	if l, _ := lru.Len(); l != 2 {
+		t.Fatalf("TestCompositeKey_Cache failed.  Expected Len = 2, got %v", l)
+	}
+}
@@ -1,6 +1,9 @@
 package lru
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // KeyVal associates a Key to a Value
 type KeyVal struct {
@@ -19,6 +22,53 @@ type CacheResult struct {
 	Err error
 }
 
+// Names of the policies reported by CacheConfig
+const (
+	PolicyLRU         = "LRU"
+	PolicyARC         = "ARC"
+	PolicyLoadingLRU  = "LoadingLRU"
+	PolicyPartitioned = "Partitioned"
+)
+
+// CacheConfig describes the configuration of a cache, for diagnostic purposes
+type CacheConfig struct {
+	// Capacity is the maximum number of entries (or their total weight, if a Weigher
+	// is specified) held by the cache.  Zero means no limit.
+	Capacity int
+	// Timeout is the time allowed for each operation on the cache
+	Timeout time.Duration
+	// TTL is the default time-to-live of entries.  Zero means entries do not expire.
+	TTL time.Duration
+	// Policy names the approach of the cache to managing its entries
+	Policy string
+	// ChannelBufferSize is the number of requests of each type that may be queued
+	ChannelBufferSize int
+	// Partitions holds the configuration of each partition of a PartitionedCache
+	Partitions map[Partition]CacheConfig
+}
+
+// ResultsToMap returns the values of the results that were successfully retrieved, by their keys
+func ResultsToMap(res []*CacheResult) map[Key]any {
+	m := map[Key]any{}
+	for _, r := range res {
+		if r != nil && r.OK {
+			m[r.Key] = r.Value
+		}
+	}
+	return m
+}
+
+// ResultsErrors returns the errors of the results that failed, by their keys
+func ResultsErrors(res []*CacheResult) map[Key]error {
+	m := map[Key]error{}
+	for _, r := range res {
+		if r != nil && r.Err != nil {
+			m[r.Key] = r.Err
+		}
+	}
+	return m
+}
+
 // Cache defines the features of a cache
 type Cache interface {
 	// Close empties the cache, releases all resources
@@ -35,6 +85,8 @@ type Cache interface {
 	PutBatch(ctx context.Context, vals []KeyVal) (err error)
 	// Remove evicts the key and its associated value
 	Remove(key Key) (err error)
+	// RemoveContext evicts the key and its associated value, unless the context completes first
+	RemoveContext(ctx context.Context, key Key) (err error)
 
 	// Added to prevent implementations outside this package, minimising impact of change
 	private()
@@ -4,6 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.opentelemetry.io/otel/attribute"
@@ -13,22 +17,155 @@ import (
 
 type removeRequest struct {
 	k Key
+	c chan bool
+}
+
+type removeBatchRequest struct {
+	keys []Key
+	c    chan []bool
+}
+
+type removeWhereResponse struct {
+	n   int
+	err error
+}
+
+type removeWhereRequest struct {
+	pred func(key Key, value any) bool
+	c    chan *removeWhereResponse
+}
+
+type resizeResponse struct {
+	evicted []KeyVal
+	err     error
+}
+
+type resizeRequest struct {
+	n int
+	c chan *resizeResponse
+}
+
+type pinRequest struct {
+	k   Key
+	pin bool
+	c   chan bool
+}
+
+type evictRequest struct {
+	n int
+	c chan int
+}
+
+type clearRequest struct {
+	drain bool
+	c     chan []KeyVal
+}
+
+type forEachRequest struct {
+	fn func(key Key, value any) bool
+	c  chan error
+}
+
+type pingRequest struct {
 	c chan struct{}
 }
 
 type putRequest struct {
-	k Key
-	v any
-	c chan struct{}
+	kvs []KeyVal
+	ttl time.Duration
+	c   chan struct{}
 }
 
 type getRequest struct {
 	keys []Key
-	c    chan []*CacheResult
+	c    chan *[]getOneResponse
+}
+
+type getEntryResponse struct {
+	v        any
+	expires  time.Time
+	version  uint64
+	inserted time.Time
+	accessed time.Time
+	hits     uint64
+	expired  bool
+	ok       bool
+}
+
+// lookupMode determines how getEntry finds an item
+type lookupMode int
+
+const (
+	// lookupGet updates the lru status of the item, removing it if expired
+	lookupGet lookupMode = iota
+	// lookupPeek leaves the lru status of the item unchanged
+	lookupPeek
+	// lookupRaw leaves the lru status unchanged, and also finds an expired item
+	lookupRaw
+)
+
+// getOneRequest is the lookup of a single key by Get, which is sent by value,
+// as is its response, to avoid their allocation
+type getOneRequest struct {
+	k Key
+	c chan getOneResponse
+}
+
+type getOneResponse struct {
+	v  any
+	ok bool
+}
+
+type getEntryRequest struct {
+	k    Key
+	mode lookupMode
+	c    chan *getEntryResponse
+}
+
+type putIfVersionRequest struct {
+	k        Key
+	v        any
+	expected uint64
+	c        chan bool
+}
+
+type updateResponse struct {
+	v   any
+	err error
+}
+
+type updateRequest struct {
+	k  Key
+	fn func(value any, ok bool) (any, error)
+	c  chan *updateResponse
+}
+
+type containsRequest struct {
+	keys []Key
+	c    chan []bool
+}
+
+type getOrDefaultRequest struct {
+	k   Key
+	def any
+	c   chan any
+}
+
+type incrementResponse struct {
+	n   int64
+	err error
+}
+
+type incrementRequest struct {
+	k     Key
+	delta int64
+	c     chan *incrementResponse
 }
 
 type getLenResponse struct {
-	len int
+	len      int
+	weight   int
+	capacity int
 }
 
 type getLenRequest struct {
@@ -39,22 +176,55 @@ type getLenRequest struct {
 // of a bounded least-recently-used cache
 type BasicCache struct {
 	privateImp
-	d   time.Duration
+	o Options
+	// d is the timeout for each operation, as last set by SetTimeout
+	d   atomic.Int64
 	put chan *putRequest
 	get chan *getRequest
+	one chan getOneRequest
+	gex chan *getEntryRequest
+	cas chan *putIfVersionRequest
+	god chan *getOrDefaultRequest
+	inc chan *incrementRequest
+	upd chan *updateRequest
+	has chan *containsRequest
 	rm  chan *removeRequest
+	rmb chan *removeBatchRequest
+	rmw chan *removeWhereRequest
+	rsz chan *resizeRequest
+	clr chan *clearRequest
+	evc chan *evictRequest
+	pin chan *pinRequest
 	len chan *getLenRequest
+	png chan *pingRequest
+	itr chan *forEachRequest
+	// done is closed, and closed is set, once Close has been called.  The request
+	// channels are not closed, so that a request cannot be sent on a closed channel.
+	done      chan struct{}
+	closed    atomic.Bool
+	closeOnce sync.Once
+	// capacity is the current capacity of the cache, as last set by Resize
+	capacity atomic.Int64
+	// keyLocksMu guards keyLocks, which serialise concurrent Updates of each key
+	keyLocksMu sync.Mutex
+	keyLocks   map[Key]*keyLock
 }
 
-// Close releases all resources associated with the cache
+// requestChannelSize is the number of requests of each type that may be queued for a cache.
+// Should a queue be full, the time waiting to send a request counts towards the timeout
+// of the operation, as does the time then waiting for the response.  Responses are sent
+// on channels buffered to hold one response, which are not closed, so that the cache is
+// never blocked by, or fails to respond to, a caller that has stopped waiting.
+// Both waits end with ErrAttemptToUseInvalidCache if the cache is closed.
+const requestChannelSize = 100
+
+// Close releases all resources associated with the cache.
+// Calling Close more than once is harmless.
 func (c *BasicCache) Close() {
-	defer func() {
-		recover()
-	}()
-	close(c.put)
-	close(c.get)
-	close(c.rm)
-	close(c.len)
+	c.closeOnce.Do(func() {
+		c.closed.Store(true)
+		close(c.done)
+	})
 }
 
 var ErrTimeout = errors.New("timeout exceeded")
@@ -66,75 +236,1932 @@ var sendToClosedChanPanicMsg = "send on closed channel"
 // into the cache, updating its lru status.
 // An error is raised if the Close() has been called, or
 // the timeoout for the operation is exceeded.
+// It behaves as GetBatch of the single key, including its tracing, but avoids
+// the allocation of the slices of keys and results.
 func (c *BasicCache) Get(ctx context.Context, key Key) (v any, ok bool, err error) {
-	res, err := c.GetBatch(ctx, []Key{key})
-	if err != nil {
+
+	select {
+	case <-ctx.Done():
+		return nil, false, ErrInvalidContext
+	default:
+	}
+
+	retrieved := 0
+	ctx, curSpan, endSpan := startSpan(ctx, c.o, oTELBasicCacheGetBatchSpan)
+	defer endSpan()
+	defer func() {
+		if r := recover(); r != nil {
+			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
+				err = ErrAttemptToUseInvalidCache
+			} else {
+				err = fmt.Errorf("unexpected error: %v", r)
+				c.o.panicked(r)
+			}
+			if curSpan != nil {
+				curSpan.AddEvent(oTELBasicCacheGetBatchError, trace.WithTimestamp(time.Now().UTC()))
+				curSpan.SetStatus(codes.Error, err.Error())
+			}
+		} else if curSpan != nil {
+			curSpan.AddEvent(oTELBasicCacheGetBatchEnded, trace.WithAttributes(attribute.Int("Retrieved", retrieved)), trace.WithTimestamp(time.Now().UTC()))
+		}
+	}()
+
+	if curSpan != nil {
+		curSpan.AddEvent(oTELBasicCacheGetBatchStarted, trace.WithAttributes(attribute.Int("Requested", 1), attribute.String("Key", c.o.keyString(key))), trace.WithTimestamp(time.Now().UTC()))
+	}
+
+	nkey := c.normalize(key)
+	if err := checkKeys(nkey); err != nil {
 		return nil, false, err
 	}
-	if len(res) == 0 {
-		return nil, false, ErrUnknown
+
+	ch := getOneChans.Get().(chan getOneResponse)
+	received := false
+	defer func() {
+		if received {
+			getOneChans.Put(ch)
+		}
+	}()
+
+	timeout := time.After(c.timeout())
+
+	select {
+	case <-ctx.Done():
+		return nil, false, ErrInvalidContext
+	case <-c.done:
+		return nil, false, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return nil, false, ErrTimeout
+	case c.one <- getOneRequest{k: nkey, c: ch}:
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, false, ErrInvalidContext
+	case <-c.done:
+		return nil, false, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return nil, false, ErrTimeout
+	case r := <-ch:
+		received = true
+		retrieved = 1
+		if r.ok {
+			r.v = c.copyOnGet(r.v)
+		}
+		c.accessed(AccessGet, nkey, r.ok)
+		return r.v, r.ok, nil
 	}
-	return res[0].Value, res[0].OK, res[0].Err
+}
+
+// getOneChans pools the channels on which Get receives its result, which
+// are only returned to the pool once the result has been received
+var getOneChans = sync.Pool{
+	New: func() any { return make(chan getOneResponse, 1) },
 }
 
 const (
 	oTELBasicCacheGetBatchStarted = "BasicCache.GetBatch started"
 	oTELBasicCacheGetBatchEnded   = "BasicCache.GetBatch ended"
 	oTELBasicCacheGetBatchError   = "BasicCache.GetBatch Retrieval Error"
+	oTELBasicCacheGetBatchSpan    = "BasicCache.GetBatch"
 )
 
 // GetBatch retrieves all the provided keys, returning a CacheResult for each
 // one, which provides the details of the retrieval of the key
-func (c *BasicCache) GetBatch(ctx context.Context, keys []Key) (cr []*CacheResult, err error) {
+func (c *BasicCache) GetBatch(ctx context.Context, keys []Key) ([]*CacheResult, error) {
+	return c.GetBatchInto(ctx, keys, nil)
+}
+
+// resultChans pools the channels on which GetBatchInto receives results.
+// A channel is only returned to the pool once its results have been received,
+// so that a late response to an abandoned request cannot be received by another.
+var resultChans = sync.Pool{
+	New: func() any { return make(chan *[]getOneResponse, 1) },
+}
+
+// getResults pools the slices in which the cache goroutine returns the results
+// of GetBatchInto, which are copied into the caller's CacheResults once received,
+// so that the goroutine never writes to memory the caller may already be reusing
+// after abandoning the request.
+var getResults = sync.Pool{
+	New: func() any { return new([]getOneResponse) },
+}
+
+// GetBatchInto is GetBatch, but appends the CacheResults to dst, returning the
+// extended slice, so that callers retrieving batches in a loop can reuse the slice
+// to reduce allocations; for example, by passing res[:0] from the previous call.
+// The CacheResults within the capacity of dst are also reused, so must not be
+// retained by the caller once dst is passed to GetBatchInto.
+func (c *BasicCache) GetBatchInto(ctx context.Context, keys []Key, dst []*CacheResult) (cr []*CacheResult, err error) {
+
+	select {
+	case <-ctx.Done():
+		return nil, ErrInvalidContext
+	default:
+	}
+
+	if len(keys) == 0 {
+		if dst == nil {
+			return []*CacheResult{}, nil
+		}
+		return dst, nil
+	}
+
+	ctx, curSpan, endSpan := startSpan(ctx, c.o, oTELBasicCacheGetBatchSpan)
+	defer endSpan()
+	defer func() {
+		if r := recover(); r != nil {
+			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
+				err = ErrAttemptToUseInvalidCache
+			} else {
+				err = fmt.Errorf("unexpected error: %v", r)
+				c.o.panicked(r)
+			}
+			if curSpan != nil {
+				curSpan.AddEvent(oTELBasicCacheGetBatchError, trace.WithTimestamp(time.Now().UTC()))
+				curSpan.SetStatus(codes.Error, err.Error())
+			}
+		} else if curSpan != nil {
+			curSpan.AddEvent(oTELBasicCacheGetBatchEnded, trace.WithAttributes(attribute.Int("Retrieved", len(cr))), trace.WithTimestamp(time.Now().UTC()))
+		}
+	}()
+
+	if curSpan != nil {
+		curSpan.AddEvent(oTELBasicCacheGetBatchStarted, trace.WithAttributes(attribute.Int("Requested", len(keys))), trace.WithTimestamp(time.Now().UTC()))
+	}
+
+	nkeys := c.normalizeKeys(keys)
+	if err := checkKeys(nkeys...); err != nil {
+		return nil, err
+	}
+
+	ch := resultChans.Get().(chan *[]getOneResponse)
+	received := false
+	defer func() {
+		if received {
+			resultChans.Put(ch)
+		}
+	}()
+
+	req := &getRequest{
+		keys: nkeys,
+		c:    ch,
+	}
+
+	timeout := time.After(c.timeout())
+
+	select {
+	case <-ctx.Done():
+		return nil, ErrInvalidContext
+	case <-c.done:
+		return nil, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return nil, ErrTimeout
+	case c.get <- req:
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ErrInvalidContext
+	case <-c.done:
+		return nil, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return nil, ErrTimeout
+	case buf, ok := <-ch:
+		if !ok {
+			return nil, ErrUnknown
+		}
+		received = true
+		if dst == nil {
+			dst = make([]*CacheResult, 0, len(keys))
+		}
+		// Results are reported against the keys as requested
+		cr = dst
+		for i, r := range *buf {
+			cr = appendResult(cr, keys[i], r.v, r.ok)
+		}
+		clear(*buf)
+		getResults.Put(buf)
+		res := cr[len(dst):]
+		if c.o.CopyOnGet != nil {
+			for _, r := range res {
+				if r.OK {
+					r.Value = c.copyOnGet(r.Value)
+				}
+			}
+		}
+		if c.o.OnAccess != nil {
+			for i, r := range res {
+				c.accessed(AccessGet, nkeys[i], r.OK)
+			}
+		}
+		return cr, nil
+	}
+}
+
+// GetWithExpiry will retrieve the item with the specified key, updating its
+// lru status, together with the time at which it expires.
+// The zero Time is returned for an item that does not expire.
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *BasicCache) GetWithExpiry(ctx context.Context, key Key) (v any, expiresAt time.Time, ok bool, err error) {
+	r, err := c.getEntry(ctx, key, lookupGet)
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	return r.v, r.expires, r.ok, nil
+}
+
+// GetWithVersion will retrieve the item with the specified key, updating its
+// lru status, together with its version, for use with PutIfVersion.
+// The version changes each time the value of the key is written, and is
+// zero if the key is not found.
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *BasicCache) GetWithVersion(ctx context.Context, key Key) (v any, version uint64, ok bool, err error) {
+	r, err := c.getEntry(ctx, key, lookupGet)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	return r.v, r.version, r.ok, nil
+}
+
+// EntryState describes the state of a key within the cache
+type EntryState int
+
+const (
+	// EntryAbsent indicates that the key is not held by the cache
+	EntryAbsent EntryState = iota
+	// EntryLive indicates that the key is held by the cache, and has not expired
+	EntryLive
+	// EntryExpired indicates that the key is held by the cache, but has expired, and
+	// so will be reported as not found (and removed) when next retrieved
+	EntryExpired
+)
+
+// GetRaw returns the value held for the key, and its state, which distinguishes
+// a key that has expired from one that is not held, as a diagnostic aid.
+// The value is returned even if the key has expired.  Neither the lru status
+// of the item is changed, nor is an expired item removed.
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *BasicCache) GetRaw(key Key) (value any, state EntryState, err error) {
+	r, err := c.getEntry(context.Background(), key, lookupRaw)
+	if err != nil {
+		return nil, EntryAbsent, err
+	}
+	switch {
+	case !r.ok:
+		return nil, EntryAbsent, nil
+	case r.expired:
+		return r.v, EntryExpired, nil
+	}
+	return r.v, EntryLive, nil
+}
+
+// Entry describes an item held in the cache
+type Entry struct {
+	Key   Key
+	Value any
+	// InsertedAt is when the key was added to the cache; it is not changed by
+	// subsequent writes to the key, unless the key was removed in between
+	InsertedAt time.Time
+	// LastAccessed is when the key was last retrieved or written
+	LastAccessed time.Time
+	// AccessCount is the number of times the key has been retrieved
+	AccessCount uint64
+	// Size is the size of the value, as measured by Sizer if provided,
+	// otherwise as estimated by EstimateSize
+	Size int64
+	// ExpiresAt is when the key expires, or the zero Time if it does not expire
+	ExpiresAt time.Time
+	// Version is the version of the value, as described by GetWithVersion
+	Version uint64
+}
+
+// GetEntry returns a description of the item with the specified key, or a nil Entry
+// if the key is not found.  The lru status and AccessCount of the item are not
+// changed, so GetEntry may be used for analysis of the cache without affecting it.
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *BasicCache) GetEntry(ctx context.Context, key Key) (*Entry, error) {
+	r, err := c.getEntry(ctx, key, lookupPeek)
+	if err != nil {
+		return nil, err
+	}
+	if !r.ok {
+		return nil, nil
+	}
+
+	size := int64(0)
+	if c.o.Sizer != nil {
+		size = c.o.Sizer(r.v)
+	} else {
+		size = EstimateSize(r.v)
+	}
+
+	return &Entry{
+		Key:          key,
+		Value:        r.v,
+		InsertedAt:   r.inserted,
+		LastAccessed: r.accessed,
+		AccessCount:  r.hits,
+		Size:         size,
+		ExpiresAt:    r.expires,
+		Version:      r.version,
+	}, nil
+}
+
+// getEntry retrieves the details of the item with the specified key, as determined by mode
+func (c *BasicCache) getEntry(ctx context.Context, key Key, mode lookupMode) (resp *getEntryResponse, err error) {
+
+	select {
+	case <-ctx.Done():
+		return nil, ErrInvalidContext
+	default:
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
+				err = ErrAttemptToUseInvalidCache
+			} else {
+				// Something unexpected - report this
+				err = fmt.Errorf("%v", r)
+				c.o.panicked(r)
+			}
+		}
+	}()
+
+	nkey := c.normalize(key)
+	if err := checkKeys(nkey); err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *getEntryResponse, 1)
+
+	req := &getEntryRequest{
+		k:    nkey,
+		mode: mode,
+		c:    ch,
+	}
+
+	timeout := time.After(c.timeout())
+
+	select {
+	case <-ctx.Done():
+		return nil, ErrInvalidContext
+	case <-c.done:
+		return nil, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return nil, ErrTimeout
+	case c.gex <- req:
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ErrInvalidContext
+	case <-c.done:
+		return nil, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return nil, ErrTimeout
+	case r, ok := <-ch:
+		if !ok {
+			return nil, ErrUnknown
+		}
+		if r.ok {
+			r.v = c.copyOnGet(r.v)
+		}
+		return r, nil
+	}
+}
+
+// PutIfVersion will insert the item with the specified key, only if its current
+// version (as returned by GetWithVersion) matches expected, returning whether the
+// item was inserted.  An expected version of zero inserts the item only if the key
+// is not found.  The check and insert are a single atomic operation.
+// An error is raised if val is nil or too large to be added to the cache,
+// if the Close() has been called, or the timeout for the operation is exceeded.
+func (c *BasicCache) PutIfVersion(ctx context.Context, key Key, val any, expected uint64) (stored bool, err error) {
+
+	select {
+	case <-ctx.Done():
+		return false, ErrInvalidContext
+	default:
+	}
+
+	if err := c.checkValue(key, val); err != nil {
+		return false, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
+				err = ErrAttemptToUseInvalidCache
+			} else {
+				// Something unexpected - report this
+				err = fmt.Errorf("%v", r)
+				c.o.panicked(r)
+			}
+		}
+	}()
+
+	nkey := c.normalize(key)
+	if err := checkKeys(nkey); err != nil {
+		return false, err
+	}
+
+	ch := make(chan bool, 1)
+
+	req := &putIfVersionRequest{
+		k:        nkey,
+		v:        c.copyOnPut(val),
+		expected: expected,
+		c:        ch,
+	}
+
+	timeout := time.After(c.timeout())
+
+	select {
+	case <-ctx.Done():
+		return false, ErrInvalidContext
+	case <-c.done:
+		return false, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return false, ErrTimeout
+	case c.cas <- req:
+	}
+
+	select {
+	case <-ctx.Done():
+		return false, ErrInvalidContext
+	case <-c.done:
+		return false, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return false, ErrTimeout
+	case stored, ok := <-ch:
+		if !ok {
+			return false, ErrUnknown
+		}
+		c.accessed(AccessPut, nkey, stored)
+		return stored, nil
+	}
+}
+
+// GetOrLoad will retrieve the item with the specified key, updating its lru status.
+// If the key is not found then loader is called for its value, which is added to
+// the cache with the default TTL and returned.  If loader returns an error then
+// nothing is added and the error is returned; a panic in loader is returned as an error.
+// The load is not atomic with the lookup, so concurrent calls for a missing key may
+// each call loader, with the last value added retained; a LoadingCache shares loads.
+// An error is raised if the loaded value cannot be added to the cache (for example,
+// if it is nil), if the Close() has been called, or the timeout for the operation is exceeded.
+func (c *BasicCache) GetOrLoad(ctx context.Context, key Key, loader func(ctx context.Context, key Key) (any, error)) (any, error) {
+	return c.GetOrLoadWithTTL(ctx, key, 0, loader)
+}
+
+// GetOrLoadWithTTL is GetOrLoad, adding the loaded value with the specified ttl,
+// or with the default TTL if ttl is zero.
+func (c *BasicCache) GetOrLoadWithTTL(ctx context.Context, key Key, ttl time.Duration, loader func(ctx context.Context, key Key) (any, error)) (v any, err error) {
+	if ttl < 0 {
+		return nil, ErrInvalidTTL
+	}
+	if loader == nil {
+		return nil, ErrInvalidLoader
+	}
+
+	v, ok, err := c.Get(ctx, key)
+	if err != nil || ok {
+		return v, err
+	}
+
+	v, err = func() (v any, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("unexpected error: %v", r)
+				c.o.panicked(r)
+			}
+		}()
+		return loader(ctx, key)
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	// The loaded value is added even if ctx completes, as it is then available to other requests
+	if err := c.PutWithTTL(context.WithoutCancel(ctx), key, v, ttl); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// GetOrDefault will retrieve the item with the specified key, updating its lru status.
+// If the key is not found then def is added to the cache for the key and returned,
+// as a single atomic operation; i.e. GetOrDefault mutates the cache on a miss.
+// An error is raised if def is nil or too large to be added to the cache,
+// if the Close() has been called, or the timeout for the operation is exceeded.
+func (c *BasicCache) GetOrDefault(ctx context.Context, key Key, def any) (v any, err error) {
+
+	select {
+	case <-ctx.Done():
+		return nil, ErrInvalidContext
+	default:
+	}
+
+	if err := c.checkValue(key, def); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
+				err = ErrAttemptToUseInvalidCache
+			} else {
+				// Something unexpected - report this
+				err = fmt.Errorf("%v", r)
+				c.o.panicked(r)
+			}
+		}
+	}()
+
+	nkey := c.normalize(key)
+	if err := checkKeys(nkey); err != nil {
+		return nil, err
+	}
+
+	ch := make(chan any, 1)
+
+	req := &getOrDefaultRequest{
+		k:   nkey,
+		def: c.copyOnPut(def),
+		c:   ch,
+	}
+
+	timeout := time.After(c.timeout())
+
+	select {
+	case <-ctx.Done():
+		return nil, ErrInvalidContext
+	case <-c.done:
+		return nil, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return nil, ErrTimeout
+	case c.god <- req:
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ErrInvalidContext
+	case <-c.done:
+		return nil, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return nil, ErrTimeout
+	case v, ok := <-ch:
+		if !ok {
+			return nil, ErrUnknown
+		}
+		return c.copyOnGet(v), nil
+	}
+}
+
+// copyOnGet returns the copy of v to be returned to the caller, if CopyOnGet is set.
+// A nil value (see AllowNilValues) is not copied.
+func (c *BasicCache) copyOnGet(v any) any {
+	if c.o.CopyOnGet == nil || v == nil {
+		return v
+	}
+	return c.o.CopyOnGet(v)
+}
+
+// copyOnPut returns the copy of v to be held by the cache, if CopyOnPut is set.
+// A nil value (see AllowNilValues) is not copied.
+func (c *BasicCache) copyOnPut(v any) any {
+	if c.o.CopyOnPut == nil || v == nil {
+		return v
+	}
+	return c.o.CopyOnPut(v)
+}
+
+// Increment atomically adds delta to the int64 value of the key, updating its
+// lru status, and returns the new value.  An absent key is treated as zero, and
+// is added to the cache with the default TTL; otherwise the expiry is unchanged.
+// ErrValueNotInt64 is returned, and the value is unchanged, if the key holds a
+// value of any other type.
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *BasicCache) Increment(ctx context.Context, key Key, delta int64) (n int64, err error) {
+
+	select {
+	case <-ctx.Done():
+		return 0, ErrInvalidContext
+	default:
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
+				err = ErrAttemptToUseInvalidCache
+			} else {
+				// Something unexpected - report this
+				err = fmt.Errorf("%v", r)
+				c.o.panicked(r)
+			}
+		}
+	}()
+
+	nkey := c.normalize(key)
+	if err := checkKeys(nkey); err != nil {
+		return 0, err
+	}
+
+	ch := make(chan *incrementResponse, 1)
+
+	req := &incrementRequest{
+		k:     nkey,
+		delta: delta,
+		c:     ch,
+	}
+
+	timeout := time.After(c.timeout())
+
+	select {
+	case <-ctx.Done():
+		return 0, ErrInvalidContext
+	case <-c.done:
+		return 0, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return 0, ErrTimeout
+	case c.inc <- req:
+	}
+
+	select {
+	case <-ctx.Done():
+		return 0, ErrInvalidContext
+	case <-c.done:
+		return 0, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return 0, ErrTimeout
+	case r, ok := <-ch:
+		if !ok {
+			return 0, ErrUnknown
+		}
+		return r.n, r.err
+	}
+}
+
+// Update atomically replaces the value of the key with that returned by fn, which is
+// passed the current value and whether the key was found, and returns the new value.
+// If fn returns an error then the value is unchanged and the error is returned.
+// The new value is added as with Put, so must not be nil (unless AllowNilValues is set),
+// and is given the default TTL.
+// By default fn is called by the goroutine of the cache, so that the update is atomic
+// with respect to all other operations, which wait for fn to complete; fn should
+// therefore be fast, and must not call back into the cache.  If ConcurrentUpdates is
+// set then fn is instead called by the caller's goroutine whilst holding a lock for
+// the key, so that Updates of different keys proceed in parallel.
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *BasicCache) Update(ctx context.Context, key Key, fn func(value any, ok bool) (any, error)) (v any, err error) {
+
+	select {
+	case <-ctx.Done():
+		return nil, ErrInvalidContext
+	default:
+	}
+
+	if c.o.ConcurrentUpdates {
+		return c.updateWithKeyLock(ctx, key, fn)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
+				err = ErrAttemptToUseInvalidCache
+			} else {
+				// Something unexpected - report this
+				err = fmt.Errorf("%v", r)
+				c.o.panicked(r)
+			}
+		}
+	}()
+
+	nkey := c.normalize(key)
+	if err := checkKeys(nkey); err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *updateResponse, 1)
+
+	req := &updateRequest{
+		k: nkey,
+		fn: func(value any, ok bool) (any, error) {
+			if ok {
+				value = c.copyOnGet(value)
+			}
+			nv, err := fn(value, ok)
+			if err != nil {
+				return nil, err
+			}
+			if err := c.checkValue(nkey, nv); err != nil {
+				return nil, err
+			}
+			return c.copyOnPut(nv), nil
+		},
+		c: ch,
+	}
+
+	timeout := time.After(c.timeout())
+
+	select {
+	case <-ctx.Done():
+		return nil, ErrInvalidContext
+	case <-c.done:
+		return nil, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return nil, ErrTimeout
+	case c.upd <- req:
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ErrInvalidContext
+	case <-c.done:
+		return nil, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return nil, ErrTimeout
+	case r, ok := <-ch:
+		if !ok {
+			return nil, ErrUnknown
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+		c.accessed(AccessPut, nkey, true)
+		return c.copyOnGet(r.v), nil
+	}
+}
+
+// Swap atomically replaces the value of the key with val, returning the value
+// that was replaced and whether the key was held.  If the key was absent then
+// nil and false are returned.  The value is added as with Put, so must not be nil
+// (unless AllowNilValues is set), and is given the default TTL.
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *BasicCache) Swap(ctx context.Context, key Key, val any) (old any, existed bool, err error) {
+
+	select {
+	case <-ctx.Done():
+		return nil, false, ErrInvalidContext
+	default:
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
+				err = ErrAttemptToUseInvalidCache
+			} else {
+				// Something unexpected - report this
+				err = fmt.Errorf("%v", r)
+				c.o.panicked(r)
+			}
+		}
+	}()
+
+	nkey := c.normalize(key)
+	if err := checkKeys(nkey); err != nil {
+		return nil, false, err
+	}
+	if err := c.checkValue(nkey, val); err != nil {
+		return nil, false, err
+	}
+	nv := c.copyOnPut(val)
+
+	// Set by the goroutine of the cache, so only read once the response is received
+	var prev any
+	var found bool
+
+	ch := make(chan *updateResponse, 1)
+
+	req := &updateRequest{
+		k: nkey,
+		fn: func(value any, ok bool) (any, error) {
+			prev, found = value, ok
+			return nv, nil
+		},
+		c: ch,
+	}
+
+	timeout := time.After(c.timeout())
+
+	select {
+	case <-ctx.Done():
+		return nil, false, ErrInvalidContext
+	case <-c.done:
+		return nil, false, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return nil, false, ErrTimeout
+	case c.upd <- req:
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, false, ErrInvalidContext
+	case <-c.done:
+		return nil, false, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return nil, false, ErrTimeout
+	case r, ok := <-ch:
+		if !ok {
+			return nil, false, ErrUnknown
+		}
+		if r.err != nil {
+			return nil, false, r.err
+		}
+		c.accessed(AccessPut, nkey, true)
+		if found {
+			prev = c.copyOnGet(prev)
+		}
+		return prev, found, nil
+	}
+}
+
+// Merge atomically combines val with the value held for the key, storing the value
+// returned by merge(existing, val), or stores val if the key is absent.
+// This avoids the race between a Get and a Put when accumulating values, such
+// as summing counts or appending to a slice.  The stored value is added as with Put,
+// so must not be nil (unless AllowNilValues is set), and is given the default TTL.
+// merge is called by the goroutine of the cache, which serves no other requests
+// until it returns, so merge must be fast, must not block, and must not call back
+// into the cache.  A panic in merge is returned as an error, with the value unchanged.
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *BasicCache) Merge(ctx context.Context, key Key, val any, merge func(existing, incoming any) any) (err error) {
+
+	select {
+	case <-ctx.Done():
+		return ErrInvalidContext
+	default:
+	}
+
+	if merge == nil {
+		return ErrInvalidMerge
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
+				err = ErrAttemptToUseInvalidCache
+			} else {
+				// Something unexpected - report this
+				err = fmt.Errorf("%v", r)
+				c.o.panicked(r)
+			}
+		}
+	}()
+
+	nkey := c.normalize(key)
+	if err := checkKeys(nkey); err != nil {
+		return err
+	}
+
+	ch := make(chan *updateResponse, 1)
+
+	req := &updateRequest{
+		k: nkey,
+		fn: func(value any, ok bool) (any, error) {
+			nv := val
+			if ok {
+				nv = merge(c.copyOnGet(value), val)
+			}
+			if err := c.checkValue(nkey, nv); err != nil {
+				return nil, err
+			}
+			return c.copyOnPut(nv), nil
+		},
+		c: ch,
+	}
+
+	timeout := time.After(c.timeout())
+
+	select {
+	case <-ctx.Done():
+		return ErrInvalidContext
+	case <-c.done:
+		return ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return ErrTimeout
+	case c.upd <- req:
+	}
+
+	select {
+	case <-ctx.Done():
+		return ErrInvalidContext
+	case <-c.done:
+		return ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return ErrTimeout
+	case r, ok := <-ch:
+		if !ok {
+			return ErrUnknown
+		}
+		if r.err != nil {
+			return r.err
+		}
+		c.accessed(AccessPut, nkey, true)
+		return nil
+	}
+}
+
+var ErrInvalidMerge = errors.New("merge must not be nil")
+
+// checkValue returns an error if the value may not be added to the cache
+func (c *BasicCache) checkValue(key Key, val any) error {
+	if val == nil && !c.o.AllowNilValues && !c.o.SkipNilCheck {
+		return ErrInvalidValueToAddToCache
+	}
+	if _, sizeErrs := c.checkSizes([]KeyVal{{Key: key, Value: val}}); len(sizeErrs) > 0 {
+		return errors.Join(sizeErrs...)
+	}
+	return nil
+}
+
+// updateWithKeyLock completes an Update by retrieving and then putting the value
+// whilst holding the lock of the key, so that fn does not block the cache.
+// The update is atomic with respect to other Updates only.
+func (c *BasicCache) updateWithKeyLock(ctx context.Context, key Key, fn func(value any, ok bool) (any, error)) (any, error) {
+	nkey := c.normalize(key)
+	if err := checkKeys(nkey); err != nil {
+		return nil, err
+	}
+
+	unlock := c.lockKey(nkey)
+	defer unlock()
+
+	r, err := c.getEntry(ctx, key, lookupGet)
+	if err != nil {
+		return nil, err
+	}
+
+	nv, err := fn(r.v, r.ok)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkValue(nkey, nv); err != nil {
+		return nil, err
+	}
+	if err := c.Put(ctx, key, nv); err != nil {
+		return nil, err
+	}
+	return nv, nil
+}
+
+// keyLock is a lock for a key, which is discarded once it has no users
+type keyLock struct {
+	mu    sync.Mutex
+	users int
+}
+
+// lockKey acquires the lock for the key, returning the func to release it
+func (c *BasicCache) lockKey(key Key) func() {
+	c.keyLocksMu.Lock()
+	if c.keyLocks == nil {
+		c.keyLocks = map[Key]*keyLock{}
+	}
+	l, ok := c.keyLocks[key]
+	if !ok {
+		l = &keyLock{}
+		c.keyLocks[key] = l
+	}
+	l.users++
+	c.keyLocksMu.Unlock()
+
+	l.mu.Lock()
+
+	return func() {
+		l.mu.Unlock()
+
+		c.keyLocksMu.Lock()
+		defer c.keyLocksMu.Unlock()
+		l.users--
+		if l.users == 0 {
+			delete(c.keyLocks, key)
+		}
+	}
+}
+
+// Contains returns true if the key is held in the cache, without updating its lru status.
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *BasicCache) Contains(key Key) (bool, error) {
+	m, err := c.ContainsBatch([]Key{key})
+	if err != nil {
+		return false, err
+	}
+	return m[key], nil
+}
+
+// ContainsBatch reports whether each of the keys is held in the cache, without
+// updating their lru status, using a single request to the cache.
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *BasicCache) ContainsBatch(keys []Key) (m map[Key]bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
+				err = ErrAttemptToUseInvalidCache
+			} else {
+				// Something unexpected - report this
+				err = fmt.Errorf("%v", r)
+				c.o.panicked(r)
+			}
+		}
+	}()
+
+	nkeys := c.normalizeKeys(keys)
+	if err := checkKeys(nkeys...); err != nil {
+		return nil, err
+	}
+
+	ch := make(chan []bool, 1)
+
+	req := &containsRequest{
+		keys: nkeys,
+		c:    ch,
+	}
+
+	timeout := time.After(c.timeout())
+
+	select {
+	case <-c.done:
+		return nil, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return nil, ErrTimeout
+	case c.has <- req:
+	}
+
+	select {
+	case <-c.done:
+		return nil, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return nil, ErrTimeout
+	case r, ok := <-ch:
+		if !ok {
+			return nil, ErrUnknown
+		}
+		m = make(map[Key]bool, len(keys))
+		for i, k := range keys {
+			m[k] = r[i]
+		}
+		return m, nil
+	}
+}
+
+// Len returns the number of items in the cache
+// An error is raised if the Close() has been called, or
+// the timeoout for the operation is exceeded.
+func (c *BasicCache) Len() (l int, err error) {
+	return c.LenContext(context.Background())
+}
+
+// LenContext returns the number of items in the cache, returning
+// ErrInvalidContext promptly if the context completes first.
+// An error is raised if the Close() has been called, or
+// the timeoout for the operation is exceeded.
+func (c *BasicCache) LenContext(ctx context.Context) (int, error) {
+	r, err := c.getLen(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return r.len, nil
+}
+
+// Weight returns the total weight of the items in the cache, as determined
+// by the Weigher option.  Without a Weigher, each item has a weight of 1.
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *BasicCache) Weight() (int, error) {
+	r, err := c.getLen(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	return r.weight, nil
+}
+
+// getLen returns the current usage and capacity of the cache
+func (c *BasicCache) getLen(ctx context.Context) (resp *getLenResponse, err error) {
+
+	select {
+	case <-ctx.Done():
+		return nil, ErrInvalidContext
+	default:
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
+				err = ErrAttemptToUseInvalidCache
+			} else {
+				// Something unexpected - report this
+				err = fmt.Errorf("%v", r)
+				c.o.panicked(r)
+			}
+		}
+	}()
+
+	ch := make(chan *getLenResponse, 1)
+
+	req := &getLenRequest{
+		c: ch,
+	}
+
+	timeout := time.After(c.timeout())
+
+	select {
+	case <-ctx.Done():
+		return nil, ErrInvalidContext
+	case <-c.done:
+		return nil, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return nil, ErrTimeout
+	case c.len <- req:
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ErrInvalidContext
+	case <-c.done:
+		return nil, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return nil, ErrTimeout
+	case r, ok := <-ch:
+		if !ok {
+			return nil, ErrUnknown
+		}
+		return r, nil
+	}
+}
+
+// Config returns the configuration of the cache, with its current capacity
+func (c *BasicCache) Config() CacheConfig {
+	return CacheConfig{
+		Capacity:          int(c.capacity.Load()),
+		Timeout:           c.timeout(),
+		TTL:               c.o.TTL,
+		Policy:            PolicyLRU,
+		ChannelBufferSize: requestChannelSize,
+	}
+}
+
+// infiniteTimeout is the timeout used for operations if none is specified
+const infiniteTimeout = 24 * time.Hour
+
+// SetTimeout changes the time allowed for each subsequent operation on the cache,
+// so that it can be tuned whilst the cache is in use; operations already in progress
+// retain their prior timeout.  If d <= 0 then an infinite timeout is used, as when
+// the cache is created.
+// An error is raised if the Close() has been called.
+func (c *BasicCache) SetTimeout(d time.Duration) error {
+	if c.closed.Load() {
+		return ErrAttemptToUseInvalidCache
+	}
+	c.setTimeout(d)
+	return nil
+}
+
+// setTimeout sets the timeout for operations, substituting infiniteTimeout if d <= 0
+func (c *BasicCache) setTimeout(d time.Duration) {
+	if d <= 0 {
+		d = infiniteTimeout // Effectively infinite
+	}
+	c.d.Store(int64(d))
+}
+
+// timeout returns the time allowed for each operation
+func (c *BasicCache) timeout() time.Duration {
+	return time.Duration(c.d.Load())
+}
+
+// ChannelStats returns the number of requests currently queued on the request channels,
+// each of which is buffered to hold 100 requests, totalled by the kind of operation:
+//   - put counts Put, PutBatch, PutIfVersion, Increment and Update
+//   - get counts Get, GetBatch, GetEntry, GetOrDefault and Contains
+//   - rm counts Remove, RemoveBatch, RemoveWhere, Clear, Drain and Evict
+//   - other counts all remaining operations, such as Len, Ping, ForEach, Resize and Pin
+//
+// The depths are a coarse, momentary signal of whether the cache is keeping up
+// with its load; they may have changed by the time they are returned.
+// An error is raised if the Close() has been called.
+func (c *BasicCache) ChannelStats() (put, get, rm, other int, err error) {
+	if c.closed.Load() {
+		return 0, 0, 0, 0, ErrAttemptToUseInvalidCache
+	}
+	put = len(c.put) + len(c.cas) + len(c.inc) + len(c.upd)
+	get = len(c.get) + len(c.one) + len(c.gex) + len(c.god) + len(c.has)
+	rm = len(c.rm) + len(c.rmb) + len(c.rmw) + len(c.clr) + len(c.evc)
+	other = len(c.len) + len(c.png) + len(c.itr) + len(c.rsz) + len(c.pin)
+	return put, get, rm, other, nil
+}
+
+// Put will insert the item with the specified key
+// into the cache, replacing what was previously there (if anything).
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *BasicCache) Put(ctx context.Context, key Key, val any) (err error) {
+	return c.PutBatch(ctx, []KeyVal{{Key: key, Value: val}})
+}
+
+const (
+	oTELBasicCachePutBatchStarted = "BasicCache.PutBatch started"
+	oTELBasicCachePutBatchEnded   = "BasicCache.PutBatch ended"
+	oTELBasicCachePutBatchError   = "BasicCache.PutBatch error"
+	oTELBasicCachePutBatchSpan    = "BasicCache.PutBatch"
+)
+
+var ErrInvalidValueToAddToCache = errors.New("value associated to a key cannot be nil")
+var ErrValueTooLarge = errors.New("value exceeds the maximum size allowed in the cache")
+
+// PutError describes the failure to add the value of a specific key to the cache
+type PutError struct {
+	Key Key
+	Err error
+}
+
+func (e *PutError) Error() string {
+	return fmt.Sprintf("put failed for key %v: %v", e.Key, e.Err)
+}
+
+func (e *PutError) Unwrap() error {
+	return e.Err
+}
+
+// checkSizes returns the entries that may be added to the cache, together with
+// a PutError for each entry that exceeds the MaxValueSize
+func (c *BasicCache) checkSizes(vals []KeyVal) ([]KeyVal, []error) {
+	if c.o.MaxValueSize <= 0 {
+		return vals, nil
+	}
+
+	var errs []error
+	accepted := make([]KeyVal, 0, len(vals))
+	for _, v := range vals {
+		if v.Value != nil && c.o.Sizer(v.Value) > c.o.MaxValueSize {
+			errs = append(errs, &PutError{Key: v.Key, Err: ErrValueTooLarge})
+			continue
+		}
+		accepted = append(accepted, v)
+	}
+
+	if len(errs) > 0 && c.o.RejectWholeBatch {
+		return nil, errs
+	}
+	return accepted, errs
+}
+
+// dedupKeyVals collapses duplicate keys, retaining the last value (and position) of each
+func dedupKeyVals(vals []KeyVal) []KeyVal {
+	if len(vals) < 2 {
+		return vals
+	}
+
+	seen := make(map[Key]struct{}, len(vals))
+	deduped := make([]KeyVal, len(vals))
+	n := len(vals)
+	for i := len(vals) - 1; i >= 0; i-- {
+		if _, ok := seen[vals[i].Key]; ok {
+			continue
+		}
+		seen[vals[i].Key] = struct{}{}
+		n--
+		deduped[n] = vals[i]
+	}
+	return deduped[n:]
+}
+
+// PutBatch will insert the items into the cache, replacing what was previously there (if anything).
+// If a key appears more than once in vals then the last value for that key is the one retained.
+// An error is raised if the Close() has been called, or the timeoout for the operation is exceeded.
+// If MaxValueSize is set then oversized values are not added, and the returned error will
+// contain a PutError for each, matching ErrValueTooLarge.  The remaining values are added
+// unless RejectWholeBatch is set, in which case no values from the batch are added.
+// A nil value returns ErrInvalidValueToAddToCache, with the entries prior to it added
+// and those after it abandoned, unless SkipNilValues is set, in which case every
+// entry with a non-nil value is added, and the returned error will contain a PutError
+// for each entry with a nil value, matching ErrInvalidValueToAddToCache.
+// If AllowNilValues or SkipNilCheck is set then nil values are added as any other value.
+func (c *BasicCache) PutBatch(ctx context.Context, vals []KeyVal) (err error) {
+	return c.putBatch(ctx, vals, 0)
+}
+
+var ErrInvalidTTL = errors.New("ttl must be zero or a positive duration")
+
+// PutWithTTL will insert the item with the specified key into the cache, replacing
+// what was previously there (if anything), which will expire after the ttl.
+// If ttl is zero then the default TTL of the cache is applied.
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *BasicCache) PutWithTTL(ctx context.Context, key Key, val any, ttl time.Duration) (err error) {
+	if ttl < 0 {
+		return ErrInvalidTTL
+	}
+	return c.putBatch(ctx, []KeyVal{{Key: key, Value: val}}, ttl)
+}
+
+// putBatch adds the values to the cache, with the ttl (or the default TTL if zero)
+func (c *BasicCache) putBatch(ctx context.Context, vals []KeyVal, ttl time.Duration) (err error) {
+
+	select {
+	case <-ctx.Done():
+		return ErrInvalidContext
+	default:
+	}
+
+	if len(vals) == 0 {
+		return nil
+	}
+
+	var added = 0
+
+	ctx, curSpan, endSpan := startSpan(ctx, c.o, oTELBasicCachePutBatchSpan)
+	defer endSpan()
+	defer func() {
+		if r := recover(); r != nil {
+			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
+				err = ErrAttemptToUseInvalidCache
+			} else {
+				err = fmt.Errorf("unexpected error: %v", r)
+				c.o.panicked(r)
+			}
+			if curSpan != nil {
+				curSpan.AddEvent(oTELBasicCachePutBatchError, trace.WithTimestamp(time.Now().UTC()))
+				curSpan.SetStatus(codes.Error, err.Error())
+			}
+		} else if curSpan != nil {
+			curSpan.AddEvent(oTELBasicCachePutBatchEnded, trace.WithAttributes(attribute.Int("Added", added)), trace.WithTimestamp(time.Now().UTC()))
+		}
+	}()
+
+	if curSpan != nil {
+		curSpan.AddEvent(oTELBasicCachePutBatchStarted, trace.WithAttributes(attribute.Int("Requested", len(vals))), trace.WithTimestamp(time.Now().UTC()))
+	}
+
+	vals = c.normalizeKeyVals(vals)
+	for _, kv := range vals {
+		if err := checkKeys(kv.Key); err != nil {
+			return err
+		}
+	}
+
+	vals, sizeErrs := c.checkSizes(vals)
+
+	var nilErr error
+	switch {
+	case c.o.AllowNilValues || c.o.SkipNilCheck:
+		// Entries with nil values are added as any other, so need not be checked
+	case c.o.SkipNilValues:
+		// Entries with nil values are skipped and reported, with the remainder added
+		accepted := make([]KeyVal, 0, len(vals))
+		for _, v := range vals {
+			if v.Value == nil {
+				sizeErrs = append(sizeErrs, &PutError{Key: v.Key, Err: ErrInvalidValueToAddToCache})
+				continue
+			}
+			accepted = append(accepted, v)
+		}
+		vals = accepted
+	default:
+		// Entries prior to the first nil value are still added, before the error is returned
+		for i, v := range vals {
+			if v.Value == nil {
+				vals = vals[:i]
+				nilErr = ErrInvalidValueToAddToCache
+				break
+			}
+		}
+	}
+
+	vals = dedupKeyVals(vals)
+
+	if c.o.CopyOnPut != nil {
+		// Copied into a new slice, so that the caller's slice is unchanged
+		copied := make([]KeyVal, len(vals))
+		for i, kv := range vals {
+			copied[i] = KeyVal{Key: kv.Key, Value: c.copyOnPut(kv.Value)}
+		}
+		vals = copied
+	}
+
+	if len(vals) > 0 {
+		ch := make(chan struct{}, 1)
+
+		// The whole batch is sent in a single request, to minimise round trips
+		req := &putRequest{
+			kvs: vals,
+			ttl: ttl,
+			c:   ch,
+		}
+
+		timeout := time.After(c.timeout())
+
+		select {
+		case <-ctx.Done():
+			return ErrInvalidContext
+		case <-c.done:
+			return ErrAttemptToUseInvalidCache
+		case <-timeout:
+			return ErrTimeout
+		case c.put <- req:
+		}
+
+		select {
+		case <-ctx.Done():
+			return ErrInvalidContext
+		case <-c.done:
+			return ErrAttemptToUseInvalidCache
+		case <-timeout:
+			return ErrTimeout
+		case _, ok := <-ch:
+			if !ok {
+				return ErrUnknown
+			}
+			added = len(vals)
+		}
+
+		if c.o.OnAccess != nil {
+			for _, kv := range vals {
+				c.accessed(AccessPut, kv.Key, true)
+			}
+		}
+	}
+
+	if nilErr != nil {
+		return nilErr
+	}
+	return errors.Join(sizeErrs...)
+}
+
+// Remove will remove the item with the specified key
+// from the cache, ignoring if it does not exist.
+// An error is raised if the Close() has been called, or
+// the timeoout for the operation is exceeded.
+func (c *BasicCache) Remove(key Key) error {
+	return c.RemoveContext(context.Background(), key)
+}
+
+// RemoveContext is Remove, which is abandoned with ErrInvalidContext
+// should the context complete before the item is removed.
+func (c *BasicCache) RemoveContext(ctx context.Context, key Key) (err error) {
+
+	select {
+	case <-ctx.Done():
+		return ErrInvalidContext
+	default:
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
+				err = ErrAttemptToUseInvalidCache
+			} else {
+				// Something unexpected - report this
+				err = fmt.Errorf("%v", r)
+				c.o.panicked(r)
+			}
+		}
+	}()
+
+	nkey := c.normalize(key)
+	if err := checkKeys(nkey); err != nil {
+		return err
+	}
+
+	ch := make(chan bool, 1)
+
+	req := &removeRequest{
+		k: nkey,
+		c: ch,
+	}
+
+	timeout := time.After(c.timeout())
+
+	select {
+	case <-ctx.Done():
+		return ErrInvalidContext
+	case <-c.done:
+		return ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return ErrTimeout
+	case c.rm <- req:
+	}
+
+	select {
+	case <-ctx.Done():
+		return ErrInvalidContext
+	case <-c.done:
+		return ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return ErrTimeout
+	case held, ok := <-ch:
+		if !ok {
+			return ErrUnknown
+		}
+		c.accessed(AccessRemove, nkey, held)
+		return nil
+	}
+}
+
+// RemoveBatch will remove the items with the specified keys from the cache,
+// ignoring any that do not exist, and returns the number of items removed.
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *BasicCache) RemoveBatch(keys []Key) (int, error) {
+	return c.RemoveBatchContext(context.Background(), keys)
+}
+
+// RemoveBatchContext is RemoveBatch, which is abandoned with ErrInvalidContext
+// should the context complete before the items are removed.
+func (c *BasicCache) RemoveBatchContext(ctx context.Context, keys []Key) (n int, err error) {
+
+	select {
+	case <-ctx.Done():
+		return 0, ErrInvalidContext
+	default:
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
+				err = ErrAttemptToUseInvalidCache
+			} else {
+				// Something unexpected - report this
+				err = fmt.Errorf("%v", r)
+				c.o.panicked(r)
+			}
+		}
+	}()
+
+	nkeys := c.normalizeKeys(keys)
+	if err := checkKeys(nkeys...); err != nil {
+		return 0, err
+	}
+
+	ch := make(chan []bool, 1)
+
+	req := &removeBatchRequest{
+		keys: nkeys,
+		c:    ch,
+	}
+
+	timeout := time.After(c.timeout())
+
+	select {
+	case <-ctx.Done():
+		return 0, ErrInvalidContext
+	case <-c.done:
+		return 0, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return 0, ErrTimeout
+	case c.rmb <- req:
+	}
+
+	select {
+	case <-ctx.Done():
+		return 0, ErrInvalidContext
+	case <-c.done:
+		return 0, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return 0, ErrTimeout
+	case removed, ok := <-ch:
+		if !ok {
+			return 0, ErrUnknown
+		}
+		n := 0
+		for i, held := range removed {
+			if held {
+				n++
+			}
+			c.accessed(AccessRemove, nkeys[i], held)
+		}
+		return n, nil
+	}
+}
+
+// Operations reported to OnAccess
+const (
+	AccessGet    = "Get"
+	AccessPut    = "Put"
+	AccessRemove = "Remove"
+)
+
+// accessed notifies OnAccess, if set, of the operation on the key.
+// A panic in OnAccess is reported to OnPanic, so that it does not affect the caller.
+func (c *BasicCache) accessed(op string, key Key, hit bool) {
+	if c.o.OnAccess == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			c.o.panicked(r)
+		}
+	}()
+	c.o.OnAccess(op, key, hit)
+}
+
+var ErrInvalidPredicate = errors.New("predicate must not be nil")
+
+// RemoveWhere will remove all items from the cache for which pred returns true,
+// returning the number of items removed.
+// pred is evaluated within the cache, so should be fast and must not
+// call back into the cache.
+// An error is raised if the Close() has been called, or
+// the timeoout for the operation is exceeded.
+func (c *BasicCache) RemoveWhere(pred func(key Key, value any) bool) (n int, err error) {
+	if pred == nil {
+		return 0, ErrInvalidPredicate
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
+				err = ErrAttemptToUseInvalidCache
+			} else {
+				// Something unexpected - report this
+				err = fmt.Errorf("%v", r)
+				c.o.panicked(r)
+			}
+		}
+	}()
+
+	ch := make(chan *removeWhereResponse, 1)
+
+	req := &removeWhereRequest{
+		pred: pred,
+		c:    ch,
+	}
+
+	timeout := time.After(c.timeout())
+
+	select {
+	case <-c.done:
+		return 0, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return 0, ErrTimeout
+	case c.rmw <- req:
+	}
+
+	select {
+	case <-c.done:
+		return 0, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return 0, ErrTimeout
+	case r, ok := <-ch:
+		if !ok {
+			return 0, ErrUnknown
+		}
+		return r.n, r.err
+	}
+}
+
+var ErrKeyNotComparable = errors.New("key must be comparable")
+
+// checkKeys returns ErrKeyNotComparable if any of the keys cannot be used
+// as a map key, such as a slice, map or func, or a struct or interface holding one
+func checkKeys(keys ...Key) error {
+	for _, key := range keys {
+		if key != nil && !reflect.ValueOf(key).Comparable() {
+			return fmt.Errorf("%w: %T", ErrKeyNotComparable, key)
+		}
+	}
+	return nil
+}
+
+// normalize applies the KeyNormalizer, if specified, to the key
+func (c *BasicCache) normalize(key Key) Key {
+	if c.o.KeyNormalizer == nil {
+		return key
+	}
+	return c.o.KeyNormalizer(key)
+}
+
+// normalizeKeys returns the keys after applying the KeyNormalizer, if specified
+func (c *BasicCache) normalizeKeys(keys []Key) []Key {
+	if c.o.KeyNormalizer == nil {
+		return keys
+	}
+	nk := make([]Key, len(keys))
+	for i, k := range keys {
+		nk[i] = c.o.KeyNormalizer(k)
+	}
+	return nk
+}
+
+// normalizeKeyVals returns the values after applying the KeyNormalizer to their keys, if specified
+func (c *BasicCache) normalizeKeyVals(vals []KeyVal) []KeyVal {
+	if c.o.KeyNormalizer == nil {
+		return vals
+	}
+	nv := make([]KeyVal, len(vals))
+	for i, v := range vals {
+		nv[i] = KeyVal{Key: c.o.KeyNormalizer(v.Key), Value: v.Value}
+	}
+	return nv
+}
+
+// Resize changes the capacity of the cache, evicting the least recently used items
+// if the cache holds more than maxEntries, which are returned in the order of eviction.
+// If maxEntries = 0 then the cache will grow indefinitely, and nothing is evicted.
+// Resizing an unbounded cache to a positive maxEntries (for example, after a bulk
+// import) evicts only the excess, retaining the maxEntries most recently used items,
+// unless EvictionBatchSize is set, in which case the excess is evicted incrementally.
+// ErrCapacityBelowPinned is returned if maxEntries is less than the capacity
+// required by the pinned items, which must be unpinned first.
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *BasicCache) Resize(maxEntries int) (evicted []KeyVal, err error) {
+	if maxEntries < 0 {
+		return nil, ErrInvalidMaxEntries
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
+				err = ErrAttemptToUseInvalidCache
+			} else {
+				// Something unexpected - report this
+				err = fmt.Errorf("%v", r)
+				c.o.panicked(r)
+			}
+		}
+	}()
+
+	ch := make(chan *resizeResponse, 1)
+
+	req := &resizeRequest{
+		n: maxEntries,
+		c: ch,
+	}
+
+	timeout := time.After(c.timeout())
+
+	select {
+	case <-c.done:
+		return nil, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return nil, ErrTimeout
+	case c.rsz <- req:
+	}
+
+	select {
+	case <-c.done:
+		return nil, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return nil, ErrTimeout
+	case r, ok := <-ch:
+		if !ok {
+			return nil, ErrUnknown
+		}
+		return r.evicted, r.err
+	}
+}
+
+// Pin exempts the item with the specified key from eviction to maintain the
+// capacity of the cache, returning false if the key is not found.
+// Pinned items can still be removed explicitly, or by Clear, and still expire.
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *BasicCache) Pin(key Key) (bool, error) {
+	return c.setPinned(key, true)
+}
+
+// Unpin allows the item with the specified key to be evicted once more,
+// returning false if the key is not found.
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *BasicCache) Unpin(key Key) (bool, error) {
+	return c.setPinned(key, false)
+}
+
+func (c *BasicCache) setPinned(key Key, pin bool) (found bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
+				err = ErrAttemptToUseInvalidCache
+			} else {
+				// Something unexpected - report this
+				err = fmt.Errorf("%v", r)
+				c.o.panicked(r)
+			}
+		}
+	}()
+
+	nkey := c.normalize(key)
+	if err := checkKeys(nkey); err != nil {
+		return false, err
+	}
+
+	ch := make(chan bool, 1)
+
+	req := &pinRequest{
+		k:   nkey,
+		pin: pin,
+		c:   ch,
+	}
+
+	timeout := time.After(c.timeout())
+
+	select {
+	case <-c.done:
+		return false, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return false, ErrTimeout
+	case c.pin <- req:
+	}
+
+	select {
+	case <-c.done:
+		return false, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return false, ErrTimeout
+	case found, ok := <-ch:
+		if !ok {
+			return false, ErrUnknown
+		}
+		return found, nil
+	}
+}
 
-	select {
-	case <-ctx.Done():
-		return nil, ErrInvalidContext
-	default:
+// Evict removes up to n of the least recently used items from the cache,
+// without changing its capacity, returning the number actually removed.
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *BasicCache) Evict(n int) (removed int, err error) {
+	if n <= 0 {
+		return 0, nil
 	}
 
-	curSpan := trace.SpanFromContext(ctx)
 	defer func() {
 		if r := recover(); r != nil {
 			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
 				err = ErrAttemptToUseInvalidCache
 			} else {
-				err = fmt.Errorf("unexpected error: %v", r)
+				// Something unexpected - report this
+				err = fmt.Errorf("%v", r)
+				c.o.panicked(r)
 			}
-			curSpan.AddEvent(oTELBasicCacheGetBatchError, trace.WithTimestamp(time.Now().UTC()))
-			curSpan.SetStatus(codes.Error, err.Error())
-		} else {
-			curSpan.AddEvent(oTELBasicCacheGetBatchEnded, trace.WithAttributes(attribute.Int("Retrieved", len(cr))), trace.WithTimestamp(time.Now().UTC()))
 		}
 	}()
 
-	curSpan.AddEvent(oTELBasicCacheGetBatchStarted, trace.WithAttributes(attribute.Int("Requested", len(keys))), trace.WithTimestamp(time.Now().UTC()))
+	ch := make(chan int, 1)
+
+	req := &evictRequest{
+		n: n,
+		c: ch,
+	}
 
-	ch := make(chan []*CacheResult)
-	defer close(ch)
+	timeout := time.After(c.timeout())
 
-	c.get <- &getRequest{
-		keys: keys,
-		c:    ch,
+	select {
+	case <-c.done:
+		return 0, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return 0, ErrTimeout
+	case c.evc <- req:
 	}
 
 	select {
-	case <-ctx.Done():
-		return nil, ErrInvalidContext
-	case <-time.After(c.d):
-		return nil, ErrTimeout
-	case cr, ok := <-ch:
+	case <-c.done:
+		return 0, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return 0, ErrTimeout
+	case removed, ok := <-ch:
 		if !ok {
-			return nil, ErrUnknown
+			return 0, ErrUnknown
 		}
-		return cr, nil
+		return removed, nil
 	}
 }
 
-// Len returns the number of items in the cache
+// Clear evicts all items from the cache, returning them from
+// the least to the most recently used.
 // An error is raised if the Close() has been called, or
-// the timeoout for the operation is exceeded.
-func (c *BasicCache) Len() (l int, err error) {
+// the timeout for the operation is exceeded.
+func (c *BasicCache) Clear() (evicted []KeyVal, err error) {
+	return c.clear(false)
+}
+
+// Drain removes all items from the cache, returning them from the most to the
+// least recently used (as returned by Snapshot, so they may be passed to Restore
+// of another cache).  Unlike Clear, the items are handed to the caller rather than
+// evicted, so OnEvict is not called, and expired items are discarded.  The copy
+// and removal are a single operation, so no other operation observes the cache
+// part way through, and the cache remains usable afterwards.
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *BasicCache) Drain() ([]KeyVal, error) {
+	return c.clear(true)
+}
+
+// clear removes all items from the cache, evicting them unless drain is true
+func (c *BasicCache) clear(drain bool) (evicted []KeyVal, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
@@ -142,47 +2169,46 @@ func (c *BasicCache) Len() (l int, err error) {
 			} else {
 				// Something unexpected - report this
 				err = fmt.Errorf("%v", r)
+				c.o.panicked(r)
 			}
 		}
 	}()
 
-	ch := make(chan *getLenResponse)
-	defer close(ch)
+	ch := make(chan []KeyVal, 1)
 
-	c.len <- &getLenRequest{
-		c: ch,
+	req := &clearRequest{
+		drain: drain,
+		c:     ch,
 	}
 
+	timeout := time.After(c.timeout())
+
 	select {
-	case <-time.After(c.d):
-		return 0, ErrTimeout
-	case r, ok := <-ch:
+	case <-c.done:
+		return nil, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return nil, ErrTimeout
+	case c.clr <- req:
+	}
+
+	select {
+	case <-c.done:
+		return nil, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return nil, ErrTimeout
+	case evicted, ok := <-ch:
 		if !ok {
-			return 0, ErrUnknown
+			return nil, ErrUnknown
 		}
-		return r.len, nil
+		return evicted, nil
 	}
 }
 
-// Put will insert the item with the specified key
-// into the cache, replacing what was previously there (if anything).
-// An error is raised if the Close() has been called, or
-// the timeout for the operation is exceeded.
-func (c *BasicCache) Put(ctx context.Context, key Key, val any) (err error) {
-	return c.PutBatch(ctx, []KeyVal{{Key: key, Value: val}})
-}
-
-const (
-	oTELBasicCachePutBatchStarted = "BasicCache.PutBatch started"
-	oTELBasicCachePutBatchEnded   = "BasicCache.PutBatch ended"
-	oTELBasicCachePutBatchError   = "BasicCache.PutBatch error"
-)
-
-var ErrInvalidValueToAddToCache = errors.New("value associated to a key cannot be nil")
-
-// PutBatch will insert the items into the cache, replacing what was previously there (if anything).
-// An error is raised if the Close() has been called, or the timeoout for the operation is exceeded.
-func (c *BasicCache) PutBatch(ctx context.Context, vals []KeyVal) (err error) {
+// Ping confirms that the cache is able to process requests.
+// ErrAttemptToUseInvalidCache is returned if the cache has been closed, either
+// by calling Close() or by the completion of the context that created it, and
+// ErrTimeout is returned if the cache does not respond within its timeout.
+func (c *BasicCache) Ping(ctx context.Context) (err error) {
 
 	select {
 	case <-ctx.Done():
@@ -190,65 +2216,65 @@ func (c *BasicCache) PutBatch(ctx context.Context, vals []KeyVal) (err error) {
 	default:
 	}
 
-	if len(vals) == 0 {
-		return nil
-	}
-
-	var added = 0
-
-	curSpan := trace.SpanFromContext(ctx)
 	defer func() {
 		if r := recover(); r != nil {
 			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
 				err = ErrAttemptToUseInvalidCache
 			} else {
-				err = fmt.Errorf("unexpected error: %v", r)
+				// Something unexpected - report this
+				err = fmt.Errorf("%v", r)
+				c.o.panicked(r)
 			}
-			curSpan.AddEvent(oTELBasicCachePutBatchError, trace.WithTimestamp(time.Now().UTC()))
-			curSpan.SetStatus(codes.Error, err.Error())
-		} else {
-			curSpan.AddEvent(oTELBasicCachePutBatchEnded, trace.WithAttributes(attribute.Int("Added", added)), trace.WithTimestamp(time.Now().UTC()))
 		}
 	}()
 
-	curSpan.AddEvent(oTELBasicCachePutBatchStarted, trace.WithAttributes(attribute.Int("Requested", len(vals))), trace.WithTimestamp(time.Now().UTC()))
+	ch := make(chan struct{}, 1)
 
-	ch := make(chan struct{})
-	defer close(ch)
-
-	for _, v := range vals {
+	req := &pingRequest{
+		c: ch,
+	}
 
-		if v.Value == nil {
-			return ErrInvalidValueToAddToCache
-		}
+	timeout := time.After(c.timeout())
 
-		c.put <- &putRequest{
-			k: v.Key,
-			v: v.Value,
-			c: ch,
-		}
+	select {
+	case <-ctx.Done():
+		return ErrInvalidContext
+	case <-c.done:
+		return ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return ErrTimeout
+	case c.png <- req:
+	}
 
-		select {
-		case <-ctx.Done():
-			return ErrInvalidContext
-		case <-time.After(c.d):
-			return ErrTimeout
-		case _, ok := <-ch:
-			if !ok {
-				return ErrUnknown
-			}
-			added++
+	select {
+	case <-ctx.Done():
+		return ErrInvalidContext
+	case <-c.done:
+		return ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return ErrTimeout
+	case _, ok := <-ch:
+		if !ok {
+			return ErrUnknown
 		}
+		return nil
 	}
-
-	return nil
 }
 
-// Remove will remove the item with the specified key
-// from the cache, ignoring if it does not exist.
+var ErrInvalidIterator = errors.New("fn must not be nil")
+
+// ForEach calls fn for each item in the cache, from the most to the least
+// recently used, stopping early if fn returns false.  The lru status of the
+// items is not changed, and expired items are skipped.
+// fn is called within the cache, so all other operations are blocked until
+// ForEach completes; fn should therefore be fast, and must not call back into the cache.
 // An error is raised if the Close() has been called, or
-// the timeoout for the operation is exceeded.
-func (c *BasicCache) Remove(key Key) (err error) {
+// the timeout for the operation is exceeded.
+func (c *BasicCache) ForEach(fn func(key Key, value any) bool) (err error) {
+	if fn == nil {
+		return ErrInvalidIterator
+	}
+
 	defer func() {
 		if r := recover(); r != nil {
 			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
@@ -256,41 +2282,161 @@ func (c *BasicCache) Remove(key Key) (err error) {
 			} else {
 				// Something unexpected - report this
 				err = fmt.Errorf("%v", r)
+				c.o.panicked(r)
 			}
 		}
 	}()
 
-	ch := make(chan struct{})
-	defer close(ch)
+	ch := make(chan error, 1)
 
-	c.rm <- &removeRequest{
-		k: key,
-		c: ch,
+	req := &forEachRequest{
+		fn: fn,
+		c:  ch,
+	}
+
+	timeout := time.After(c.timeout())
+
+	select {
+	case <-c.done:
+		return ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return ErrTimeout
+	case c.itr <- req:
 	}
 
 	select {
-	case <-time.After(c.d):
+	case <-c.done:
+		return ErrAttemptToUseInvalidCache
+	case <-timeout:
 		return ErrTimeout
-	case _, ok := <-ch:
+	case err, ok := <-ch:
 		if !ok {
 			return ErrUnknown
 		}
-		return nil
+		return err
+	}
+}
+
+// Find returns a snapshot of the items whose values satisfy pred, from the most
+// to least recently used, without changing their lru status.  Expired items are skipped.
+// Find is a linear scan of every item in the cache, during which all other
+// operations are blocked, so its cost grows with the size of the cache;
+// pred should therefore be fast, and must not call back into the cache.
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *BasicCache) Find(pred func(value any) bool) ([]KeyVal, error) {
+	if pred == nil {
+		return nil, ErrInvalidPredicate
+	}
+
+	matches := []KeyVal{}
+	err := c.ForEach(func(key Key, value any) bool {
+		if pred(value) {
+			matches = append(matches, KeyVal{Key: key, Value: value})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range matches {
+		matches[i].Value = c.copyOnGet(matches[i].Value)
+	}
+	return matches, nil
+}
+
+// Keys returns the keys of the items in the cache, from the most to least
+// recently used, without changing their lru status.  Expired items are skipped.
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *BasicCache) Keys() ([]Key, error) {
+	keys := []Key{}
+	err := c.ForEach(func(key Key, value any) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Snapshot returns a copy of the items in the cache, from the most to least
+// recently used, without changing their lru status.  Expired items are skipped.
+// As with ForEach, all other operations are blocked whilst the copy is taken.
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *BasicCache) Snapshot() ([]KeyVal, error) {
+	return c.Find(func(value any) bool { return true })
+}
+
+// Restore adds the items to the cache, which are assumed to be ordered from
+// the most to least recently used (as returned by Snapshot), so that this
+// order is preserved within the cache.  The items are added with the default
+// TTL, and are subject to the capacity of the cache, so the least recently
+// used items are evicted if there are more items than the capacity allows.
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *BasicCache) Restore(ctx context.Context, vals []KeyVal) error {
+	reversed := make([]KeyVal, len(vals))
+	for i, kv := range vals {
+		reversed[len(vals)-1-i] = kv
 	}
+	return c.PutBatch(ctx, reversed)
+}
+
+// Clone creates a new, fully independent cache, with the same capacity, timeout
+// and options as this cache, holding a copy of its items in the same lru order.
+// The items are added to the clone as described by Restore, so the clone does
+// not retain any item specific TTLs or pinning.
+// The context controls the lifetime of the clone, as with NewBasicCache.
+// Close() should be called when the clone is no longer needed, to release resources.
+func (c *BasicCache) Clone(ctx context.Context) (*BasicCache, error) {
+	r, err := c.getLen(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	vals, err := c.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	clone, err := NewBasicCache(ctx, r.capacity, c.timeout(), func(o *Options) { *o = c.o })
+	if err != nil {
+		return nil, err
+	}
+
+	if err := clone.Restore(ctx, vals); err != nil {
+		clone.Close()
+		return nil, err
+	}
+
+	return clone, nil
 }
 
 var ErrInvalidMaxEntries = errors.New("maxEntries must be zero or positive integer")
 
 var ErrInvalidContext = errors.New("context has already ended")
 
+// partialResultsError is returned, and reported for each unresolved key,
+// when a GetBatch with PartialResults set is interrupted by ctx completing
+func partialResultsError(ctx context.Context) error {
+	return fmt.Errorf("%w: %w", ErrInvalidContext, context.Cause(ctx))
+}
+
+var ErrInvalidSizer = errors.New("sizer must not be nil when a maximum value size is specified")
+
 // NewBasicCache creates a new LRU cache instance with the specified capacity
 // and timeout for request processing.
 // If capacity > 0 then a new addition will trigger eviction of the
 // least recently used item.  If capacity = 0 then cache will grow
 // indefinitely.
 // If timeout <= 0 then an infinite timeout is used (not recommended)
+// Additional behaviour can be configured using opts.
 // Close() should be called when the cache is no longer needed, to release resources
-func NewBasicCache(ctx context.Context, maxEntries int, timeout time.Duration) (*BasicCache, error) {
+func NewBasicCache(ctx context.Context, maxEntries int, timeout time.Duration, opts ...Option) (*BasicCache, error) {
 
 	select {
 	case <-ctx.Done():
@@ -302,70 +2448,319 @@ func NewBasicCache(ctx context.Context, maxEntries int, timeout time.Duration) (
 		return nil, ErrInvalidMaxEntries
 	}
 
-	if timeout <= 0 {
-		timeout = time.Duration(24 * time.Hour) // Effectively infinite
+	o := newOptions(opts)
+	if o.MaxValueSize > 0 && o.Sizer == nil {
+		return nil, ErrInvalidSizer
+	}
+	if o.TTL < 0 {
+		return nil, ErrInvalidTTL
 	}
 
 	c := &BasicCache{
-		d:   timeout,
-		get: make(chan *getRequest, 100),
-		put: make(chan *putRequest, 100),
-		rm:  make(chan *removeRequest, 100),
-		len: make(chan *getLenRequest, 100),
+		o:    o,
+		done: make(chan struct{}),
+		get:  make(chan *getRequest, requestChannelSize),
+		one:  make(chan getOneRequest, requestChannelSize),
+		gex:  make(chan *getEntryRequest, requestChannelSize),
+		cas:  make(chan *putIfVersionRequest, requestChannelSize),
+		god:  make(chan *getOrDefaultRequest, requestChannelSize),
+		inc:  make(chan *incrementRequest, requestChannelSize),
+		upd:  make(chan *updateRequest, requestChannelSize),
+		has:  make(chan *containsRequest, requestChannelSize),
+		put:  make(chan *putRequest, requestChannelSize),
+		rm:   make(chan *removeRequest, requestChannelSize),
+		rmb:  make(chan *removeBatchRequest, requestChannelSize),
+		rmw:  make(chan *removeWhereRequest, requestChannelSize),
+		rsz:  make(chan *resizeRequest, requestChannelSize),
+		clr:  make(chan *clearRequest, requestChannelSize),
+		evc:  make(chan *evictRequest, requestChannelSize),
+		pin:  make(chan *pinRequest, requestChannelSize),
+		len:  make(chan *getLenRequest, requestChannelSize),
+		png:  make(chan *pingRequest, requestChannelSize),
+		itr:  make(chan *forEachRequest, requestChannelSize),
 	}
+	c.capacity.Store(int64(maxEntries))
+	c.setTimeout(timeout)
 
 	go func() {
-		cache := newCache(maxEntries)
+		if o.LockOSThread {
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+		}
+
+		sizeHint := 0
+		if o.PresizeMap && o.Weigher == nil {
+			sizeHint = maxEntries
+		}
+
+		cache := newCache(maxEntries, sizeHint)
+		cache.ttl = o.TTL
+		cache.sliding = o.SlidingExpiration
+		cache.panicked = o.panicked
+		cache.onEvict = o.OnEvict
+		cache.weigher = o.Weigher
+		cache.keyString = o.keyString
+		cache.evictBatch = max(0, o.EvictionBatchSize)
 
 		// Tidy up could take some time, so do this last
 		defer cache.clear()
 		// If exiting the routine, need to stop further requests
-		// so call Close as this writes to the chans
+		// so call Close to reject them
 		defer c.Close()
 
+		// evictMore is signalled whilst the cache exceeds its capacity, if EvictionBatchSize
+		// is set, so that the excess is evicted in batches interleaved with other requests
+		evictMore := make(chan struct{}, 1)
+		signalEvictMore := func() {
+			select {
+			case evictMore <- struct{}{}:
+			default:
+			}
+		}
+
+		// idle remains nil, and so never fires, if no IdleTimeout is set
+		var idle <-chan time.Time
+		var timer *time.Timer
+		if o.IdleTimeout > 0 {
+			timer = time.NewTimer(o.IdleTimeout)
+			defer timer.Stop()
+			idle = timer.C
+		}
+
 		for {
 			select {
 			case <-ctx.Done():
 				return
+			case <-c.done:
+				return
+			case <-idle:
+				return
+			case <-evictMore:
+				// A full batch indicates there may be more to evict, whilst a partial
+				// batch indicates that only pinned items remain
+				if len(cache.evictOverCapacity()) == cache.evictBatch {
+					signalEvictMore()
+				}
+				// Not an operation, so the idle period continues
+				continue
 			case r, ok := <-c.get:
 				if !ok {
 					return
 				}
-				resp := []*CacheResult{}
+				buf := getResults.Get().(*[]getOneResponse)
+				resp := (*buf)[:0]
 				for _, k := range r.keys {
 					v, ok := cache.get(k)
-					resp = append(resp, &CacheResult{
-						KeyVal: KeyVal{
-							Key:   k,
-							Value: v,
-						},
-						OK: ok,
-					})
+					resp = append(resp, getOneResponse{v: v, ok: ok})
+				}
+				*buf = resp
+				r.c <- buf
+			case r := <-c.one:
+				v, ok := cache.get(r.k)
+				r.c <- getOneResponse{v: v, ok: ok}
+			case r, ok := <-c.gex:
+				if !ok {
+					return
+				}
+				var e *entry
+				switch r.mode {
+				case lookupPeek:
+					e = cache.peek(r.k)
+				case lookupRaw:
+					e = cache.raw(r.k)
+				default:
+					e = cache.getEntry(r.k)
+				}
+				resp := &getEntryResponse{}
+				if e != nil {
+					resp.v, resp.expires, resp.version, resp.ok = e.value, e.expires, e.version, true
+					resp.inserted, resp.accessed, resp.hits = e.inserted, e.accessed, e.hits
+					resp.expired = e.expired(time.Now())
+				}
+				r.c <- resp
+			case r, ok := <-c.cas:
+				if !ok {
+					return
+				}
+				r.c <- cache.putIfVersion(r.k, r.v, r.expected)
+			case r, ok := <-c.god:
+				if !ok {
+					return
+				}
+				r.c <- cache.getOrPut(r.k, r.def)
+			case r, ok := <-c.inc:
+				if !ok {
+					return
+				}
+				n, err := cache.increment(r.k, r.delta)
+				r.c <- &incrementResponse{
+					n:   n,
+					err: err,
+				}
+			case r, ok := <-c.upd:
+				if !ok {
+					return
+				}
+				r.c <- update(cache, r.k, r.fn)
+			case r, ok := <-c.has:
+				if !ok {
+					return
+				}
+				resp := make([]bool, len(r.keys))
+				for i, k := range r.keys {
+					resp[i] = cache.contains(k)
 				}
 				r.c <- resp
 			case r, ok := <-c.len:
 				if !ok {
 					return
 				}
-				v := cache.len()
 				r.c <- &getLenResponse{
-					len: v,
+					len:      cache.len(),
+					weight:   cache.totalWeight(),
+					capacity: cache.capacity,
 				}
 			case r, ok := <-c.put:
 				if !ok {
 					return
 				}
-				cache.put(r.k, r.v)
+				for _, kv := range r.kvs {
+					if r.ttl > 0 {
+						cache.putWithTTL(kv.Key, kv.Value, r.ttl)
+					} else {
+						cache.put(kv.Key, kv.Value)
+					}
+				}
 				r.c <- struct{}{}
 			case r, ok := <-c.rm:
 				if !ok {
 					return
 				}
-				cache.remove(r.k)
+				r.c <- cache.remove(r.k)
+			case r, ok := <-c.rmb:
+				if !ok {
+					return
+				}
+				removed := make([]bool, len(r.keys))
+				for i, k := range r.keys {
+					removed[i] = cache.remove(k)
+				}
+				r.c <- removed
+			case r, ok := <-c.rmw:
+				if !ok {
+					return
+				}
+				r.c <- removeWhere(cache, r.pred)
+			case r, ok := <-c.rsz:
+				if !ok {
+					return
+				}
+				evicted, err := cache.resize(r.n)
+				if err == nil {
+					// Recorded here, so that Capacity is correct even if the caller has timed out
+					c.capacity.Store(int64(r.n))
+				}
+				r.c <- &resizeResponse{
+					evicted: evicted,
+					err:     err,
+				}
+			case r, ok := <-c.clr:
+				if !ok {
+					return
+				}
+				if r.drain {
+					r.c <- cache.drain()
+				} else {
+					r.c <- cache.removeAll()
+				}
+			case r, ok := <-c.evc:
+				if !ok {
+					return
+				}
+				r.c <- cache.evict(r.n)
+			case r, ok := <-c.pin:
+				if !ok {
+					return
+				}
+				r.c <- cache.setPinned(r.k, r.pin)
+			case r, ok := <-c.png:
+				if !ok {
+					return
+				}
 				r.c <- struct{}{}
+			case r, ok := <-c.itr:
+				if !ok {
+					return
+				}
+				r.c <- forEach(cache, r.fn)
+			}
+
+			if cache.evictBatch > 0 && cache.overCapacity() {
+				signalEvictMore()
+			}
+
+			// Restart the idle period after each operation
+			if timer != nil {
+				timer.Reset(o.IdleTimeout)
 			}
 		}
 	}()
 
 	return c, nil
 }
+
+// removeWhere ensures a panic in pred does not terminate the cache goroutine
+func removeWhere(cache *cache, pred func(key Key, value any) bool) (resp *removeWhereResponse) {
+	resp = &removeWhereResponse{}
+	defer func() {
+		if r := recover(); r != nil {
+			resp.err = fmt.Errorf("unexpected error: %v", r)
+			if cache.panicked != nil {
+				cache.panicked(r)
+			}
+		}
+	}()
+	resp.n = cache.removeWhere(pred)
+	return
+}
+
+// appendResult appends the result of the key to results, reusing the
+// CacheResult beyond the length of results if there is one
+func appendResult(results []*CacheResult, key Key, value any, ok bool) []*CacheResult {
+	if n := len(results); n < cap(results) {
+		if cr := results[:n+1][n]; cr != nil {
+			*cr = CacheResult{KeyVal: KeyVal{Key: key, Value: value}, OK: ok}
+			return results[:n+1]
+		}
+	}
+	return append(results, &CacheResult{KeyVal: KeyVal{Key: key, Value: value}, OK: ok})
+}
+
+// update ensures a panic in fn does not terminate the cache goroutine
+func update(cache *cache, key Key, fn func(value any, ok bool) (any, error)) (resp *updateResponse) {
+	resp = &updateResponse{}
+	defer func() {
+		if r := recover(); r != nil {
+			resp.err = fmt.Errorf("unexpected error: %v", r)
+			if cache.panicked != nil {
+				cache.panicked(r)
+			}
+		}
+	}()
+	resp.v, resp.err = cache.update(key, fn)
+	return
+}
+
+// forEach ensures a panic in fn does not terminate the cache goroutine
+func forEach(cache *cache, fn func(key Key, value any) bool) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("unexpected error: %v", r)
+			if cache.panicked != nil {
+				cache.panicked(r)
+			}
+		}
+	}()
+	cache.forEach(fn)
+	return nil
+}
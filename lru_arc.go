@@ -0,0 +1,439 @@
+package lru
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ARCCache provides a concurrency-safe implementation of a bounded
+// Adaptive Replacement Cache, which balances eviction between
+// recently used and frequently used entries based on the access pattern.
+type ARCCache struct {
+	privateImp
+	n   int
+	d   time.Duration
+	put chan *putRequest
+	get chan *getRequest
+	rm  chan *removeRequest
+	len chan *getLenRequest
+	// done is closed once Close has been called
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Close releases all resources associated with the cache.
+// Calling Close more than once is harmless.
+func (c *ARCCache) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+// Config returns the configuration of the cache
+func (c *ARCCache) Config() CacheConfig {
+	return CacheConfig{
+		Capacity:          c.n,
+		Timeout:           c.d,
+		Policy:            PolicyARC,
+		ChannelBufferSize: requestChannelSize,
+	}
+}
+
+// Get will retrieve the item with the specified key
+// into the cache, updating its status.
+// An error is raised if the Close() has been called, or
+// the timeoout for the operation is exceeded.
+func (c *ARCCache) Get(ctx context.Context, key Key) (v any, ok bool, err error) {
+	res, err := c.GetBatch(ctx, []Key{key})
+	if err != nil {
+		return nil, false, err
+	}
+	if len(res) == 0 {
+		return nil, false, ErrUnknown
+	}
+	return res[0].Value, res[0].OK, res[0].Err
+}
+
+const (
+	oTELARCCacheGetBatchStarted = "ARCCache.GetBatch started"
+	oTELARCCacheGetBatchEnded   = "ARCCache.GetBatch ended"
+	oTELARCCacheGetBatchError   = "ARCCache.GetBatch Retrieval Error"
+)
+
+// GetBatch retrieves all the provided keys, returning a CacheResult for each
+// one, which provides the details of the retrieval of the key
+func (c *ARCCache) GetBatch(ctx context.Context, keys []Key) (cr []*CacheResult, err error) {
+
+	select {
+	case <-ctx.Done():
+		return nil, ErrInvalidContext
+	default:
+	}
+
+	if len(keys) == 0 {
+		return []*CacheResult{}, nil
+	}
+
+	curSpan := trace.SpanFromContext(ctx)
+	defer func() {
+		if r := recover(); r != nil {
+			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
+				err = ErrAttemptToUseInvalidCache
+			} else {
+				err = fmt.Errorf("unexpected error: %v", r)
+			}
+			curSpan.AddEvent(oTELARCCacheGetBatchError, trace.WithTimestamp(time.Now().UTC()))
+			curSpan.SetStatus(codes.Error, err.Error())
+		} else {
+			curSpan.AddEvent(oTELARCCacheGetBatchEnded, trace.WithAttributes(attribute.Int("Retrieved", len(cr))), trace.WithTimestamp(time.Now().UTC()))
+		}
+	}()
+
+	curSpan.AddEvent(oTELARCCacheGetBatchStarted, trace.WithAttributes(attribute.Int("Requested", len(keys))), trace.WithTimestamp(time.Now().UTC()))
+
+	if err := checkKeys(keys...); err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *[]getOneResponse, 1)
+
+	req := &getRequest{
+		keys: keys,
+		c:    ch,
+	}
+
+	timeout := time.After(c.d)
+
+	select {
+	case <-ctx.Done():
+		return nil, ErrInvalidContext
+	case <-c.done:
+		return nil, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return nil, ErrTimeout
+	case c.get <- req:
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ErrInvalidContext
+	case <-c.done:
+		return nil, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return nil, ErrTimeout
+	case buf, ok := <-ch:
+		if !ok {
+			return nil, ErrUnknown
+		}
+		cr = make([]*CacheResult, 0, len(keys))
+		for i, r := range *buf {
+			cr = appendResult(cr, keys[i], r.v, r.ok)
+		}
+		clear(*buf)
+		getResults.Put(buf)
+		return cr, nil
+	}
+}
+
+// Len returns the number of items in the cache
+// An error is raised if the Close() has been called, or
+// the timeoout for the operation is exceeded.
+func (c *ARCCache) Len() (l int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
+				err = ErrAttemptToUseInvalidCache
+			} else {
+				// Something unexpected - report this
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+
+	ch := make(chan *getLenResponse, 1)
+
+	req := &getLenRequest{
+		c: ch,
+	}
+
+	timeout := time.After(c.d)
+
+	select {
+	case <-c.done:
+		return 0, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return 0, ErrTimeout
+	case c.len <- req:
+	}
+
+	select {
+	case <-c.done:
+		return 0, ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return 0, ErrTimeout
+	case r, ok := <-ch:
+		if !ok {
+			return 0, ErrUnknown
+		}
+		return r.len, nil
+	}
+}
+
+// Put will insert the item with the specified key
+// into the cache, replacing what was previously there (if anything).
+// An error is raised if the Close() has been called, or
+// the timeout for the operation is exceeded.
+func (c *ARCCache) Put(ctx context.Context, key Key, val any) (err error) {
+	return c.PutBatch(ctx, []KeyVal{{Key: key, Value: val}})
+}
+
+const (
+	oTELARCCachePutBatchStarted = "ARCCache.PutBatch started"
+	oTELARCCachePutBatchEnded   = "ARCCache.PutBatch ended"
+	oTELARCCachePutBatchError   = "ARCCache.PutBatch error"
+)
+
+// PutBatch will insert the items into the cache, replacing what was previously there (if anything).
+// If a key appears more than once in vals then the last value for that key is the one retained.
+// An error is raised if the Close() has been called, or the timeoout for the operation is exceeded.
+func (c *ARCCache) PutBatch(ctx context.Context, vals []KeyVal) (err error) {
+
+	select {
+	case <-ctx.Done():
+		return ErrInvalidContext
+	default:
+	}
+
+	if len(vals) == 0 {
+		return nil
+	}
+
+	var added = 0
+
+	curSpan := trace.SpanFromContext(ctx)
+	defer func() {
+		if r := recover(); r != nil {
+			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
+				err = ErrAttemptToUseInvalidCache
+			} else {
+				err = fmt.Errorf("unexpected error: %v", r)
+			}
+			curSpan.AddEvent(oTELARCCachePutBatchError, trace.WithTimestamp(time.Now().UTC()))
+			curSpan.SetStatus(codes.Error, err.Error())
+		} else {
+			curSpan.AddEvent(oTELARCCachePutBatchEnded, trace.WithAttributes(attribute.Int("Added", added)), trace.WithTimestamp(time.Now().UTC()))
+		}
+	}()
+
+	curSpan.AddEvent(oTELARCCachePutBatchStarted, trace.WithAttributes(attribute.Int("Requested", len(vals))), trace.WithTimestamp(time.Now().UTC()))
+
+	for _, v := range vals {
+		if v.Value == nil {
+			return ErrInvalidValueToAddToCache
+		}
+		if err := checkKeys(v.Key); err != nil {
+			return err
+		}
+	}
+
+	vals = dedupKeyVals(vals)
+
+	ch := make(chan struct{}, 1)
+
+	req := &putRequest{
+		kvs: vals,
+		c:   ch,
+	}
+
+	timeout := time.After(c.d)
+
+	select {
+	case <-ctx.Done():
+		return ErrInvalidContext
+	case <-c.done:
+		return ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return ErrTimeout
+	case c.put <- req:
+	}
+
+	select {
+	case <-ctx.Done():
+		return ErrInvalidContext
+	case <-c.done:
+		return ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return ErrTimeout
+	case _, ok := <-ch:
+		if !ok {
+			return ErrUnknown
+		}
+		added = len(vals)
+	}
+
+	return nil
+}
+
+// Remove will remove the item with the specified key
+// from the cache, ignoring if it does not exist.
+// An error is raised if the Close() has been called, or
+// the timeoout for the operation is exceeded.
+func (c *ARCCache) Remove(key Key) error {
+	return c.RemoveContext(context.Background(), key)
+}
+
+// RemoveContext is Remove, which is abandoned with ErrInvalidContext
+// should the context complete before the item is removed.
+func (c *ARCCache) RemoveContext(ctx context.Context, key Key) (err error) {
+
+	select {
+	case <-ctx.Done():
+		return ErrInvalidContext
+	default:
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if fmt.Sprintf("%v", r) == sendToClosedChanPanicMsg {
+				err = ErrAttemptToUseInvalidCache
+			} else {
+				// Something unexpected - report this
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+
+	if err := checkKeys(key); err != nil {
+		return err
+	}
+
+	ch := make(chan bool, 1)
+
+	req := &removeRequest{
+		k: key,
+		c: ch,
+	}
+
+	timeout := time.After(c.d)
+
+	select {
+	case <-ctx.Done():
+		return ErrInvalidContext
+	case <-c.done:
+		return ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return ErrTimeout
+	case c.rm <- req:
+	}
+
+	select {
+	case <-ctx.Done():
+		return ErrInvalidContext
+	case <-c.done:
+		return ErrAttemptToUseInvalidCache
+	case <-timeout:
+		return ErrTimeout
+	case _, ok := <-ch:
+		if !ok {
+			return ErrUnknown
+		}
+		return nil
+	}
+}
+
+var ErrInvalidARCMaxEntries = errors.New("maxEntries must be a positive integer for an ARC cache")
+
+// NewARCCache creates a new Adaptive Replacement Cache instance with the specified
+// capacity and timeout for request processing.
+// The capacity must be positive, and when reached a new addition will trigger the
+// eviction of either the least recently used entry that has been seen only once, or the
+// least recently used entry that has been seen more than once, depending on which of
+// these the recent access pattern suggests would be least harmful.
+// If timeout <= 0 then an infinite timeout is used (not recommended)
+// Close() should be called when the cache is no longer needed, to release resources
+func NewARCCache(ctx context.Context, maxEntries int, timeout time.Duration) (*ARCCache, error) {
+
+	select {
+	case <-ctx.Done():
+		return nil, ErrInvalidContext
+	default:
+	}
+
+	if maxEntries <= 0 {
+		return nil, ErrInvalidARCMaxEntries
+	}
+
+	if timeout <= 0 {
+		timeout = time.Duration(24 * time.Hour) // Effectively infinite
+	}
+
+	c := &ARCCache{
+		n:    maxEntries,
+		d:    timeout,
+		done: make(chan struct{}),
+		get:  make(chan *getRequest, requestChannelSize),
+		put:  make(chan *putRequest, requestChannelSize),
+		rm:   make(chan *removeRequest, requestChannelSize),
+		len:  make(chan *getLenRequest, requestChannelSize),
+	}
+
+	go func() {
+		cache := newARC(maxEntries)
+
+		// Tidy up could take some time, so do this last
+		defer cache.clear()
+		// If exiting the routine, need to stop further requests
+		// so call Close as this writes to the chans
+		defer c.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.done:
+				return
+			case r, ok := <-c.get:
+				if !ok {
+					return
+				}
+				buf := getResults.Get().(*[]getOneResponse)
+				resp := (*buf)[:0]
+				for _, k := range r.keys {
+					v, ok := cache.get(k)
+					resp = append(resp, getOneResponse{v: v, ok: ok})
+				}
+				*buf = resp
+				r.c <- buf
+			case r, ok := <-c.len:
+				if !ok {
+					return
+				}
+				r.c <- &getLenResponse{
+					len: cache.len(),
+				}
+			case r, ok := <-c.put:
+				if !ok {
+					return
+				}
+				for _, kv := range r.kvs {
+					cache.put(kv.Key, kv.Value)
+				}
+				r.c <- struct{}{}
+			case r, ok := <-c.rm:
+				if !ok {
+					return
+				}
+				r.c <- cache.remove(r.k)
+			}
+		}
+	}()
+
+	return c, nil
+}
@@ -0,0 +1,139 @@
+package lru
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestNewARCCache(t *testing.T) {
+	_, err := NewARCCache(context.Background(), 0, 0)
+
+	if !errors.Is(err, ErrInvalidARCMaxEntries) {
+		t.Fatalf("TestNewARCCache fail.  Expected error: %v, got error: %v", ErrInvalidARCMaxEntries, err)
+	}
+}
+
+func TestARCCache_Get(t *testing.T) {
+
+	ctx := context.Background()
+
+	for _, tt := range getTests {
+		lru, _ := NewARCCache(ctx, 10, 0)
+		defer lru.Close()
+
+		lru.Put(ctx, tt.keyToAdd, 1234)
+		val, ok, _ := lru.Get(context.Background(), tt.keyToGet)
+		if ok != tt.expectedOk {
+			t.Fatalf("TestARCCache_Get failed.  %s: cache hit = %v; want %v", tt.name, ok, !ok)
+		} else if ok && val != 1234 {
+			t.Fatalf("TestARCCache_Get failed.  %s expected get to return 1234 but got %v", tt.name, val)
+		}
+	}
+}
+
+func TestARCCache_Remove(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewARCCache(ctx, 10, 0)
+	defer lru.Close()
+
+	lru.Put(ctx, "myKey", 1234)
+	if _, ok, _ := lru.Get(ctx, "myKey"); !ok {
+		t.Fatal("TestARCCache_Remove returned no match")
+	}
+
+	lru.Remove("myKey")
+	if _, ok, _ := lru.Get(ctx, "myKey"); ok {
+		t.Fatal("TestARCCache_Remove returned a removed entry")
+	}
+	if val, _ := lru.Len(); val != 0 {
+		t.Fatalf("TestARCCache_Remove failed.  Expected Len = %d, got %v", 0, val)
+	}
+}
+
+func TestARCCache_RemoveThenPut(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewARCCache(ctx, 2, 0)
+	defer lru.Close()
+
+	lru.Put(ctx, "a", 1)
+	lru.Get(ctx, "a")
+	lru.Put(ctx, "b", 2)
+	lru.Put(ctx, "c", 3)
+	lru.Remove("a")
+	lru.Put(ctx, "d", 4)
+
+	// The remove left room for d, so no live entry is evicted
+	if val, _ := lru.Len(); val != 2 {
+		t.Fatalf("TestARCCache_RemoveThenPut failed.  Expected Len = %d, got %v", 2, val)
+	}
+	if _, ok, _ := lru.Get(ctx, "c"); !ok {
+		t.Fatal("TestARCCache_RemoveThenPut failed.  Expected c to be held")
+	}
+}
+
+func TestARCCache_Capacity(t *testing.T) {
+	ctx := context.Background()
+
+	maxSize := 100
+
+	lru, _ := NewARCCache(ctx, maxSize, 0)
+	defer lru.Close()
+
+	for i := 0; i < maxSize*5; i++ {
+		lru.Put(ctx, i, i)
+		if i%3 == 0 {
+			lru.Get(ctx, i/2)
+		}
+	}
+
+	if val, _ := lru.Len(); val != maxSize {
+		t.Fatalf("TestARCCache_Capacity failed.  Expected Len = %d, got %v", maxSize, val)
+	}
+}
+
+func TestARCCache_ScanResistance(t *testing.T) {
+	ctx := context.Background()
+
+	maxSize := 10
+
+	lru, _ := NewARCCache(ctx, maxSize, 0)
+	defer lru.Close()
+
+	// Establish a frequently used working set
+	hot := []Key{"hot_0", "hot_1", "hot_2", "hot_3", "hot_4"}
+	for _, k := range hot {
+		lru.Put(ctx, k, k)
+	}
+	for i := 0; i < 3; i++ {
+		for _, k := range hot {
+			lru.Get(ctx, k)
+		}
+	}
+
+	// A one-off scan of many keys should not displace the frequently used entries,
+	// as it would with a pure LRU policy
+	for i := 0; i < maxSize*10; i++ {
+		lru.Put(ctx, fmt.Sprintf("scan_%d", i), i)
+	}
+
+	for _, k := range hot {
+		if _, ok, _ := lru.Get(ctx, k); !ok {
+			t.Fatalf("TestARCCache_ScanResistance failed.  Expected %v to be retained", k)
+		}
+	}
+}
+
+func TestARCCache_Close(t *testing.T) {
+	lru, _ := NewARCCache(context.Background(), 10, 0)
+
+	lru.Close()
+	lru.Close()
+
+	if _, err := lru.Len(); !errors.Is(err, ErrAttemptToUseInvalidCache) {
+		t.Fatalf("TestARCCache_Close fail.  Expected error: %v, got error: %v", ErrAttemptToUseInvalidCache, err)
+	}
+}
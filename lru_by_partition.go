@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.opentelemetry.io/otel/attribute"
@@ -27,37 +29,107 @@ var ErrInvalidPartition = errors.New("partitioner returned unknown partition for
 // avoid eviction and improve responsiveness.
 type PartitionedCache struct {
 	privateImp
+	o           Options
 	partitioner Partitioner
 	partitions  map[Partition]Cache
+	closed      bool
 	lck         sync.RWMutex
+	// lastUsed records the sequence number of the most recent use of each partition
+	lastUsed map[Partition]*atomic.Int64
+	seq      atomic.Int64
 }
 
-func (p *PartitionedCache) getCacheForKey(key Key) (Cache, error) {
-	if len(p.partitions) == 0 {
-		return nil, ErrAttemptToUseInvalidCache
+// PartitionEvictionPolicy determines the partition from which entries are evicted,
+// when a PartitionedCache exceeds its GlobalMaxEntries
+type PartitionEvictionPolicy int
+
+const (
+	// EvictFromLargestPartition evicts from the partition holding the most entries
+	EvictFromLargestPartition PartitionEvictionPolicy = iota
+	// EvictFromLeastRecentlyUsedPartition evicts from the partition that was least recently used
+	EvictFromLeastRecentlyUsedPartition
+)
+
+// containser is implemented by caches that can report the presence of keys
+type containser interface {
+	ContainsBatch(keys []Key) (map[Key]bool, error)
+}
+
+// configurer is implemented by caches that can report their configuration
+type configurer interface {
+	Config() CacheConfig
+}
+
+// batchRemover is implemented by caches that can remove multiple keys at once
+type batchRemover interface {
+	RemoveBatch(keys []Key) (int, error)
+}
+
+// contextBatchRemover is implemented by caches whose batch removals are abandoned if their context completes
+type contextBatchRemover interface {
+	RemoveBatchContext(ctx context.Context, keys []Key) (int, error)
+}
+
+// snapshotter is implemented by caches that can copy their entries, from the most to least recently used
+type snapshotter interface {
+	Snapshot() ([]KeyVal, error)
+}
+
+// evicter is implemented by caches that support the removal of their least recently used entries
+type evicter interface {
+	Evict(n int) (int, error)
+}
+
+// touch records that the partition has been used
+func (p *PartitionedCache) touch(name Partition) {
+	if u, ok := p.lastUsed[name]; ok {
+		u.Store(p.seq.Add(1))
+	}
+}
+
+// partitionForKey resolves the partition of the key, and its Cache.
+// The caller must hold the lock.
+func (p *PartitionedCache) partitionForKey(key Key) (Partition, Cache, error) {
+	if p.closed || len(p.partitions) == 0 {
+		return "", nil, ErrAttemptToUseInvalidCache
 	}
 
 	part, err := p.partitioner(key)
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
 
-	p.lck.RLock()
-	defer p.lck.RUnlock()
-
 	c, ok := p.partitions[part]
 	if !ok {
-		return nil, ErrInvalidPartition
+		return "", nil, ErrInvalidPartition
 	}
 
-	return c, nil
+	return part, c, nil
 }
 
-// Close empties the cache, releases all resources
+// RouteKey returns the partition to which the key is routed by the Partitioner,
+// without performing any operation on the cache.  ErrInvalidPartition is returned
+// if the Partitioner routes the key to a partition that does not exist.
+func (p *PartitionedCache) RouteKey(key Key) (Partition, error) {
+	p.lck.RLock()
+	defer p.lck.RUnlock()
+
+	name, _, err := p.partitionForKey(key)
+	return name, err
+}
+
+// Close empties the cache, releases all resources.
+// Close waits for in-flight operations to complete, and
+// calling Close more than once is harmless.
 func (p *PartitionedCache) Close() {
 	p.lck.Lock()
 	defer p.lck.Unlock()
 
+	if p.closed {
+		return
+	}
+	p.closed = true
+
 	for _, c := range p.partitions {
 		c.Close()
 	}
@@ -80,9 +152,16 @@ const (
 	oTELPartitionedCacheGetBatchStarted = "PartitionedCache.GetBatch started"
 	oTELPartitionedCacheGetBatchEnded   = "PartitionedCache.GetBatch ended"
 	oTELPartitionedCacheGetBatchError   = "PartitionedCache.GetBatch Retrieval Error"
+	oTELPartitionedCacheGetBatchServed  = "PartitionedCache.GetBatch partition served"
+	oTELPartitionedCacheGetBatchSpan    = "PartitionedCache.GetBatch"
+	oTELPartitionedCachePutBatchSpan    = "PartitionedCache.PutBatch"
 )
 
-// GetBatch retrieves the values at the specified keys
+// GetBatch retrieves the values at the specified keys, returning
+// their results in the same order as keys.
+// If PartialResults is set and ctx completes before all partitions respond, the
+// results of the partitions that have responded are returned, with the other keys
+// reporting the returned error.
 func (p *PartitionedCache) GetBatch(ctx context.Context, keys []Key) (res []*CacheResult, err error) {
 
 	select {
@@ -91,18 +170,28 @@ func (p *PartitionedCache) GetBatch(ctx context.Context, keys []Key) (res []*Cac
 	default:
 	}
 
-	curSpan := trace.SpanFromContext(ctx)
+	if len(keys) == 0 {
+		return []*CacheResult{}, nil
+	}
+
+	ctx, curSpan, endSpan := startSpan(ctx, p.o, oTELPartitionedCacheGetBatchSpan)
+	defer endSpan()
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("unexpected error: %v", r)
-			curSpan.AddEvent(oTELPartitionedCacheGetBatchError, trace.WithTimestamp(time.Now().UTC()))
-			curSpan.SetStatus(codes.Error, err.Error())
-		} else {
+			p.o.panicked(r)
+			if curSpan != nil {
+				curSpan.AddEvent(oTELPartitionedCacheGetBatchError, trace.WithTimestamp(time.Now().UTC()))
+				curSpan.SetStatus(codes.Error, err.Error())
+			}
+		} else if curSpan != nil {
 			curSpan.AddEvent(oTELPartitionedCacheGetBatchEnded, trace.WithAttributes(attribute.Int("Retrieved", len(res))), trace.WithTimestamp(time.Now().UTC()))
 		}
 	}()
 
-	curSpan.AddEvent(oTELPartitionedCacheGetBatchStarted, trace.WithAttributes(attribute.Int("Requested", len(keys))), trace.WithTimestamp(time.Now().UTC()))
+	if curSpan != nil {
+		curSpan.AddEvent(oTELPartitionedCacheGetBatchStarted, trace.WithAttributes(attribute.Int("Requested", len(keys))), trace.WithTimestamp(time.Now().UTC()))
+	}
 
 	type resp struct {
 		result []*CacheResult
@@ -110,43 +199,53 @@ func (p *PartitionedCache) GetBatch(ctx context.Context, keys []Key) (res []*Cac
 	}
 
 	type process struct {
+		name Partition
 		c    Cache
 		keys []Key
-		ch   chan *resp
+		// idx holds the position of each of keys within the requested keys
+		idx []int
+		ch  chan *resp
 	}
 
+	// Holding the lock throughout prevents Close from completing whilst
+	// requests to the partitions are in flight
+	p.lck.RLock()
+	defer p.lck.RUnlock()
+
 	processes := []*process{}
-	defer func() {
-		for _, p := range processes {
-			close(p.ch)
-		}
-	}()
 
-	for _, key := range keys {
-		c, err := p.getCacheForKey(key)
+	for i, key := range keys {
+		name, c, err := p.partitionForKey(key)
 		if err != nil {
 			return nil, err
 		}
 		found := false
 		for _, p := range processes {
-			if p.c == c {
+			if p.name == name {
 				found = true
 				p.keys = append(p.keys, key)
+				p.idx = append(p.idx, i)
 				break
 			}
 		}
 		if !found {
 			processes = append(processes, &process{
+				name: name,
 				c:    c,
 				keys: []Key{key},
+				idx:  []int{i},
 				ch:   make(chan *resp, 1),
 			})
 		}
 	}
 
+	// Cancelled on return, so that partitions still processing a request can abandon it
+	gctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	for _, p := range processes {
 		go func(pp *process) {
-			result, err := pp.c.GetBatch(ctx, pp.keys)
+			result, err := pp.c.GetBatch(gctx, pp.keys)
 			pp.ch <- &resp{
 				result: result,
 				err:    err,
@@ -154,23 +253,153 @@ func (p *PartitionedCache) GetBatch(ctx context.Context, keys []Key) (res []*Cac
 		}(p)
 	}
 
-	res = []*CacheResult{}
-	for _, p := range processes {
-		r := <-p.ch
+	var timeout <-chan time.Time
+	if p.o.PartitionTimeout > 0 {
+		timer := time.NewTimer(p.o.PartitionTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	// All responses are gathered before checking for errors, so that no requests
+	// remain in flight when the lock is released, unless a partition fails to
+	// respond before the context completes or the PartitionTimeout is exceeded
+	resps := make([]*resp, len(processes))
+	partial := false
+gather:
+	for i, pp := range processes {
+		select {
+		case <-ctx.Done():
+			if !p.o.PartialResults {
+				return nil, ErrInvalidContext
+			}
+			// Responses that have already arrived are retained
+			partial = true
+			for j := i; j < len(processes); j++ {
+				select {
+				case resps[j] = <-processes[j].ch:
+				default:
+				}
+			}
+			break gather
+		case <-timeout:
+			return nil, ErrTimeout
+		case resps[i] = <-pp.ch:
+		}
+	}
+
+	var partialErr error
+	if partial {
+		partialErr = partialResultsError(ctx)
+	}
+
+	// Results are gathered into the positions of their keys, so that they align with keys
+	res = make([]*CacheResult, len(keys))
+	for _, pp := range processes {
+		p.touch(pp.name)
+	}
+	for i, p := range processes {
+		r := resps[i]
+		if partial && (r == nil || r.err != nil) {
+			for _, idx := range p.idx {
+				res[idx] = &CacheResult{KeyVal: KeyVal{Key: keys[idx]}, Err: partialErr}
+			}
+			continue
+		}
 		if r.err != nil {
 			return nil, r.err
 		}
-		res = append(res, r.result...)
+		if len(r.result) != len(p.keys) {
+			return nil, ErrUnknown
+		}
+		if curSpan != nil {
+			curSpan.AddEvent(oTELPartitionedCacheGetBatchServed, trace.WithAttributes(
+				attribute.String("Partition", string(p.name)),
+				attribute.Int("Requested", len(p.keys)),
+				attribute.Int("Retrieved", len(r.result))), trace.WithTimestamp(time.Now().UTC()))
+		}
+		for j, cr := range r.result {
+			res[p.idx[j]] = cr
+		}
+	}
+
+	if partial {
+		return res, partialErr
+	}
+
+	if p.o.PartitionLoader != nil {
+		if err := p.load(ctx, res); err != nil {
+			if p.o.PartialResults && ctx.Err() != nil {
+				partialErr = partialResultsError(ctx)
+				markUnresolved(res, partialErr)
+				return res, partialErr
+			}
+			return nil, err
+		}
 	}
 
 	return res, nil
 }
 
+// load invokes the PartitionLoader for the keys that were not found, updating their
+// results, and adds the loaded values to the partitions of their keys.
+// As for a LoadingCache, the values are added even if ctx is cancelled, and failures
+// to add them are ignored, as they only result in the keys being loaded again.
+// The caller must hold the lock.
+func (p *PartitionedCache) load(ctx context.Context, res []*CacheResult) error {
+	misses := []Key{}
+	for _, r := range res {
+		if r.Err == nil && !r.OK {
+			misses = append(misses, r.Key)
+		}
+	}
+	if len(misses) == 0 {
+		return nil
+	}
+
+	loadResp, err := p.o.PartitionLoader(ctx, misses)
+	if err != nil {
+		return err
+	}
+
+	toCache, err := mergeLoaderResults(res, loadResp)
+	if err != nil {
+		return err
+	}
+
+	routed := map[Partition][]KeyVal{}
+	for _, kv := range toCache {
+		name, _, err := p.partitionForKey(kv.Key)
+		if err != nil {
+			continue
+		}
+		routed[name] = append(routed[name], kv)
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	for name, vals := range routed {
+		p.touch(name)
+		p.partitions[name].PutBatch(ctx, vals)
+	}
+	p.enforceGlobalMaxEntries()
+
+	return nil
+}
+
 // Len returns the current usage of the cache
 func (p *PartitionedCache) Len() (l int, err error) {
 	p.lck.RLock()
 	defer p.lck.RUnlock()
 
+	return p.len()
+}
+
+// len returns the total usage across the partitions.
+// The caller must hold the lock.
+func (p *PartitionedCache) len() (int, error) {
+	if p.closed {
+		return 0, ErrAttemptToUseInvalidCache
+	}
+
 	total := 0
 
 	for _, c := range p.partitions {
@@ -184,24 +413,392 @@ func (p *PartitionedCache) Len() (l int, err error) {
 	return total, nil
 }
 
+// selectPartitionToEvict returns the partition from which to evict, according to the
+// GlobalEvictionPolicy, ignoring any partitions in exclude.
+// The caller must hold the lock.
+func (p *PartitionedCache) selectPartitionToEvict(exclude map[Partition]bool) (Partition, bool) {
+	var selected Partition
+	found := false
+	var best int64
+
+	for name, c := range p.partitions {
+		if exclude[name] {
+			continue
+		}
+		l, err := c.Len()
+		if err != nil || l == 0 {
+			continue
+		}
+
+		var score int64
+		switch p.o.GlobalEvictionPolicy {
+		case EvictFromLeastRecentlyUsedPartition:
+			score = -p.lastUsed[name].Load()
+		default:
+			score = int64(l)
+		}
+
+		if !found || score > best {
+			selected, best, found = name, score, true
+		}
+	}
+
+	return selected, found
+}
+
+// enforceGlobalMaxEntries evicts entries from the partitions, according to the
+// GlobalEvictionPolicy, until the total usage is within GlobalMaxEntries.
+// The caller must hold the lock.
+func (p *PartitionedCache) enforceGlobalMaxEntries() error {
+	if p.o.GlobalMaxEntries <= 0 {
+		return nil
+	}
+
+	exclude := map[Partition]bool{}
+	for {
+		total, err := p.len()
+		if err != nil {
+			return err
+		}
+		if total <= p.o.GlobalMaxEntries {
+			return nil
+		}
+
+		name, ok := p.selectPartitionToEvict(exclude)
+		if !ok {
+			return nil
+		}
+
+		n, err := p.partitions[name].(evicter).Evict(total - p.o.GlobalMaxEntries)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			exclude[name] = true
+		}
+	}
+}
+
+// Config returns the configuration of the cache, with its Capacity being the
+// GlobalMaxEntries, and the configuration of each partition that can report it
+func (p *PartitionedCache) Config() CacheConfig {
+	p.lck.RLock()
+	defer p.lck.RUnlock()
+
+	cfg := CacheConfig{
+		Capacity:   p.o.GlobalMaxEntries,
+		Timeout:    p.o.PartitionTimeout,
+		Policy:     PolicyPartitioned,
+		Partitions: map[Partition]CacheConfig{},
+	}
+	for name, c := range p.partitions {
+		if cc, ok := c.(configurer); ok {
+			cfg.Partitions[name] = cc.Config()
+		}
+	}
+	return cfg
+}
+
+// Partitions returns the names of the partitions of the cache, in sorted order.
+// No partitions are returned once the Close() has been called.
+func (p *PartitionedCache) Partitions() []Partition {
+	p.lck.RLock()
+	defer p.lck.RUnlock()
+
+	names := make([]Partition, 0, len(p.partitions))
+	for name := range p.partitions {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+var ErrNotSupported = errors.New("operation is not supported by the cache of a partition")
+
+// ContainsBatch reports whether each of the keys is held in the cache, routing the keys
+// to their partitions, and without updating their lru status.
+// All partitions must support ContainsBatch.
+func (p *PartitionedCache) ContainsBatch(keys []Key) (map[Key]bool, error) {
+	p.lck.RLock()
+	defer p.lck.RUnlock()
+
+	routed := map[Partition][]Key{}
+	for _, key := range keys {
+		name, _, err := p.partitionForKey(key)
+		if err != nil {
+			return nil, err
+		}
+		routed[name] = append(routed[name], key)
+	}
+
+	m := make(map[Key]bool, len(keys))
+	for name, pkeys := range routed {
+		c, ok := p.partitions[name].(containser)
+		if !ok {
+			return nil, ErrNotSupported
+		}
+		res, err := c.ContainsBatch(pkeys)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range res {
+			m[k] = v
+		}
+	}
+
+	return m, nil
+}
+
 // Put inserts the value at the specified key, replacing any prior content
 func (p *PartitionedCache) Put(ctx context.Context, key Key, val any) (err error) {
-	c, err := p.getCacheForKey(key)
+	p.lck.RLock()
+	defer p.lck.RUnlock()
+
+	name, c, err := p.partitionForKey(key)
 	if err != nil {
 		return err
 	}
 
-	return c.Put(ctx, key, val)
+	p.touch(name)
+	if err := c.Put(ctx, key, val); err != nil {
+		return err
+	}
+
+	return p.enforceGlobalMaxEntries()
+}
+
+// PutBatch inserts the values at their keys, replacing any prior content, routing
+// each to the partition of its key.  If any key cannot be routed to a partition then
+// no values are inserted.  Failures of partitions do not prevent the values of
+// the others from being inserted, and are reported together in the returned error.
+func (p *PartitionedCache) PutBatch(ctx context.Context, vals []KeyVal) error {
+	select {
+	case <-ctx.Done():
+		return ErrInvalidContext
+	default:
+	}
+
+	ctx, _, endSpan := startSpan(ctx, p.o, oTELPartitionedCachePutBatchSpan)
+	defer endSpan()
+
+	p.lck.RLock()
+	defer p.lck.RUnlock()
+
+	routed := map[Partition][]KeyVal{}
+	for _, kv := range vals {
+		name, _, err := p.partitionForKey(kv.Key)
+		if err != nil {
+			return err
+		}
+		routed[name] = append(routed[name], kv)
+	}
+
+	var errs []error
+	for name, pvals := range routed {
+		p.touch(name)
+		if err := p.partitions[name].PutBatch(ctx, pvals); err != nil {
+			errs = append(errs, fmt.Errorf("partition %v: %w", name, err))
+		}
+	}
+	errs = append(errs, p.enforceGlobalMaxEntries())
+
+	return errors.Join(errs...)
 }
 
 // Remove evicts the key and its associated value
-func (p *PartitionedCache) Remove(key Key) (err error) {
-	c, err := p.getCacheForKey(key)
+func (p *PartitionedCache) Remove(key Key) error {
+	return p.RemoveContext(context.Background(), key)
+}
+
+// RemoveContext is Remove, which is abandoned with ErrInvalidContext
+// should the context complete before the key is removed.
+func (p *PartitionedCache) RemoveContext(ctx context.Context, key Key) (err error) {
+	p.lck.RLock()
+	defer p.lck.RUnlock()
+
+	_, c, err := p.partitionForKey(key)
 	if err != nil {
 		return err
 	}
 
-	return c.Remove(key)
+	return c.RemoveContext(ctx, key)
+}
+
+// RemoveBatch evicts the keys and their associated values, routing the keys to their
+// partitions, which are processed concurrently, and returns the number of keys removed
+// from each partition.  Failures of individual keys or partitions do not prevent the
+// others from being removed, and are reported together in the returned error;
+// ErrInvalidPartition for keys routed to an unknown partition, and ErrNotSupported
+// for partitions that do not support RemoveBatch.
+func (p *PartitionedCache) RemoveBatch(keys []Key) (map[Partition]int, error) {
+	return p.RemoveBatchContext(context.Background(), keys)
+}
+
+// RemoveBatchContext is RemoveBatch, in which partitions that support RemoveBatchContext
+// abandon their removals with ErrInvalidContext should the context complete first.
+func (p *PartitionedCache) RemoveBatchContext(ctx context.Context, keys []Key) (map[Partition]int, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ErrInvalidContext
+	default:
+	}
+
+	p.lck.RLock()
+	defer p.lck.RUnlock()
+
+	if p.closed || len(p.partitions) == 0 {
+		return nil, ErrAttemptToUseInvalidCache
+	}
+
+	var errs []error
+	routed := map[Partition][]Key{}
+	for _, key := range keys {
+		name, _, err := p.partitionForKey(key)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("key %s: %w", p.o.keyString(key), err))
+			continue
+		}
+		routed[name] = append(routed[name], key)
+	}
+
+	var lck sync.Mutex
+	var wg sync.WaitGroup
+	counts := map[Partition]int{}
+	for name, pkeys := range routed {
+		var remove func(keys []Key) (int, error)
+		switch c := p.partitions[name].(type) {
+		case contextBatchRemover:
+			remove = func(keys []Key) (int, error) { return c.RemoveBatchContext(ctx, keys) }
+		case batchRemover:
+			remove = c.RemoveBatch
+		default:
+			lck.Lock()
+			errs = append(errs, fmt.Errorf("partition %v: %w", name, ErrNotSupported))
+			lck.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(name Partition, remove func(keys []Key) (int, error), keys []Key) {
+			defer wg.Done()
+			n, err := remove(keys)
+
+			lck.Lock()
+			defer lck.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("partition %v: %w", name, err))
+				return
+			}
+			counts[name] = n
+		}(name, remove, pkeys)
+	}
+	wg.Wait()
+
+	return counts, errors.Join(errs...)
+}
+
+// Rebalance replaces the partitioner of the cache, moving every entry whose partition
+// is changed by newPartitioner into its new partition, so that the entries remain
+// reachable.  Moved entries are added with the default TTL of their new partition,
+// in their lru order, and are removed from their old partition only once they have
+// been added to the new one; entries that cannot be added remain in their old
+// partition, and the errors are returned.  Entries for which newPartitioner returns
+// an error or an unknown partition are removed, and reported together in the returned
+// error, with ErrInvalidPartition for the latter; the new partitioner is applied regardless.
+// All other operations are blocked whilst the entries are moved.
+// All partitions must support Snapshot, otherwise ErrNotSupported is returned and
+// the cache is unchanged.
+func (p *PartitionedCache) Rebalance(ctx context.Context, newPartitioner Partitioner) error {
+	if newPartitioner == nil {
+		return ErrInvalidPartitioner
+	}
+
+	p.lck.Lock()
+	defer p.lck.Unlock()
+
+	if p.closed || len(p.partitions) == 0 {
+		return ErrAttemptToUseInvalidCache
+	}
+
+	snapshotters := map[Partition]snapshotter{}
+	for name, c := range p.partitions {
+		s, ok := c.(snapshotter)
+		if !ok {
+			return fmt.Errorf("partition %v: %w", name, ErrNotSupported)
+		}
+		snapshotters[name] = s
+	}
+
+	// move holds the entries of a partition that belong in another
+	type move struct {
+		from Partition
+		vals []KeyVal
+	}
+
+	var errs []error
+	dropped := map[Partition][]Key{}
+	moves := map[Partition][]move{}
+	for name, s := range snapshotters {
+		vals, err := s.Snapshot()
+		if err != nil {
+			return fmt.Errorf("partition %v: %w", name, err)
+		}
+
+		added := map[Partition][]KeyVal{}
+		for _, kv := range vals {
+			part, err := newPartitioner(kv.Key)
+			if err == nil {
+				if _, ok := p.partitions[part]; !ok {
+					err = ErrInvalidPartition
+				}
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("key %s: %w", p.o.keyString(kv.Key), err))
+				dropped[name] = append(dropped[name], kv.Key)
+				continue
+			}
+			if part != name {
+				added[part] = append(added[part], kv)
+			}
+		}
+		for part, vals := range added {
+			// Snapshot provides the most recently used first, so reverse to retain the lru order
+			slices.Reverse(vals)
+			moves[part] = append(moves[part], move{from: name, vals: vals})
+		}
+	}
+
+	// Entries are removed from their old partition only once added to the new one
+	remove := dropped
+	for part, ms := range moves {
+		for _, m := range ms {
+			if err := p.partitions[part].PutBatch(ctx, m.vals); err != nil {
+				errs = append(errs, fmt.Errorf("partition %v: %w", part, err))
+				continue
+			}
+			for _, kv := range m.vals {
+				remove[m.from] = append(remove[m.from], kv.Key)
+			}
+		}
+	}
+
+	for name, keys := range remove {
+		c := p.partitions[name]
+		if r, ok := c.(batchRemover); ok {
+			if _, err := r.RemoveBatch(keys); err != nil {
+				errs = append(errs, fmt.Errorf("partition %v: %w", name, err))
+			}
+			continue
+		}
+		for _, key := range keys {
+			if err := c.Remove(key); err != nil {
+				errs = append(errs, fmt.Errorf("key %s: %w", p.o.keyString(key), err))
+			}
+		}
+	}
+
+	p.partitioner = newPartitioner
+
+	return errors.Join(errs...)
 }
 
 // PartitionInfo specifies the Cache to be used for a given Named partition
@@ -214,12 +811,14 @@ var ErrInvalidPartitioner = errors.New("partitioner must not be nil")
 var ErrInvalidPartitionInfo = errors.New("caches must not be an empty slice")
 var ErrPartitionWithNoCache = errors.New("all partitions must have a non-nil cache")
 var ErrPartitionInfoHasDuplicates = errors.New("partitions must have unique names")
+var ErrPartitionCannotEvict = errors.New("all partitions must support Evict when a global maximum is specified")
 
 // NewPartitionedCache creates a new LRU cache instance consisting of named partitions,
 // each of whose data is managed within the provided Cache instance.  The provided Cache
 // instances are assumed to be owned by the PartitionedCache instance once they are added.
+// Additional behaviour can be configured using opts.
 // Close() should be called when the cache is no longer needed, to release resources.
-func NewPartitionedCache(ctx context.Context, partitioner Partitioner, caches []PartitionInfo) (*PartitionedCache, error) {
+func NewPartitionedCache(ctx context.Context, partitioner Partitioner, caches []PartitionInfo, opts ...Option) (*PartitionedCache, error) {
 
 	if partitioner == nil {
 		return nil, ErrInvalidPartitioner
@@ -229,7 +828,10 @@ func NewPartitionedCache(ctx context.Context, partitioner Partitioner, caches []
 		return nil, ErrInvalidPartitionInfo
 	}
 
+	o := newOptions(opts)
+
 	m := map[Partition]Cache{}
+	lastUsed := map[Partition]*atomic.Int64{}
 	for _, i := range caches {
 		if i.Cache == nil {
 			return nil, ErrPartitionWithNoCache
@@ -237,11 +839,17 @@ func NewPartitionedCache(ctx context.Context, partitioner Partitioner, caches []
 		if _, ok := m[i.Name]; ok {
 			return nil, ErrPartitionInfoHasDuplicates
 		}
+		if _, ok := i.Cache.(evicter); !ok && o.GlobalMaxEntries > 0 {
+			return nil, ErrPartitionCannotEvict
+		}
 		m[i.Name] = i.Cache
+		lastUsed[i.Name] = &atomic.Int64{}
 	}
 
 	return &PartitionedCache{
+		o:           o,
 		partitioner: partitioner,
 		partitions:  m,
+		lastUsed:    lastUsed,
 	}, nil
 }
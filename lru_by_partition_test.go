@@ -0,0 +1,494 @@
+package lru
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestPartitionedCache returns a PartitionedCache with partitions "A" and "B",
+// with keys routed by the first character of their string value
+func newTestPartitionedCache(t *testing.T) *PartitionedCache {
+	ctx := context.Background()
+
+	partitioner := func(key Key) (Partition, error) {
+		s, ok := key.(string)
+		if !ok || len(s) == 0 {
+			return "", fmt.Errorf("unexpected key %v", key)
+		}
+		return Partition(s[:1]), nil
+	}
+
+	a, _ := NewBasicCache(ctx, 0, 0)
+	b, _ := NewBasicCache(ctx, 0, 0)
+
+	cache, err := NewPartitionedCache(ctx, partitioner, []PartitionInfo{{Name: "A", Cache: a}, {Name: "B", Cache: b}})
+	if err != nil {
+		t.Fatalf("unexpected error creating PartitionedCache: %v", err)
+	}
+	return cache
+}
+
+func TestPartitionedCache_Close(t *testing.T) {
+	cache := newTestPartitionedCache(t)
+
+	// Calling Close() more than once is harmless
+	cache.Close()
+	cache.Close()
+
+	if _, _, err := cache.Get(context.Background(), "A1"); !errors.Is(err, ErrAttemptToUseInvalidCache) {
+		t.Fatalf("TestPartitionedCache_Close fail.  Expected error: %v, got error: %v", ErrAttemptToUseInvalidCache, err)
+	}
+	if _, err := cache.Len(); !errors.Is(err, ErrAttemptToUseInvalidCache) {
+		t.Fatalf("TestPartitionedCache_Close fail.  Expected error: %v, got error: %v", ErrAttemptToUseInvalidCache, err)
+	}
+}
+
+func TestPartitionedCache_Close_1(t *testing.T) {
+	ctx := context.Background()
+
+	cache := newTestPartitionedCache(t)
+
+	cache.Put(ctx, "A1", 1)
+	cache.Put(ctx, "B1", 2)
+
+	// Close concurrently with Gets, which should either succeed or report the cache is closed
+	var wg sync.WaitGroup
+	errs := make(chan error, 200)
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := cache.GetBatch(ctx, []Key{"A1", "B1"})
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			cache.Close()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil && !errors.Is(err, ErrAttemptToUseInvalidCache) {
+			t.Fatalf("TestPartitionedCache_Close_1 fail.  Unexpected error: %v", err)
+		}
+	}
+}
+
+func TestPartitionedCache_GlobalMaxEntries(t *testing.T) {
+	ctx := context.Background()
+
+	partitioner := func(key Key) (Partition, error) {
+		return Partition(key.(string)[:1]), nil
+	}
+
+	a, _ := NewBasicCache(ctx, 0, 0)
+	b, _ := NewBasicCache(ctx, 0, 0)
+
+	cache, _ := NewPartitionedCache(ctx, partitioner, []PartitionInfo{{Name: "A", Cache: a}, {Name: "B", Cache: b}},
+		WithGlobalMaxEntries(5, EvictFromLargestPartition))
+	defer cache.Close()
+
+	for i := 0; i < 5; i++ {
+		cache.Put(ctx, fmt.Sprintf("A%d", i), i)
+	}
+	for i := 0; i < 2; i++ {
+		cache.Put(ctx, fmt.Sprintf("B%d", i), i)
+	}
+
+	if l, _ := cache.Len(); l != 5 {
+		t.Fatalf("TestPartitionedCache_GlobalMaxEntries failed.  Expected Len = 5, got %v", l)
+	}
+	if l, _ := b.Len(); l != 2 {
+		t.Fatalf("TestPartitionedCache_GlobalMaxEntries failed.  Expected B to be unaffected, got Len = %v", l)
+	}
+	if _, ok, _ := cache.Get(ctx, "A0"); ok {
+		t.Fatal("TestPartitionedCache_GlobalMaxEntries failed.  Expected A0 to be evicted")
+	}
+}
+
+func TestPartitionedCache_GlobalMaxEntries_1(t *testing.T) {
+	ctx := context.Background()
+
+	partitioner := func(key Key) (Partition, error) {
+		return Partition(key.(string)[:1]), nil
+	}
+
+	a, _ := NewBasicCache(ctx, 0, 0)
+	b, _ := NewBasicCache(ctx, 0, 0)
+
+	cache, _ := NewPartitionedCache(ctx, partitioner, []PartitionInfo{{Name: "A", Cache: a}, {Name: "B", Cache: b}},
+		WithGlobalMaxEntries(4, EvictFromLeastRecentlyUsedPartition))
+	defer cache.Close()
+
+	cache.Put(ctx, "A1", 1)
+	cache.Put(ctx, "B1", 1)
+	cache.Put(ctx, "B2", 1)
+	cache.Put(ctx, "A2", 1) // A is now most recently used
+	cache.Put(ctx, "A3", 1) // Exceeds limit, B is least recently used
+
+	if l, _ := b.Len(); l != 1 {
+		t.Fatalf("TestPartitionedCache_GlobalMaxEntries_1 failed.  Expected eviction from B, got Len = %v", l)
+	}
+	if l, _ := a.Len(); l != 3 {
+		t.Fatalf("TestPartitionedCache_GlobalMaxEntries_1 failed.  Expected A to be unaffected, got Len = %v", l)
+	}
+
+	arc, _ := NewARCCache(ctx, 10, 0)
+	defer arc.Close()
+	_, err := NewPartitionedCache(ctx, partitioner, []PartitionInfo{{Name: "A", Cache: arc}}, WithGlobalMaxEntries(4, EvictFromLargestPartition))
+	if !errors.Is(err, ErrPartitionCannotEvict) {
+		t.Fatalf("TestPartitionedCache_GlobalMaxEntries_1 failed.  Expected error: %v, got error: %v", ErrPartitionCannotEvict, err)
+	}
+}
+
+func TestPartitionedCache_ContainsBatch(t *testing.T) {
+	ctx := context.Background()
+
+	cache := newTestPartitionedCache(t)
+	defer cache.Close()
+
+	cache.Put(ctx, "A1", 1)
+	cache.Put(ctx, "B1", 2)
+
+	m, err := cache.ContainsBatch([]Key{"A1", "A2", "B1", "B2"})
+	if err != nil {
+		t.Fatalf("TestPartitionedCache_ContainsBatch failed.  Expected success, but got error %v", err)
+	}
+	if !m["A1"] || m["A2"] || !m["B1"] || m["B2"] {
+		t.Fatalf("TestPartitionedCache_ContainsBatch failed.  Unexpected result %v", m)
+	}
+}
+
+func TestPartitionedCache_GetBatchOrder(t *testing.T) {
+	ctx := context.Background()
+
+	cache := newTestPartitionedCache(t)
+	defer cache.Close()
+
+	keys := []Key{"A1", "B1", "A2", "B2", "A3"}
+	for _, k := range keys {
+		cache.Put(ctx, k, k)
+	}
+
+	res, err := cache.GetBatch(ctx, keys)
+	if err != nil {
+		t.Fatalf("TestPartitionedCache_GetBatchOrder fail.  Expected success, but got error %v", err)
+	}
+	for i, r := range res {
+		if r.Key != keys[i] || r.Value != keys[i] {
+			t.Fatalf("TestPartitionedCache_GetBatchOrder fail.  Expected %v at position %d, got %v", keys[i], i, r.Key)
+		}
+	}
+}
+
+// slowCache is a Cache whose GetBatch does not respond until its context completes
+type slowCache struct {
+	*BasicCache
+}
+
+func (s *slowCache) GetBatch(ctx context.Context, keys []Key) ([]*CacheResult, error) {
+	<-ctx.Done()
+	return nil, ErrInvalidContext
+}
+
+func TestPartitionedCache_SlowPartition(t *testing.T) {
+	ctx := context.Background()
+
+	partitioner := func(key Key) (Partition, error) {
+		return Partition(key.(string)[:1]), nil
+	}
+
+	a, _ := NewBasicCache(ctx, 0, 0)
+	b, _ := NewBasicCache(ctx, 0, 0)
+
+	cache, _ := NewPartitionedCache(ctx, partitioner,
+		[]PartitionInfo{{Name: "A", Cache: a}, {Name: "B", Cache: &slowCache{BasicCache: b}}},
+		WithPartitionTimeout(20*time.Millisecond))
+	defer cache.Close()
+
+	start := time.Now()
+	if _, err := cache.GetBatch(ctx, []Key{"A1", "B1"}); err != ErrTimeout {
+		t.Fatalf("TestPartitionedCache_SlowPartition fail.  Expected error: %v, got error: %v", ErrTimeout, err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("TestPartitionedCache_SlowPartition fail.  Expected prompt timeout, took %v", d)
+	}
+
+	// Partitions that respond are unaffected
+	if _, err := cache.GetBatch(ctx, []Key{"A1"}); err != nil {
+		t.Fatalf("TestPartitionedCache_SlowPartition fail.  Expected success, but got error %v", err)
+	}
+}
+
+func TestPartitionedCache_Config(t *testing.T) {
+	cache := newTestPartitionedCache(t)
+	defer cache.Close()
+
+	cfg := cache.Config()
+	if cfg.Policy != PolicyPartitioned || len(cfg.Partitions) != 2 || cfg.Partitions["A"].Policy != PolicyLRU {
+		t.Fatalf("TestPartitionedCache_Config fail.  Unexpected config %+v", cfg)
+	}
+}
+
+func TestPartitionedCache_RemoveBatch(t *testing.T) {
+	ctx := context.Background()
+
+	cache := newTestPartitionedCache(t)
+	defer cache.Close()
+
+	for _, k := range []string{"A1", "A2", "A3", "B1"} {
+		cache.Put(ctx, k, k)
+	}
+
+	counts, err := cache.RemoveBatch([]Key{"A1", "A2", "A9", "B1", "C1"})
+	if !errors.Is(err, ErrInvalidPartition) {
+		t.Fatalf("TestPartitionedCache_RemoveBatch fail.  Expected error: %v, got error: %v", ErrInvalidPartition, err)
+	}
+	if counts["A"] != 2 || counts["B"] != 1 {
+		t.Fatalf("TestPartitionedCache_RemoveBatch fail.  Expected A = 2 and B = 1, got %v", counts)
+	}
+
+	if l, _ := cache.Len(); l != 1 {
+		t.Fatalf("TestPartitionedCache_RemoveBatch fail.  Expected Len = 1, got %v", l)
+	}
+}
+
+func TestPartitionedCache_Rebalance(t *testing.T) {
+	ctx := context.Background()
+
+	cache := newTestPartitionedCache(t)
+	defer cache.Close()
+
+	for _, k := range []string{"A1", "A2", "B1", "B2", "AX"} {
+		cache.Put(ctx, k, k)
+	}
+
+	// Route by the last character of the key instead
+	err := cache.Rebalance(ctx, func(key Key) (Partition, error) {
+		s := key.(string)
+		switch s[len(s)-1:] {
+		case "1":
+			return "A", nil
+		case "2":
+			return "B", nil
+		}
+		return "C", nil
+	})
+	if !errors.Is(err, ErrInvalidPartition) {
+		t.Fatalf("TestPartitionedCache_Rebalance fail.  Expected error: %v, got error: %v", ErrInvalidPartition, err)
+	}
+
+	for _, k := range []string{"A1", "A2", "B1", "B2"} {
+		if v, ok, _ := cache.Get(ctx, k); !ok || v != k {
+			t.Fatalf("TestPartitionedCache_Rebalance fail.  Expected %v, got %v, %v", k, v, ok)
+		}
+	}
+	if l, _ := cache.Len(); l != 4 {
+		t.Fatalf("TestPartitionedCache_Rebalance fail.  Expected AX to be dropped, got Len = %v", l)
+	}
+
+	for name, keys := range map[Partition][]Key{"A": {"A1", "B1"}, "B": {"A2", "B2"}} {
+		m, _ := cache.partitions[name].(*BasicCache).ContainsBatch(keys)
+		if !m[keys[0]] || !m[keys[1]] {
+			t.Fatalf("TestPartitionedCache_Rebalance fail.  Expected partition %v to hold %v, got %v", name, keys, m)
+		}
+	}
+
+	if err := cache.Rebalance(ctx, nil); err != ErrInvalidPartitioner {
+		t.Fatalf("TestPartitionedCache_Rebalance fail.  Expected error: %v, got error: %v", ErrInvalidPartitioner, err)
+	}
+}
+
+func TestPartitionedCache_RebalancePutFails(t *testing.T) {
+	ctx := context.Background()
+
+	partitioner := func(key Key) (Partition, error) {
+		return Partition(key.(string)[:1]), nil
+	}
+
+	sizer := func(v any) int64 { return int64(v.(int)) }
+	a, _ := NewBasicCache(ctx, 0, 0)
+	b, _ := NewBasicCache(ctx, 0, 0, WithMaxValueSize(10, sizer))
+
+	cache, _ := NewPartitionedCache(ctx, partitioner, []PartitionInfo{{Name: "A", Cache: a}, {Name: "B", Cache: b}})
+	defer cache.Close()
+
+	cache.Put(ctx, "A1", 100)
+
+	// Everything is moved to B, which rejects the value as too large
+	err := cache.Rebalance(ctx, func(key Key) (Partition, error) { return "B", nil })
+	if !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("TestPartitionedCache_RebalancePutFails fail.  Expected error: %v, got error: %v", ErrValueTooLarge, err)
+	}
+
+	// The entry is retained by its old partition, rather than lost
+	if ok, _ := a.Contains("A1"); !ok {
+		t.Fatal("TestPartitionedCache_RebalancePutFails fail.  Expected A1 to remain in partition A")
+	}
+}
+
+func TestPartitionedCache_Partitions(t *testing.T) {
+	cache := newTestPartitionedCache(t)
+
+	if names := cache.Partitions(); len(names) != 2 || names[0] != "A" || names[1] != "B" {
+		t.Fatalf("TestPartitionedCache_Partitions fail.  Expected [A B], got %v", names)
+	}
+
+	cache.Close()
+
+	if names := cache.Partitions(); len(names) != 0 {
+		t.Fatalf("TestPartitionedCache_Partitions fail.  Expected no partitions after Close, got %v", names)
+	}
+}
+
+func TestPartitionedCache_PartitionLoader(t *testing.T) {
+	ctx := context.Background()
+
+	calls := 0
+	loader := func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		calls++
+		res := []LoaderResult{}
+		for _, k := range keys {
+			if k == "B9" {
+				continue // Not found
+			}
+			res = append(res, LoaderResult{Key: k, Value: "loaded " + k.(string)})
+		}
+		return res, nil
+	}
+
+	partitioner := func(key Key) (Partition, error) {
+		return Partition(key.(string)[:1]), nil
+	}
+	a, _ := NewBasicCache(ctx, 0, 0)
+	b, _ := NewBasicCache(ctx, 0, 0)
+
+	cache, _ := NewPartitionedCache(ctx, partitioner, []PartitionInfo{{Name: "A", Cache: a}, {Name: "B", Cache: b}}, WithPartitionLoader(loader))
+	defer cache.Close()
+
+	cache.Put(ctx, "A1", "held")
+
+	res, err := cache.GetBatch(ctx, []Key{"A1", "A2", "B1", "B9"})
+	if err != nil {
+		t.Fatalf("TestPartitionedCache_PartitionLoader fail.  Unexpected error: %v", err)
+	}
+	if res[0].Value != "held" || res[1].Value != "loaded A2" || res[2].Value != "loaded B1" {
+		t.Fatalf("TestPartitionedCache_PartitionLoader fail.  Unexpected values: %v, %v, %v", res[0].Value, res[1].Value, res[2].Value)
+	}
+	if res[3].OK || res[3].Err != nil {
+		t.Fatalf("TestPartitionedCache_PartitionLoader fail.  Expected B9 not to be found, got %v, %v", res[3].OK, res[3].Err)
+	}
+
+	// The loaded values are held by the partitions of their keys
+	if v, ok, _ := a.Get(ctx, "A2"); !ok || v != "loaded A2" {
+		t.Fatalf("TestPartitionedCache_PartitionLoader fail.  Expected A2 in partition A, got %v, %v", v, ok)
+	}
+	if v, ok, _ := b.Get(ctx, "B1"); !ok || v != "loaded B1" {
+		t.Fatalf("TestPartitionedCache_PartitionLoader fail.  Expected B1 in partition B, got %v, %v", v, ok)
+	}
+
+	cache.GetBatch(ctx, []Key{"A2", "B1"})
+	if calls != 1 {
+		t.Fatalf("TestPartitionedCache_PartitionLoader fail.  Expected the loader to be called once, got %d", calls)
+	}
+}
+
+func TestPartitionedCache_PartialResults(t *testing.T) {
+	ctx := context.Background()
+
+	slowLoader := func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	partitioner := func(key Key) (Partition, error) {
+		return Partition(key.(string)[:1]), nil
+	}
+	a, _ := NewBasicCache(ctx, 0, 0)
+	b, _ := NewLoadingCache(ctx, slowLoader, 0, 0)
+
+	cache, _ := NewPartitionedCache(ctx, partitioner, []PartitionInfo{{Name: "A", Cache: a}, {Name: "B", Cache: b}}, WithPartialResults())
+	defer cache.Close()
+
+	cache.Put(ctx, "A1", "held")
+
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+
+	res, err := cache.GetBatch(cctx, []Key{"B1", "A1", "A2"})
+	if !errors.Is(err, ErrInvalidContext) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("TestPartitionedCache_PartialResults fail.  Expected wrapped context error, got %v", err)
+	}
+	if len(res) != 3 {
+		t.Fatalf("TestPartitionedCache_PartialResults fail.  Expected a result for each key, got %v", res)
+	}
+	if res[0].Key != "B1" || res[0].OK || !errors.Is(res[0].Err, ErrInvalidContext) {
+		t.Fatalf("TestPartitionedCache_PartialResults fail.  Expected B1 to be unresolved, got %v, %v", res[0].OK, res[0].Err)
+	}
+	if !res[1].OK || res[1].Value != "held" {
+		t.Fatalf("TestPartitionedCache_PartialResults fail.  Expected A1 to be resolved, got %v, %v", res[1].Value, res[1].Err)
+	}
+	if res[2].OK || res[2].Err != nil {
+		t.Fatalf("TestPartitionedCache_PartialResults fail.  Expected A2 to be resolved as not found, got %v, %v", res[2].OK, res[2].Err)
+	}
+}
+
+func TestPartitionedCache_Cache(t *testing.T) {
+	ctx := context.Background()
+
+	var cache Cache = newTestPartitionedCache(t)
+	defer cache.Close()
+
+	if err := cache.Put(ctx, "A1", 1); err != nil {
+		t.Fatalf("TestPartitionedCache_Cache fail.  Unexpected error: %v", err)
+	}
+	if err := cache.PutBatch(ctx, []KeyVal{{Key: "A2", Value: 2}, {Key: "B1", Value: 3}}); err != nil {
+		t.Fatalf("TestPartitionedCache_Cache fail.  Unexpected error: %v", err)
+	}
+	if l, _ := cache.Len(); l != 3 {
+		t.Fatalf("TestPartitionedCache_Cache fail.  Expected Len = 3, got %v", l)
+	}
+	if v, ok, _ := cache.Get(ctx, "B1"); !ok || v != 3 {
+		t.Fatalf("TestPartitionedCache_Cache fail.  Expected 3, got %v, %v", v, ok)
+	}
+
+	// No values are added if any key cannot be routed
+	if err := cache.PutBatch(ctx, []KeyVal{{Key: "A3", Value: 4}, {Key: "C1", Value: 5}}); !errors.Is(err, ErrInvalidPartition) {
+		t.Fatalf("TestPartitionedCache_Cache fail.  Expected error: %v, got error: %v", ErrInvalidPartition, err)
+	}
+	if l, _ := cache.Len(); l != 3 {
+		t.Fatalf("TestPartitionedCache_Cache fail.  Expected Len = 3, got %v", l)
+	}
+}
+
+func TestPartitionedCache_RouteKey(t *testing.T) {
+	cache := newTestPartitionedCache(t)
+	defer cache.Close()
+
+	if name, err := cache.RouteKey("A1"); err != nil || name != "A" {
+		t.Fatalf("TestPartitionedCache_RouteKey fail.  Expected partition A, got %v, %v", name, err)
+	}
+	if name, err := cache.RouteKey("B1"); err != nil || name != "B" {
+		t.Fatalf("TestPartitionedCache_RouteKey fail.  Expected partition B, got %v, %v", name, err)
+	}
+	if _, err := cache.RouteKey("C1"); !errors.Is(err, ErrInvalidPartition) {
+		t.Fatalf("TestPartitionedCache_RouteKey fail.  Expected error: %v, got error: %v", ErrInvalidPartition, err)
+	}
+	if _, err := cache.RouteKey(1); err == nil {
+		t.Fatal("TestPartitionedCache_RouteKey fail.  Expected partitioner error")
+	}
+	if l, _ := cache.Len(); l != 0 {
+		t.Fatalf("TestPartitionedCache_RouteKey fail.  Expected no entries, got %v", l)
+	}
+
+	cache.Close()
+	if _, err := cache.RouteKey("A1"); !errors.Is(err, ErrAttemptToUseInvalidCache) {
+		t.Fatalf("TestPartitionedCache_RouteKey fail.  Expected error: %v, got error: %v", ErrAttemptToUseInvalidCache, err)
+	}
+}
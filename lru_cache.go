@@ -1,13 +1,50 @@
 package lru
 
-import "container/list"
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrCapacityBelowPinned = errors.New("capacity cannot be less than that required by pinned entries")
+
+var ErrValueNotInt64 = errors.New("value held for key is not an int64")
 
 // cache is an LRU cache. It is not safe for concurrent access.
 type cache struct {
-	// capacity is the maximum number of cache entries before
-	// an item is evicted. Zero means no limit.
+	// capacity is the maximum number of cache entries (or their total
+	// weight, if weigher is set) before an item is evicted. Zero means no limit.
 	capacity int
 
+	// weigher, if set, determines the weight of each entry. Otherwise each entry weighs 1.
+	weigher func(key Key, value interface{}) int
+	// weight is the total weight of all entries
+	weight int
+	// pinned is the number of entries that are exempt from eviction
+	pinned int
+	// version is the most recent version assigned to an entry
+	version uint64
+	// evictBatch, if positive, is the most items evicted at a time to maintain the
+	// capacity, so that the cache may exceed its capacity until further evictions
+	evictBatch int
+	// sizeHint is the number of entries for which the map is allocated, so that it
+	// does not grow as the cache fills
+	sizeHint int
+
+	// ttl is the default time-to-live of entries. Zero means entries do not expire.
+	ttl time.Duration
+	// sliding, if true, extends the expiry of an entry each time it is retrieved.
+	sliding bool
+
+	// onEvict, if set, is called for each entry evicted from the cache, other than by remove.
+	onEvict func(key Key, value interface{})
+	// keyString renders keys in error messages
+	keyString func(key Key) string
+	// panicked, if set, is called with the value recovered from a panic in onEvict, or
+	// in funcs passed to removeWhere and forEach.
+	panicked func(r any)
+
 	ll    *list.List
 	cache map[interface{}]*list.Element
 }
@@ -16,72 +53,412 @@ type cache struct {
 type Key interface{}
 
 type entry struct {
-	key   Key
-	value interface{}
+	key     Key
+	value   interface{}
+	weight  int
+	pinned  bool
+	version uint64
+	ttl     time.Duration
+	expires time.Time
+	// inserted is when the entry was added, accessed when it was last read or
+	// written, and hits the number of times it has been read
+	inserted time.Time
+	accessed time.Time
+	hits     uint64
+}
+
+// expired returns true if the entry has a ttl that has elapsed
+func (e *entry) expired(now time.Time) bool {
+	return e.ttl > 0 && now.After(e.expires)
 }
 
-func newCache(maxEntries int) *cache {
+// setTTL updates the ttl of the entry, and resets its expiry
+func (e *entry) setTTL(ttl time.Duration, now time.Time) {
+	e.ttl = ttl
+	e.expires = time.Time{}
+	if ttl > 0 {
+		e.expires = now.Add(ttl)
+	}
+}
+
+func newCache(maxEntries int, sizeHint int) *cache {
 	return &cache{
 		capacity: maxEntries,
+		sizeHint: sizeHint,
 		ll:       list.New(),
-		cache:    make(map[interface{}]*list.Element),
+		cache:    make(map[interface{}]*list.Element, sizeHint),
+		keyString: func(key Key) string {
+			return fmt.Sprint(key)
+		},
 	}
 }
 
-// put adds a value to the cache.
+// put adds a value to the cache, using the default ttl.
 func (c *cache) put(key Key, value interface{}) {
-	if c.cache == nil {
-		c.cache = make(map[interface{}]*list.Element)
-		c.ll = list.New()
-	}
+	c.putWithTTL(key, value, c.ttl)
+}
+
+// putWithTTL adds a value to the cache, which expires after the ttl.
+// A zero ttl means the value does not expire.
+func (c *cache) putWithTTL(key Key, value interface{}, ttl time.Duration) {
+	now := time.Now()
 	if ee, ok := c.cache[key]; ok {
 		c.ll.MoveToFront(ee)
-		ee.Value.(*entry).value = value
-		return
+		e := ee.Value.(*entry)
+		e.value = value
+		e.setTTL(ttl, now)
+		c.setWeight(e)
+		c.setVersion(e)
+		e.accessed = now
+	} else {
+		e := &entry{key: key, value: value, inserted: now, accessed: now}
+		c.setVersion(e)
+		e.setTTL(ttl, now)
+		c.setWeight(e)
+		ele := c.ll.PushFront(e)
+		c.cache[key] = ele
+	}
+	c.evictOverCapacity()
+}
+
+// setVersion assigns a new version to the entry, which is unique within the cache,
+// so that a key that is removed and added again does not repeat an earlier version.
+func (c *cache) setVersion(e *entry) {
+	c.version++
+	e.version = c.version
+}
+
+// putIfVersion adds a value to the cache if the current version of the key
+// matches expected, where zero means the key is not found, returning whether
+// the value was added.
+func (c *cache) putIfVersion(key Key, value interface{}, expected uint64) bool {
+	var current uint64
+	if e := c.getEntry(key); e != nil {
+		current = e.version
+	}
+	if current != expected {
+		return false
+	}
+	c.put(key, value)
+	return true
+}
+
+// setWeight updates the weight of the entry, and the total weight of the cache
+func (c *cache) setWeight(e *entry) {
+	w := 1
+	if c.weigher != nil {
+		w = max(0, c.weigher(e.key, e.value))
+	}
+	c.weight += w - e.weight
+	e.weight = w
+}
+
+// overCapacity returns true if the cache holds more than its capacity
+func (c *cache) overCapacity() bool {
+	if c.capacity == 0 {
+		return false
 	}
-	ele := c.ll.PushFront(&entry{key, value})
-	c.cache[key] = ele
-	if c.capacity != 0 && c.ll.Len() > c.capacity {
-		c.removeOldest()
+	if c.weigher != nil {
+		return c.weight > c.capacity
 	}
+	return c.ll.Len() > c.capacity
+}
+
+// evictOverCapacity removes the oldest items until the cache is within its
+// capacity, or evictBatch items are removed, returning them in the order of their eviction.
+func (c *cache) evictOverCapacity() []KeyVal {
+	var evicted []KeyVal
+	for c.overCapacity() && (c.evictBatch == 0 || len(evicted) < c.evictBatch) {
+		kv, ok := c.removeOldest()
+		if !ok {
+			break
+		}
+		evicted = append(evicted, kv)
+	}
+	return evicted
 }
 
 // get looks up a key's value from the cache.
+// Expired entries are removed and reported as not found.
 func (c *cache) get(key Key) (value interface{}, ok bool) {
+	if e := c.getEntry(key); e != nil {
+		return e.value, true
+	}
+	return
+}
+
+// getEntry looks up a key's entry from the cache, returning nil if
+// it is not found or has expired.
+func (c *cache) getEntry(key Key) *entry {
 	if c.cache == nil {
-		return
+		return nil
 	}
 	if ele, hit := c.cache[key]; hit {
+		e := ele.Value.(*entry)
+		now := time.Now()
+		if e.expired(now) {
+			c.removeElement(ele)
+			return nil
+		}
+		if c.sliding {
+			e.setTTL(e.ttl, now)
+		}
+		e.accessed = now
+		e.hits++
 		c.ll.MoveToFront(ele)
-		return ele.Value.(*entry).value, true
+		return e
 	}
-	return
+	return nil
+}
+
+// contains returns true if the key is held and has not expired,
+// without changing its lru status.
+func (c *cache) contains(key Key) bool {
+	return c.peek(key) != nil
 }
 
-// remove removes the provided key from the cache.
-func (c *cache) remove(key Key) {
+// raw looks up a key's entry from the cache, including an entry that has
+// expired, returning nil if it is not found, without changing its lru status.
+func (c *cache) raw(key Key) *entry {
 	if c.cache == nil {
-		return
+		return nil
+	}
+	if ele, hit := c.cache[key]; hit {
+		return ele.Value.(*entry)
+	}
+	return nil
+}
+
+// peek looks up a key's entry from the cache, returning nil if it is not
+// found or has expired, without changing its lru status.
+func (c *cache) peek(key Key) *entry {
+	if e := c.raw(key); e != nil && !e.expired(time.Now()) {
+		return e
+	}
+	return nil
+}
+
+// getOrPut looks up a key's value from the cache, adding the provided
+// value if the key is not found, returning the value held by the cache.
+func (c *cache) getOrPut(key Key, value interface{}) interface{} {
+	if v, ok := c.get(key); ok {
+		return v
+	}
+	c.put(key, value)
+	return value
+}
+
+// increment adds delta to the int64 value of the key, adding the key
+// with a value of delta if it is not found, and returns the new value.
+// The expiry of an existing entry is unchanged.
+func (c *cache) increment(key Key, delta int64) (int64, error) {
+	e := c.getEntry(key)
+	if e == nil {
+		c.put(key, delta)
+		return delta, nil
+	}
+	n, ok := e.value.(int64)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s holds %T", ErrValueNotInt64, c.keyString(key), e.value)
+	}
+	e.value = n + delta
+	c.setWeight(e)
+	c.setVersion(e)
+	c.evictOverCapacity()
+	return n + delta, nil
+}
+
+// update replaces the value of the key with that returned by fn, which is passed
+// the current value and whether it was found, and returns the new value.
+// The value is unchanged if fn returns an error.
+func (c *cache) update(key Key, fn func(value interface{}, ok bool) (interface{}, error)) (interface{}, error) {
+	v, ok := c.get(key)
+	nv, err := fn(v, ok)
+	if err != nil {
+		return nil, err
+	}
+	c.put(key, nv)
+	return nv, nil
+}
+
+// remove removes the provided key from the cache, returning true if it was held.
+func (c *cache) remove(key Key) bool {
+	if c.cache == nil {
+		return false
 	}
 	if ele, hit := c.cache[key]; hit {
 		c.removeElement(ele)
+		return true
+	}
+	return false
+}
+
+// removeOldest removes the oldest unpinned item from the cache, returning it.
+func (c *cache) removeOldest() (kv KeyVal, ok bool) {
+	if c.cache == nil {
+		return
+	}
+	for ele := c.ll.Back(); ele != nil; ele = ele.Prev() {
+		e := ele.Value.(*entry)
+		if e.pinned {
+			continue
+		}
+		c.removeElement(ele)
+		c.evicted(e)
+		return KeyVal{Key: e.key, Value: e.value}, true
+	}
+	return
+}
+
+// setPinned pins or unpins the key, returning false if the key is not found.
+// Pinned items are not evicted to maintain the capacity of the cache.
+func (c *cache) setPinned(key Key, pinned bool) bool {
+	if c.cache == nil {
+		return false
+	}
+	ele, hit := c.cache[key]
+	if !hit {
+		return false
+	}
+	e := ele.Value.(*entry)
+	if e.pinned != pinned {
+		e.pinned = pinned
+		if pinned {
+			c.pinned++
+		} else {
+			c.pinned--
+		}
+	}
+	return true
+}
+
+// pinnedUsage returns the capacity consumed by pinned items; their
+// number, or their total weight if weigher is set.
+func (c *cache) pinnedUsage() int {
+	if c.weigher == nil || c.pinned == 0 {
+		return c.pinned
+	}
+	usage := 0
+	for ele := c.ll.Front(); ele != nil; ele = ele.Next() {
+		if e := ele.Value.(*entry); e.pinned {
+			usage += e.weight
+		}
+	}
+	return usage
+}
+
+// evicted notifies onEvict, if set, that the entry has been evicted.
+// A panic in onEvict is reported to panicked, so that it does not affect the cache.
+func (c *cache) evicted(e *entry) {
+	if c.onEvict == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil && c.panicked != nil {
+			c.panicked(r)
+		}
+	}()
+	c.onEvict(e.key, e.value)
+}
+
+// resize changes the capacity of the cache, evicting the oldest items
+// until the cache is within the new capacity, and returning them in
+// the order of their eviction.  Zero means no limit.
+// The capacity cannot be less than that used by pinned items.
+func (c *cache) resize(maxEntries int) ([]KeyVal, error) {
+	if pinned := c.pinnedUsage(); maxEntries != 0 && maxEntries < pinned {
+		return nil, fmt.Errorf("%w: %d is required by pinned entries", ErrCapacityBelowPinned, pinned)
+	}
+	c.capacity = maxEntries
+	return append([]KeyVal{}, c.evictOverCapacity()...), nil
+}
+
+// evict removes up to n of the oldest items, returning the number removed.
+func (c *cache) evict(n int) int {
+	removed := 0
+	for removed < n {
+		if _, ok := c.removeOldest(); !ok {
+			break
+		}
+		removed++
 	}
+	return removed
 }
 
-// removeOldest removes the oldest item from the cache.
-func (c *cache) removeOldest() {
+// forEach calls fn for each unexpired item, from the most to least
+// recently used, stopping if fn returns false.  The lru status of
+// the items is not changed.
+func (c *cache) forEach(fn func(key Key, value interface{}) bool) {
 	if c.cache == nil {
 		return
 	}
-	ele := c.ll.Back()
-	if ele != nil {
+	now := time.Now()
+	for ele := c.ll.Front(); ele != nil; ele = ele.Next() {
+		e := ele.Value.(*entry)
+		if e.expired(now) {
+			continue
+		}
+		if !fn(e.key, e.value) {
+			return
+		}
+	}
+}
+
+// removeAll evicts all items from the cache, including those pinned,
+// returning them from the least to most recently used.
+func (c *cache) removeAll() []KeyVal {
+	evicted := make([]KeyVal, 0, c.len())
+	if c.cache == nil {
+		return evicted
+	}
+	for ele := c.ll.Back(); ele != nil; ele = c.ll.Back() {
+		e := ele.Value.(*entry)
 		c.removeElement(ele)
+		c.evicted(e)
+		evicted = append(evicted, KeyVal{Key: e.key, Value: e.value})
+	}
+	return evicted
+}
+
+// drain removes all items, without calling onEvict, returning those that
+// have not expired from the most to the least recently used.
+func (c *cache) drain() []KeyVal {
+	drained := make([]KeyVal, 0, c.len())
+	c.forEach(func(key Key, value interface{}) bool {
+		drained = append(drained, KeyVal{Key: key, Value: value})
+		return true
+	})
+	c.clear()
+	return drained
+}
+
+// removeWhere removes every item for which pred returns true,
+// returning the number of items removed.
+func (c *cache) removeWhere(pred func(key Key, value interface{}) bool) int {
+	if c.cache == nil {
+		return 0
+	}
+	removed := 0
+	for e := c.ll.Front(); e != nil; {
+		// Capture next before e is unlinked from the list
+		next := e.Next()
+		kv := e.Value.(*entry)
+		if pred(kv.key, kv.value) {
+			c.removeElement(e)
+			removed++
+		}
+		e = next
 	}
+	return removed
 }
 
 func (c *cache) removeElement(e *list.Element) {
 	c.ll.Remove(e)
 	kv := e.Value.(*entry)
+	c.weight -= kv.weight
+	if kv.pinned {
+		c.pinned--
+	}
 	delete(c.cache, kv.key)
 }
 
@@ -93,8 +470,19 @@ func (c *cache) len() int {
 	return c.ll.Len()
 }
 
-// clear purges all stored items from the cache.
+// totalWeight returns the total weight of the items in the cache.
+func (c *cache) totalWeight() int {
+	if c.cache == nil {
+		return 0
+	}
+	return c.weight
+}
+
+// clear purges all stored items from the cache.  The list and map are replaced
+// rather than released, as resize and the eviction checks rely on them.
 func (c *cache) clear() {
-	c.ll = nil
-	c.cache = nil
+	c.ll = list.New()
+	c.cache = make(map[interface{}]*list.Element, c.sizeHint)
+	c.weight = 0
+	c.pinned = 0
 }
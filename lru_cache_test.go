@@ -20,8 +20,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"runtime"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type simpleStruct struct {
@@ -254,3 +259,1958 @@ func TestNewBasicCache(t *testing.T) {
 		t.Fatalf("TestNewBasicCache fail.  Expected error: %v, got error: %v", ErrInvalidMaxEntries, err)
 	}
 }
+
+func TestBasicCache_RemoveWhere(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+	defer lru.Close()
+
+	for i := 0; i < 10; i++ {
+		lru.Put(ctx, fmt.Sprintf("tenantA_%d", i), i)
+		lru.Put(ctx, fmt.Sprintf("tenantB_%d", i), i)
+	}
+
+	n, err := lru.RemoveWhere(func(key Key, value any) bool {
+		return strings.HasPrefix(key.(string), "tenantA_")
+	})
+	if err != nil {
+		t.Fatalf("TestBasicCache_RemoveWhere failed.  Expected success, but got error %v", err)
+	}
+	if n != 10 {
+		t.Fatalf("TestBasicCache_RemoveWhere failed.  Expected %d removed, got %v", 10, n)
+	}
+	if val, _ := lru.Len(); val != 10 {
+		t.Fatalf("TestBasicCache_RemoveWhere failed.  Expected Len = %d, got %v", 10, val)
+	}
+	if _, ok, _ := lru.Get(ctx, "tenantA_5"); ok {
+		t.Fatal("TestBasicCache_RemoveWhere returned a removed entry")
+	}
+	if _, ok, _ := lru.Get(ctx, "tenantB_5"); !ok {
+		t.Fatal("TestBasicCache_RemoveWhere removed an unmatched entry")
+	}
+
+	// A panic in the predicate is reported, and the cache remains usable
+	_, err = lru.RemoveWhere(func(key Key, value any) bool { panic("boom") })
+	if err == nil {
+		t.Fatal("TestBasicCache_RemoveWhere failed.  Expected an error from panicking predicate")
+	}
+	if val, _ := lru.Len(); val != 10 {
+		t.Fatalf("TestBasicCache_RemoveWhere failed.  Expected Len = %d, got %v", 10, val)
+	}
+}
+
+func TestBasicCache_MaxValueSize(t *testing.T) {
+	ctx := context.Background()
+
+	sizer := func(v any) int64 { return int64(len(v.(string))) }
+
+	lru, _ := NewBasicCache(ctx, 0, 0, WithMaxValueSize(5, sizer))
+	defer lru.Close()
+
+	if err := lru.Put(ctx, "small", "abc"); err != nil {
+		t.Fatalf("TestBasicCache_MaxValueSize failed.  Expected success, but got error %v", err)
+	}
+
+	err := lru.Put(ctx, "large", "abcdefgh")
+	if !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("TestBasicCache_MaxValueSize failed.  Expected error: %v, got error: %v", ErrValueTooLarge, err)
+	}
+	if _, ok, _ := lru.Get(ctx, "large"); ok {
+		t.Fatal("TestBasicCache_MaxValueSize failed.  Oversized value was stored")
+	}
+
+	err = lru.PutBatch(ctx, []KeyVal{{Key: "a", Value: "a"}, {Key: "b", Value: "bbbbbbbb"}})
+	var pe *PutError
+	if !errors.As(err, &pe) || pe.Key != "b" {
+		t.Fatalf("TestBasicCache_MaxValueSize failed.  Expected PutError for key b, got error: %v", err)
+	}
+	if val, _ := lru.Len(); val != 2 {
+		t.Fatalf("TestBasicCache_MaxValueSize failed.  Expected Len = %d, got %v", 2, val)
+	}
+}
+
+func TestBasicCache_MaxValueSize_1(t *testing.T) {
+	ctx := context.Background()
+
+	sizer := func(v any) int64 { return int64(len(v.(string))) }
+
+	lru, _ := NewBasicCache(ctx, 0, 0, WithMaxValueSize(5, sizer), WithRejectWholeBatch())
+	defer lru.Close()
+
+	err := lru.PutBatch(ctx, []KeyVal{{Key: "a", Value: "a"}, {Key: "b", Value: "bbbbbbbb"}})
+	if !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("TestBasicCache_MaxValueSize_1 failed.  Expected error: %v, got error: %v", ErrValueTooLarge, err)
+	}
+	if val, _ := lru.Len(); val != 0 {
+		t.Fatalf("TestBasicCache_MaxValueSize_1 failed.  Expected Len = %d, got %v", 0, val)
+	}
+
+	if _, err := NewBasicCache(ctx, 0, 0, WithMaxValueSize(5, nil)); !errors.Is(err, ErrInvalidSizer) {
+		t.Fatalf("TestBasicCache_MaxValueSize_1 failed.  Expected error: %v, got error: %v", ErrInvalidSizer, err)
+	}
+}
+
+func TestBasicCache_PutBatch(t *testing.T) {
+	ctx := context.Background()
+
+	maxSize := 100
+
+	lru, _ := NewBasicCache(ctx, maxSize, 0)
+	defer lru.Close()
+
+	vals := []KeyVal{}
+	for i := 0; i < maxSize*2; i++ {
+		vals = append(vals, KeyVal{Key: i, Value: i})
+	}
+
+	if err := lru.PutBatch(ctx, vals); err != nil {
+		t.Fatalf("TestBasicCache_PutBatch failed.  Expected success, but got error %v", err)
+	}
+	if val, _ := lru.Len(); val != maxSize {
+		t.Fatalf("TestBasicCache_PutBatch failed.  Expected Len = %d, got %v", maxSize, val)
+	}
+	if _, ok, _ := lru.Get(ctx, maxSize*2-1); !ok {
+		t.Fatal("TestBasicCache_PutBatch failed.  Expected most recent entry to be retained")
+	}
+	if _, ok, _ := lru.Get(ctx, 0); ok {
+		t.Fatal("TestBasicCache_PutBatch failed.  Expected oldest entry to be evicted")
+	}
+
+	// Entries prior to a nil value are added, subsequent ones are not
+	err := lru.PutBatch(ctx, []KeyVal{{Key: "x", Value: 1}, {Key: "y", Value: nil}, {Key: "z", Value: 1}})
+	if !errors.Is(err, ErrInvalidValueToAddToCache) {
+		t.Fatalf("TestBasicCache_PutBatch failed.  Expected error: %v, got error: %v", ErrInvalidValueToAddToCache, err)
+	}
+	if _, ok, _ := lru.Get(ctx, "x"); !ok {
+		t.Fatal("TestBasicCache_PutBatch failed.  Expected x to be added")
+	}
+	if _, ok, _ := lru.Get(ctx, "z"); ok {
+		t.Fatal("TestBasicCache_PutBatch failed.  Expected z not to be added")
+	}
+}
+
+func TestBasicCache_TTL(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0, WithTTL(20*time.Millisecond))
+	defer lru.Close()
+
+	lru.Put(ctx, "default", 1)
+	lru.PutWithTTL(ctx, "longer", 2, time.Hour)
+
+	if _, ok, _ := lru.Get(ctx, "default"); !ok {
+		t.Fatal("TestBasicCache_TTL failed.  Expected entry before expiry")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if _, ok, _ := lru.Get(ctx, "default"); ok {
+		t.Fatal("TestBasicCache_TTL failed.  Expected entry to have expired")
+	}
+	if _, ok, _ := lru.Get(ctx, "longer"); !ok {
+		t.Fatal("TestBasicCache_TTL failed.  Expected entry with longer ttl to be present")
+	}
+
+	if err := lru.PutWithTTL(ctx, "invalid", 3, -time.Second); !errors.Is(err, ErrInvalidTTL) {
+		t.Fatalf("TestBasicCache_TTL failed.  Expected error: %v, got error: %v", ErrInvalidTTL, err)
+	}
+}
+
+func TestBasicCache_SlidingExpiration(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0, WithTTL(100*time.Millisecond), WithSlidingExpiration())
+	defer lru.Close()
+
+	lru.Put(ctx, "active", 1)
+	lru.Put(ctx, "idle", 2)
+
+	// Keep accessing the active entry beyond its original expiry
+	for i := 0; i < 4; i++ {
+		time.Sleep(40 * time.Millisecond)
+		if _, ok, _ := lru.Get(ctx, "active"); !ok {
+			t.Fatal("TestBasicCache_SlidingExpiration failed.  Expected active entry to be retained")
+		}
+	}
+
+	if _, ok, _ := lru.Get(ctx, "idle"); ok {
+		t.Fatal("TestBasicCache_SlidingExpiration failed.  Expected idle entry to have expired")
+	}
+}
+
+func TestBasicCache_KeyNormalizer(t *testing.T) {
+	ctx := context.Background()
+
+	normalizer := func(key Key) Key { return strings.ToLower(key.(string)) }
+
+	lru, _ := NewBasicCache(ctx, 0, 0, WithKeyNormalizer(normalizer))
+	defer lru.Close()
+
+	lru.Put(ctx, "MyKey", 1234)
+	lru.PutBatch(ctx, []KeyVal{{Key: "OTHER", Value: 1}})
+
+	res, err := lru.GetBatch(ctx, []Key{"mykey", "MYKEY", "other"})
+	if err != nil {
+		t.Fatalf("TestBasicCache_KeyNormalizer failed.  Expected success, but got error %v", err)
+	}
+	for i, k := range []Key{"mykey", "MYKEY", "other"} {
+		if !res[i].OK || res[i].Key != k {
+			t.Fatalf("TestBasicCache_KeyNormalizer failed.  Unexpected result for %v: %v", k, res[i])
+		}
+	}
+
+	lru.Remove("MYKEY")
+	if _, ok, _ := lru.Get(ctx, "MyKey"); ok {
+		t.Fatal("TestBasicCache_KeyNormalizer returned a removed entry")
+	}
+	if val, _ := lru.Len(); val != 1 {
+		t.Fatalf("TestBasicCache_KeyNormalizer failed.  Expected Len = %d, got %v", 1, val)
+	}
+}
+
+func TestBasicCache_GetWithExpiry(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+	defer lru.Close()
+
+	lru.Put(ctx, "forever", 1)
+
+	before := time.Now()
+	lru.PutWithTTL(ctx, "expiring", 2, time.Hour)
+
+	v, expiresAt, ok, err := lru.GetWithExpiry(ctx, "forever")
+	if err != nil || !ok || v != 1 {
+		t.Fatalf("TestBasicCache_GetWithExpiry failed.  Unexpected result: %v, %v, %v", v, ok, err)
+	}
+	if !expiresAt.IsZero() {
+		t.Fatalf("TestBasicCache_GetWithExpiry failed.  Expected zero expiry, got %v", expiresAt)
+	}
+
+	v, expiresAt, ok, err = lru.GetWithExpiry(ctx, "expiring")
+	if err != nil || !ok || v != 2 {
+		t.Fatalf("TestBasicCache_GetWithExpiry failed.  Unexpected result: %v, %v, %v", v, ok, err)
+	}
+	if expiresAt.Before(before.Add(time.Hour)) || expiresAt.After(time.Now().Add(time.Hour)) {
+		t.Fatalf("TestBasicCache_GetWithExpiry failed.  Unexpected expiry %v", expiresAt)
+	}
+
+	if _, _, ok, _ := lru.GetWithExpiry(ctx, "missing"); ok {
+		t.Fatal("TestBasicCache_GetWithExpiry failed.  Expected ok = false for missing key")
+	}
+}
+
+func TestBasicCache_PutBatch_1(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 2, 0)
+	defer lru.Close()
+
+	// Last write wins within a batch, and duplicates do not cause eviction
+	err := lru.PutBatch(ctx, []KeyVal{{Key: "a", Value: 1}, {Key: "b", Value: 2}, {Key: "a", Value: 3}, {Key: "b", Value: 4}})
+	if err != nil {
+		t.Fatalf("TestBasicCache_PutBatch_1 failed.  Expected success, but got error %v", err)
+	}
+	if val, _ := lru.Len(); val != 2 {
+		t.Fatalf("TestBasicCache_PutBatch_1 failed.  Expected Len = %d, got %v", 2, val)
+	}
+	if v, _, _ := lru.Get(ctx, "a"); v != 3 {
+		t.Fatalf("TestBasicCache_PutBatch_1 failed.  Expected a = 3, got %v", v)
+	}
+	if v, _, _ := lru.Get(ctx, "b"); v != 4 {
+		t.Fatalf("TestBasicCache_PutBatch_1 failed.  Expected b = 4, got %v", v)
+	}
+}
+
+func TestDedupKeyVals(t *testing.T) {
+	res := dedupKeyVals([]KeyVal{{Key: "a", Value: 1}, {Key: "b", Value: 2}, {Key: "a", Value: 3}, {Key: "c", Value: 4}})
+
+	expected := []KeyVal{{Key: "b", Value: 2}, {Key: "a", Value: 3}, {Key: "c", Value: 4}}
+	if len(res) != len(expected) {
+		t.Fatalf("TestDedupKeyVals failed.  Expected %v, got %v", expected, res)
+	}
+	for i := range expected {
+		if res[i] != expected[i] {
+			t.Fatalf("TestDedupKeyVals failed.  Expected %v, got %v", expected, res)
+		}
+	}
+}
+
+func TestBasicCache_Resize(t *testing.T) {
+	ctx := context.Background()
+
+	evictions := []Key{}
+	lru, _ := NewBasicCache(ctx, 0, 0, WithOnEvict(func(key Key, value any) {
+		evictions = append(evictions, key)
+	}))
+	defer lru.Close()
+
+	for i := 0; i < 10; i++ {
+		lru.Put(ctx, i, i)
+	}
+
+	evicted, err := lru.Resize(4)
+	if err != nil {
+		t.Fatalf("TestBasicCache_Resize failed.  Expected success, but got error %v", err)
+	}
+	if len(evicted) != 6 {
+		t.Fatalf("TestBasicCache_Resize failed.  Expected 6 evicted, got %v", len(evicted))
+	}
+	for i, kv := range evicted {
+		if kv.Key != i || kv.Value != i {
+			t.Fatalf("TestBasicCache_Resize failed.  Expected eviction of %d, got %v", i, kv)
+		}
+	}
+	if val, _ := lru.Len(); val != 4 {
+		t.Fatalf("TestBasicCache_Resize failed.  Expected Len = %d, got %v", 4, val)
+	}
+
+	// New capacity is enforced on subsequent additions
+	lru.Put(ctx, 10, 10)
+	if val, _ := lru.Len(); val != 4 {
+		t.Fatalf("TestBasicCache_Resize failed.  Expected Len = %d, got %v", 4, val)
+	}
+
+	if len(evictions) != 7 {
+		t.Fatalf("TestBasicCache_Resize failed.  Expected 7 OnEvict calls, got %v", len(evictions))
+	}
+
+	if _, err := lru.Resize(-1); !errors.Is(err, ErrInvalidMaxEntries) {
+		t.Fatalf("TestBasicCache_Resize failed.  Expected error: %v, got error: %v", ErrInvalidMaxEntries, err)
+	}
+}
+
+func TestBasicCache_ResizeAfterTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 5, 10*time.Millisecond)
+	defer lru.Close()
+
+	lru.Put(ctx, 1, 1)
+
+	// A slow Update occupies the cache goroutine, so that the Resize times out
+	// whilst its request is still queued
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lru.Update(ctx, 1, func(value any, ok bool) (any, error) {
+			time.Sleep(50 * time.Millisecond)
+			return value, nil
+		})
+	}()
+	time.Sleep(time.Millisecond)
+
+	if _, err := lru.Resize(3); err != ErrTimeout {
+		t.Fatalf("TestBasicCache_ResizeAfterTimeout failed.  Expected error: %v, got error: %v", ErrTimeout, err)
+	}
+	<-done
+
+	// The abandoned Resize is still applied, and the capacity reported must match it
+	for i := 0; i < 100 && lru.Config().Capacity != 3; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if cfg := lru.Config(); cfg.Capacity != 3 {
+		t.Fatalf("TestBasicCache_ResizeAfterTimeout failed.  Expected Capacity = 3, got %v", cfg.Capacity)
+	}
+}
+
+func TestBasicCache_ResizeUnbounded(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 5, 0)
+	defer lru.Close()
+
+	// Unbounded during the import
+	if evicted, err := lru.Resize(0); err != nil || len(evicted) != 0 {
+		t.Fatalf("TestBasicCache_ResizeUnbounded failed.  Expected no evictions, got %v, %v", evicted, err)
+	}
+	for i := 0; i < 100; i++ {
+		lru.Put(ctx, i, i)
+	}
+	if val, _ := lru.Len(); val != 100 {
+		t.Fatalf("TestBasicCache_ResizeUnbounded failed.  Expected Len = %d, got %v", 100, val)
+	}
+
+	// Recently used entries are retained when bounded
+	lru.Get(ctx, 0)
+	lru.Get(ctx, 1)
+
+	evicted, err := lru.Resize(10)
+	if err != nil {
+		t.Fatalf("TestBasicCache_ResizeUnbounded failed.  Unexpected error %v", err)
+	}
+	if len(evicted) != 90 {
+		t.Fatalf("TestBasicCache_ResizeUnbounded failed.  Expected 90 evicted, got %v", len(evicted))
+	}
+	keys, _ := lru.Keys()
+	expected := []Key{1, 0, 99, 98, 97, 96, 95, 94, 93, 92}
+	if !slices.Equal(keys, expected) {
+		t.Fatalf("TestBasicCache_ResizeUnbounded failed.  Expected %v, got %v", expected, keys)
+	}
+
+	// Bounded to unbounded and back again
+	if evicted, _ := lru.Resize(0); len(evicted) != 0 {
+		t.Fatalf("TestBasicCache_ResizeUnbounded failed.  Expected no evictions, got %v", evicted)
+	}
+	lru.Put(ctx, 100, 100)
+	if evicted, _ := lru.Resize(10); len(evicted) != 1 || evicted[0].Key != 92 {
+		t.Fatalf("TestBasicCache_ResizeUnbounded failed.  Expected only the least recently used to be evicted, got %v", evicted)
+	}
+}
+
+func TestBasicCache_Clear(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+	defer lru.Close()
+
+	for i := 0; i < 10; i++ {
+		lru.Put(ctx, i, i)
+	}
+
+	evicted, err := lru.Clear()
+	if err != nil {
+		t.Fatalf("TestBasicCache_Clear failed.  Expected success, but got error %v", err)
+	}
+	if len(evicted) != 10 {
+		t.Fatalf("TestBasicCache_Clear failed.  Expected 10 evicted, got %v", len(evicted))
+	}
+	if val, _ := lru.Len(); val != 0 {
+		t.Fatalf("TestBasicCache_Clear failed.  Expected Len = %d, got %v", 0, val)
+	}
+
+	// Cache remains usable after Clear
+	lru.Put(ctx, "myKey", 1234)
+	if _, ok, _ := lru.Get(ctx, "myKey"); !ok {
+		t.Fatal("TestBasicCache_Clear failed.  Expected cache to be usable")
+	}
+}
+
+func TestBasicCache_Drain(t *testing.T) {
+	ctx := context.Background()
+
+	evictions := 0
+	lru, _ := NewBasicCache(ctx, 0, 0, WithOnEvict(func(key Key, value any) { evictions++ }))
+	defer lru.Close()
+
+	for i := 0; i < 10; i++ {
+		lru.Put(ctx, i, i)
+	}
+
+	drained, err := lru.Drain()
+	if err != nil {
+		t.Fatalf("TestBasicCache_Drain failed.  Expected success, but got error %v", err)
+	}
+	if len(drained) != 10 || drained[0].Key != 9 || drained[9].Key != 0 {
+		t.Fatalf("TestBasicCache_Drain failed.  Expected 10 items from most to least recently used, got %v", drained)
+	}
+	if evictions != 0 {
+		t.Fatalf("TestBasicCache_Drain failed.  Expected no evictions, got %d", evictions)
+	}
+	if val, _ := lru.Len(); val != 0 {
+		t.Fatalf("TestBasicCache_Drain failed.  Expected Len = %d, got %v", 0, val)
+	}
+
+	// Cache remains usable after Drain
+	lru.Put(ctx, "myKey", 1234)
+	if _, ok, _ := lru.Get(ctx, "myKey"); !ok {
+		t.Fatal("TestBasicCache_Drain failed.  Expected cache to be usable")
+	}
+
+	lru.Close()
+	if _, err := lru.Drain(); err != ErrAttemptToUseInvalidCache {
+		t.Fatalf("TestBasicCache_Drain failed.  Expected error: %v, got error: %v", ErrAttemptToUseInvalidCache, err)
+	}
+}
+
+func TestBasicCache_DrainThenResize(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+	defer lru.Close()
+
+	lru.Put(ctx, 1, 1)
+	lru.Drain()
+
+	if _, err := lru.Resize(3); err != nil {
+		t.Fatalf("TestBasicCache_DrainThenResize failed.  Expected success, but got error %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		lru.Put(ctx, i, i)
+	}
+	if val, _ := lru.Len(); val != 3 {
+		t.Fatalf("TestBasicCache_DrainThenResize failed.  Expected Len = %d, got %v", 3, val)
+	}
+}
+
+func TestBasicCache_DrainThenPutEvictionBatch(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 3, 0, WithEvictionBatchSize(1))
+	defer lru.Close()
+
+	lru.Put(ctx, 1, 1)
+	lru.Drain()
+
+	for i := 0; i < 5; i++ {
+		if err := lru.Put(ctx, i, i); err != nil {
+			t.Fatalf("TestBasicCache_DrainThenPutEvictionBatch failed.  Expected success, but got error %v", err)
+		}
+	}
+	if _, ok, _ := lru.Get(ctx, 4); !ok {
+		t.Fatal("TestBasicCache_DrainThenPutEvictionBatch failed.  Expected 4 to be held")
+	}
+}
+
+func TestBasicCache_Ping(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+	defer lru.Close()
+
+	if err := lru.Ping(context.Background()); err != nil {
+		t.Fatalf("TestBasicCache_Ping failed.  Expected success, but got error %v", err)
+	}
+
+	// Completing the context of the cache closes it
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+
+	if err := lru.Ping(context.Background()); !errors.Is(err, ErrAttemptToUseInvalidCache) {
+		t.Fatalf("TestBasicCache_Ping failed.  Expected error: %v, got error: %v", ErrAttemptToUseInvalidCache, err)
+	}
+}
+
+func TestBasicCache_Weigher(t *testing.T) {
+	ctx := context.Background()
+
+	weigher := func(key Key, value any) int { return len(value.(string)) }
+
+	lru, _ := NewBasicCache(ctx, 10, 0, WithWeigher(weigher))
+	defer lru.Close()
+
+	lru.Put(ctx, "a", "aaaa")
+	lru.Put(ctx, "b", "bbbb")
+
+	if w, _ := lru.Weight(); w != 8 {
+		t.Fatalf("TestBasicCache_Weigher failed.  Expected Weight = %d, got %v", 8, w)
+	}
+
+	// Exceeds capacity, so the oldest entry is evicted
+	lru.Put(ctx, "c", "cccc")
+
+	if val, _ := lru.Len(); val != 2 {
+		t.Fatalf("TestBasicCache_Weigher failed.  Expected Len = %d, got %v", 2, val)
+	}
+	if w, _ := lru.Weight(); w != 8 {
+		t.Fatalf("TestBasicCache_Weigher failed.  Expected Weight = %d, got %v", 8, w)
+	}
+	if _, ok, _ := lru.Get(ctx, "a"); ok {
+		t.Fatal("TestBasicCache_Weigher failed.  Expected a to be evicted")
+	}
+
+	// Replacing a value with a heavier one also evicts
+	lru.Put(ctx, "c", "cccccccc")
+	if val, _ := lru.Len(); val != 1 {
+		t.Fatalf("TestBasicCache_Weigher failed.  Expected Len = %d, got %v", 1, val)
+	}
+	if w, _ := lru.Weight(); w != 8 {
+		t.Fatalf("TestBasicCache_Weigher failed.  Expected Weight = %d, got %v", 8, w)
+	}
+
+	lru.Remove("c")
+	if w, _ := lru.Weight(); w != 0 {
+		t.Fatalf("TestBasicCache_Weigher failed.  Expected Weight = %d, got %v", 0, w)
+	}
+}
+
+func TestBasicCache_Evict(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+	defer lru.Close()
+
+	for i := 0; i < 10; i++ {
+		lru.Put(ctx, i, i)
+	}
+	lru.Get(ctx, 0) // Now most recently used
+
+	n, err := lru.Evict(3)
+	if err != nil {
+		t.Fatalf("TestBasicCache_Evict failed.  Expected success, but got error %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("TestBasicCache_Evict failed.  Expected 3 removed, got %v", n)
+	}
+	for _, k := range []int{1, 2, 3} {
+		if _, ok, _ := lru.Get(ctx, k); ok {
+			t.Fatalf("TestBasicCache_Evict failed.  Expected %d to be evicted", k)
+		}
+	}
+	if _, ok, _ := lru.Get(ctx, 0); !ok {
+		t.Fatal("TestBasicCache_Evict failed.  Expected 0 to be retained")
+	}
+
+	if n, _ := lru.Evict(100); n != 7 {
+		t.Fatalf("TestBasicCache_Evict failed.  Expected 7 removed, got %v", n)
+	}
+}
+
+func TestBasicCache_ForEach(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+	defer lru.Close()
+
+	for i := 0; i < 10; i++ {
+		lru.Put(ctx, i, i)
+	}
+
+	seen := []Key{}
+	err := lru.ForEach(func(key Key, value any) bool {
+		seen = append(seen, key)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("TestBasicCache_ForEach failed.  Expected success, but got error %v", err)
+	}
+	if len(seen) != 10 {
+		t.Fatalf("TestBasicCache_ForEach failed.  Expected 10 entries, got %v", len(seen))
+	}
+	for i, k := range seen {
+		if k != 9-i {
+			t.Fatalf("TestBasicCache_ForEach failed.  Expected most recently used first, got %v", seen)
+		}
+	}
+
+	// Stops early
+	count := 0
+	lru.ForEach(func(key Key, value any) bool {
+		count++
+		return count < 3
+	})
+	if count != 3 {
+		t.Fatalf("TestBasicCache_ForEach failed.  Expected iteration to stop after 3, got %v", count)
+	}
+}
+
+func TestBasicCache_GetOrDefault(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+	defer lru.Close()
+
+	lru.Put(ctx, "present", 1)
+
+	if v, err := lru.GetOrDefault(ctx, "present", 2); err != nil || v != 1 {
+		t.Fatalf("TestBasicCache_GetOrDefault failed.  Expected 1, got %v, %v", v, err)
+	}
+
+	if v, err := lru.GetOrDefault(ctx, "missing", 3); err != nil || v != 3 {
+		t.Fatalf("TestBasicCache_GetOrDefault failed.  Expected 3, got %v, %v", v, err)
+	}
+	if v, ok, _ := lru.Get(ctx, "missing"); !ok || v != 3 {
+		t.Fatalf("TestBasicCache_GetOrDefault failed.  Expected default to be stored, got %v, %v", v, ok)
+	}
+
+	if _, err := lru.GetOrDefault(ctx, "nil", nil); !errors.Is(err, ErrInvalidValueToAddToCache) {
+		t.Fatalf("TestBasicCache_GetOrDefault failed.  Expected error: %v, got error: %v", ErrInvalidValueToAddToCache, err)
+	}
+}
+
+func TestBasicCache_ContainsBatch(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 2, 0)
+	defer lru.Close()
+
+	lru.Put(ctx, "a", 1)
+	lru.Put(ctx, "b", 2)
+
+	m, err := lru.ContainsBatch([]Key{"a", "b", "c"})
+	if err != nil {
+		t.Fatalf("TestBasicCache_ContainsBatch failed.  Expected success, but got error %v", err)
+	}
+	if !m["a"] || !m["b"] || m["c"] {
+		t.Fatalf("TestBasicCache_ContainsBatch failed.  Unexpected result %v", m)
+	}
+
+	// Checking presence does not promote, so "a" remains the eviction candidate
+	lru.Put(ctx, "c", 3)
+	if ok, _ := lru.Contains("a"); ok {
+		t.Fatal("TestBasicCache_ContainsBatch failed.  Expected a to be evicted")
+	}
+}
+
+func TestBasicCache_Pin(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 3, 0)
+	defer lru.Close()
+
+	lru.Put(ctx, "a", 1)
+	lru.Put(ctx, "b", 2)
+
+	if ok, err := lru.Pin("a"); !ok || err != nil {
+		t.Fatalf("TestBasicCache_Pin failed.  Expected pin to succeed, got %v, %v", ok, err)
+	}
+	if ok, _ := lru.Pin("missing"); ok {
+		t.Fatal("TestBasicCache_Pin failed.  Expected pin of missing key to fail")
+	}
+
+	for i := 0; i < 10; i++ {
+		lru.Put(ctx, i, i)
+	}
+
+	if _, ok, _ := lru.Get(ctx, "a"); !ok {
+		t.Fatal("TestBasicCache_Pin failed.  Expected pinned entry to be retained")
+	}
+	if _, ok, _ := lru.Get(ctx, "b"); ok {
+		t.Fatal("TestBasicCache_Pin failed.  Expected unpinned entry to be evicted")
+	}
+
+	lru.Pin(9)
+	_, err := lru.Resize(1)
+	if !errors.Is(err, ErrCapacityBelowPinned) {
+		t.Fatalf("TestBasicCache_Pin failed.  Expected error: %v, got error: %v", ErrCapacityBelowPinned, err)
+	}
+	if !strings.Contains(err.Error(), "2") {
+		t.Fatalf("TestBasicCache_Pin failed.  Expected error to include pinned count, got: %v", err)
+	}
+
+	lru.Unpin(9)
+	if _, err := lru.Resize(1); err != nil {
+		t.Fatalf("TestBasicCache_Pin failed.  Expected success, but got error %v", err)
+	}
+	if _, ok, _ := lru.Get(ctx, 9); ok {
+		t.Fatal("TestBasicCache_Pin failed.  Expected unpinned entry to be evicted")
+	}
+
+	if evicted, _ := lru.Clear(); len(evicted) != 1 {
+		t.Fatalf("TestBasicCache_Pin failed.  Expected Clear to remove pinned entry, got %v", evicted)
+	}
+}
+
+func TestBasicCache_CopyOnGetAndPut(t *testing.T) {
+	ctx := context.Background()
+
+	copier := func(v any) any {
+		return append([]int{}, v.([]int)...)
+	}
+
+	lru, _ := NewBasicCache(ctx, 0, 0, WithCopyOnGet(copier), WithCopyOnPut(copier))
+	defer lru.Close()
+
+	orig := []int{1, 2, 3}
+	lru.Put(ctx, "a", orig)
+	orig[0] = 100
+
+	v, _, _ := lru.Get(ctx, "a")
+	if v.([]int)[0] != 1 {
+		t.Fatalf("TestBasicCache_CopyOnGetAndPut failed.  Expected cached value to be unaffected by caller, got %v", v)
+	}
+	v.([]int)[1] = 200
+
+	v, _, _ = lru.Get(ctx, "a")
+	if v.([]int)[1] != 2 {
+		t.Fatalf("TestBasicCache_CopyOnGetAndPut failed.  Expected cached value to be unaffected by mutation, got %v", v)
+	}
+}
+
+func TestBasicCache_LenContext(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+	defer lru.Close()
+
+	lru.Put(ctx, "a", 1)
+
+	if l, err := lru.LenContext(ctx); err != nil || l != 1 {
+		t.Fatalf("TestBasicCache_LenContext failed.  Expected 1, got %v, %v", l, err)
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if _, err := lru.LenContext(cctx); err != ErrInvalidContext {
+		t.Fatalf("TestBasicCache_LenContext failed.  Expected error: %v, got error: %v", ErrInvalidContext, err)
+	}
+}
+
+func TestBasicCache_Find(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+	defer lru.Close()
+
+	for i := 0; i < 10; i++ {
+		lru.Put(ctx, i, i)
+	}
+
+	found, err := lru.Find(func(value any) bool { return value.(int)%2 == 0 })
+	if err != nil {
+		t.Fatalf("TestBasicCache_Find failed.  Expected success, but got error %v", err)
+	}
+	if len(found) != 5 {
+		t.Fatalf("TestBasicCache_Find failed.  Expected 5 matches, got %v", found)
+	}
+	if found[0].Key != 8 {
+		t.Fatalf("TestBasicCache_Find failed.  Expected most recently used first, got %v", found)
+	}
+
+	if _, err := lru.Find(nil); err != ErrInvalidPredicate {
+		t.Fatalf("TestBasicCache_Find failed.  Expected error: %v, got error: %v", ErrInvalidPredicate, err)
+	}
+}
+
+func TestBasicCache_PutBatchSkipNilValues(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0, WithSkipNilValues())
+	defer lru.Close()
+
+	err := lru.PutBatch(ctx, []KeyVal{{Key: "a", Value: 1}, {Key: "b"}, {Key: "c", Value: 3}})
+	if !errors.Is(err, ErrInvalidValueToAddToCache) {
+		t.Fatalf("TestBasicCache_PutBatchSkipNilValues failed.  Expected error: %v, got error: %v", ErrInvalidValueToAddToCache, err)
+	}
+	var pe *PutError
+	if !errors.As(err, &pe) || pe.Key != "b" {
+		t.Fatalf("TestBasicCache_PutBatchSkipNilValues failed.  Expected PutError for b, got %v", err)
+	}
+
+	if l, _ := lru.Len(); l != 2 {
+		t.Fatalf("TestBasicCache_PutBatchSkipNilValues failed.  Expected Len = 2, got %v", l)
+	}
+	if _, ok, _ := lru.Get(ctx, "c"); !ok {
+		t.Fatal("TestBasicCache_PutBatchSkipNilValues failed.  Expected entry after nil value to be added")
+	}
+}
+
+func TestBasicCache_ChannelStats(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+
+	lru.Put(ctx, "a", 1)
+
+	put, get, rm, other, err := lru.ChannelStats()
+	if err != nil {
+		t.Fatalf("TestBasicCache_ChannelStats failed.  Expected success, but got error %v", err)
+	}
+	if put != 0 || get != 0 || rm != 0 || other != 0 {
+		t.Fatalf("TestBasicCache_ChannelStats failed.  Expected idle channels, got %v, %v, %v, %v", put, get, rm, other)
+	}
+
+	// A slow Update occupies the cache goroutine, so that later requests are queued
+	release := make(chan struct{})
+	go lru.Update(ctx, "a", func(value any, ok bool) (any, error) {
+		<-release
+		return value, nil
+	})
+	time.Sleep(5 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	wg.Add(4)
+	go func() { defer wg.Done(); lru.Increment(ctx, "n", 1) }()
+	go func() { defer wg.Done(); lru.Contains("a") }()
+	go func() { defer wg.Done(); lru.Evict(1) }()
+	go func() { defer wg.Done(); lru.Pin("a") }()
+	time.Sleep(5 * time.Millisecond)
+
+	put, get, rm, other, _ = lru.ChannelStats()
+	close(release)
+	wg.Wait()
+	if put != 1 || get != 1 || rm != 1 || other != 1 {
+		t.Fatalf("TestBasicCache_ChannelStats failed.  Expected 1 queued request of each kind, got %v, %v, %v, %v", put, get, rm, other)
+	}
+
+	lru.Close()
+
+	if _, _, _, _, err := lru.ChannelStats(); err != ErrAttemptToUseInvalidCache {
+		t.Fatalf("TestBasicCache_ChannelStats failed.  Expected error: %v, got error: %v", ErrAttemptToUseInvalidCache, err)
+	}
+}
+
+func TestBasicCache_Increment(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+	defer lru.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lru.Increment(ctx, "counter", 2)
+		}()
+	}
+	wg.Wait()
+
+	if n, err := lru.Increment(ctx, "counter", -1); err != nil || n != 99 {
+		t.Fatalf("TestBasicCache_Increment failed.  Expected 99, got %v, %v", n, err)
+	}
+
+	lru.Put(ctx, "s", "string")
+	if _, err := lru.Increment(ctx, "s", 1); !errors.Is(err, ErrValueNotInt64) {
+		t.Fatalf("TestBasicCache_Increment failed.  Expected error: %v, got error: %v", ErrValueNotInt64, err)
+	}
+}
+
+func TestBasicCache_OnAccess(t *testing.T) {
+	ctx := context.Background()
+
+	var records []string
+	onAccess := func(op string, key Key, hit bool) {
+		records = append(records, fmt.Sprintf("%s:%v:%v", op, key, hit))
+	}
+
+	lru, _ := NewBasicCache(ctx, 0, 0, WithOnAccess(onAccess))
+	defer lru.Close()
+
+	lru.PutBatch(ctx, []KeyVal{{Key: "a", Value: 1}, {Key: "b", Value: 2}})
+	lru.GetBatch(ctx, []Key{"a", "c"})
+	lru.Remove("a")
+	lru.Remove("c")
+	lru.RemoveBatch([]Key{"b", "d"})
+
+	// Remove hits only for keys that were held
+	expected := []string{"Put:a:true", "Put:b:true", "Get:a:true", "Get:c:false", "Remove:a:true", "Remove:c:false", "Remove:b:true", "Remove:d:false"}
+	if fmt.Sprint(records) != fmt.Sprint(expected) {
+		t.Fatalf("TestBasicCache_OnAccess failed.  Expected %v, got %v", expected, records)
+	}
+}
+
+func TestBasicCache_OnAccessNormalized(t *testing.T) {
+	ctx := context.Background()
+
+	var records []string
+	onAccess := func(op string, key Key, hit bool) {
+		records = append(records, fmt.Sprintf("%s:%v:%v", op, key, hit))
+	}
+	lower := func(key Key) Key { return strings.ToLower(key.(string)) }
+
+	lru, _ := NewBasicCache(ctx, 0, 0, WithOnAccess(onAccess), WithKeyNormalizer(lower))
+	defer lru.Close()
+
+	lru.Put(ctx, "A", 1)
+	lru.PutBatch(ctx, []KeyVal{{Key: "B", Value: 2}})
+	lru.Get(ctx, "A")
+	lru.GetBatch(ctx, []Key{"B", "C"})
+	lru.Remove("A")
+	lru.RemoveBatch([]Key{"B"})
+
+	// Every operation reports the key as held by the cache
+	expected := []string{"Put:a:true", "Put:b:true", "Get:a:true", "Get:b:true", "Get:c:false", "Remove:a:true", "Remove:b:true"}
+	if fmt.Sprint(records) != fmt.Sprint(expected) {
+		t.Fatalf("TestBasicCache_OnAccessNormalized failed.  Expected %v, got %v", expected, records)
+	}
+}
+
+func TestBasicCache_Clone(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 3, 0)
+	defer lru.Close()
+
+	for i := 0; i < 3; i++ {
+		lru.Put(ctx, i, i)
+	}
+	lru.Get(ctx, 0)
+
+	clone, err := lru.Clone(ctx)
+	if err != nil {
+		t.Fatalf("TestBasicCache_Clone failed.  Expected success, but got error %v", err)
+	}
+	defer clone.Close()
+
+	snap, _ := clone.Snapshot()
+	if fmt.Sprint(snap) != "[{0 0} {2 2} {1 1}]" {
+		t.Fatalf("TestBasicCache_Clone failed.  Expected lru order to be preserved, got %v", snap)
+	}
+
+	// Capacity is preserved, so 1 (the least recently used) is evicted
+	clone.Put(ctx, 3, 3)
+	if ok, _ := clone.Contains(1); ok {
+		t.Fatal("TestBasicCache_Clone failed.  Expected 1 to be evicted from clone")
+	}
+	if ok, _ := lru.Contains(1); !ok {
+		t.Fatal("TestBasicCache_Clone failed.  Expected original to be unchanged by clone")
+	}
+}
+
+func TestBasicCache_KeyNotComparable(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+	defer lru.Close()
+
+	for _, key := range []Key{[]int{1}, map[string]int{"a": 1}, struct{ v any }{v: []int{1}}} {
+		if err := lru.Put(ctx, key, 1); !errors.Is(err, ErrKeyNotComparable) {
+			t.Fatalf("TestBasicCache_KeyNotComparable failed.  Expected error: %v, got error: %v", ErrKeyNotComparable, err)
+		}
+		if _, _, err := lru.Get(ctx, key); !errors.Is(err, ErrKeyNotComparable) {
+			t.Fatalf("TestBasicCache_KeyNotComparable failed.  Expected error: %v, got error: %v", ErrKeyNotComparable, err)
+		}
+		if err := lru.Remove(key); !errors.Is(err, ErrKeyNotComparable) {
+			t.Fatalf("TestBasicCache_KeyNotComparable failed.  Expected error: %v, got error: %v", ErrKeyNotComparable, err)
+		}
+	}
+
+	// The cache remains usable
+	if err := lru.Put(ctx, "a", 1); err != nil {
+		t.Fatalf("TestBasicCache_KeyNotComparable failed.  Expected success, but got error %v", err)
+	}
+}
+
+func TestBasicCache_Config(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 10, time.Second, WithTTL(time.Minute))
+	defer lru.Close()
+
+	cfg := lru.Config()
+	if cfg.Capacity != 10 || cfg.Timeout != time.Second || cfg.TTL != time.Minute || cfg.Policy != PolicyLRU || cfg.ChannelBufferSize != requestChannelSize {
+		t.Fatalf("TestBasicCache_Config failed.  Unexpected config %+v", cfg)
+	}
+
+	lru.Resize(5)
+	if cfg := lru.Config(); cfg.Capacity != 5 {
+		t.Fatalf("TestBasicCache_Config failed.  Expected Capacity = 5 after Resize, got %v", cfg.Capacity)
+	}
+}
+
+func TestBasicCache_Order(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 10, 0)
+	defer lru.Close()
+
+	order := func() string {
+		keys, err := lru.Keys()
+		if err != nil {
+			t.Fatalf("TestBasicCache_Order failed.  Expected success, but got error %v", err)
+		}
+		return fmt.Sprint(keys)
+	}
+
+	for _, k := range []string{"a", "b", "c", "d"} {
+		lru.Put(ctx, k, k)
+	}
+
+	if o := order(); o != "[d c b a]" {
+		t.Fatalf("TestBasicCache_Order failed.  Expected [d c b a], got %v", o)
+	}
+
+	// Get promotes to most recently used
+	lru.Get(ctx, "b")
+	if o := order(); o != "[b d c a]" {
+		t.Fatalf("TestBasicCache_Order failed.  Expected [b d c a] after Get, got %v", o)
+	}
+
+	// Contains does not change the order
+	lru.Contains("a")
+	if o := order(); o != "[b d c a]" {
+		t.Fatalf("TestBasicCache_Order failed.  Expected [b d c a] after Contains, got %v", o)
+	}
+
+	// Put of an existing key promotes it
+	lru.Put(ctx, "c", "c")
+	if o := order(); o != "[c b d a]" {
+		t.Fatalf("TestBasicCache_Order failed.  Expected [c b d a] after Put, got %v", o)
+	}
+
+	// Evict removes from the tail
+	for _, expected := range []string{"[c b d]", "[c b]", "[c]", "[]"} {
+		if n, err := lru.Evict(1); n != 1 || err != nil {
+			t.Fatalf("TestBasicCache_Order failed.  Expected Evict to remove 1 item, got %v, %v", n, err)
+		}
+		if o := order(); o != expected {
+			t.Fatalf("TestBasicCache_Order failed.  Expected %v after Evict, got %v", expected, o)
+		}
+	}
+}
+
+func TestBasicCache_Keys(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 3, 0)
+	defer lru.Close()
+
+	for _, k := range []string{"a", "b", "c", "d"} {
+		lru.Put(ctx, k, k)
+	}
+	lru.Get(ctx, "b")
+
+	keys, err := lru.Keys()
+	if err != nil {
+		t.Fatalf("TestBasicCache_Keys failed.  Expected success, but got error %v", err)
+	}
+	if order := fmt.Sprint(keys); order != "[b d c]" {
+		t.Fatalf("TestBasicCache_Keys failed.  Expected [b d c], got %v", order)
+	}
+}
+
+func TestBasicCache_OnPanic(t *testing.T) {
+	ctx := context.Background()
+
+	var recovered []any
+	var lck sync.Mutex
+	onPanic := func(r any, stack []byte) {
+		lck.Lock()
+		defer lck.Unlock()
+		if len(stack) == 0 {
+			t.Error("TestBasicCache_OnPanic failed.  Expected stack to be provided")
+		}
+		recovered = append(recovered, r)
+	}
+
+	onEvict := func(key Key, value any) {
+		panic("evict")
+	}
+
+	lru, _ := NewBasicCache(ctx, 1, 0, WithOnPanic(onPanic), WithOnEvict(onEvict))
+
+	lru.Put(ctx, "a", 1)
+	lru.Put(ctx, "b", 2)
+
+	if _, err := lru.RemoveWhere(func(key Key, value any) bool { panic("pred") }); err == nil {
+		t.Fatal("TestBasicCache_OnPanic failed.  Expected error from panicking predicate")
+	}
+
+	// Closing more than once is expected, so is not reported
+	lru.Close()
+	lru.Close()
+
+	lck.Lock()
+	defer lck.Unlock()
+	if fmt.Sprint(recovered) != "[evict pred]" {
+		t.Fatalf("TestBasicCache_OnPanic failed.  Expected [evict pred], got %v", recovered)
+	}
+}
+
+func TestBasicCache_PutIfVersion(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+	defer lru.Close()
+
+	if ok, err := lru.PutIfVersion(ctx, "a", 1, 0); !ok || err != nil {
+		t.Fatalf("TestBasicCache_PutIfVersion failed.  Expected insert of absent key, got %v, %v", ok, err)
+	}
+
+	v, version, ok, _ := lru.GetWithVersion(ctx, "a")
+	if !ok || v != 1 || version == 0 {
+		t.Fatalf("TestBasicCache_PutIfVersion failed.  Expected 1 with a version, got %v, %v, %v", v, version, ok)
+	}
+
+	if ok, _ := lru.PutIfVersion(ctx, "a", 2, 0); ok {
+		t.Fatal("TestBasicCache_PutIfVersion failed.  Expected insert with version zero to fail for existing key")
+	}
+
+	// An intervening Put changes the version
+	lru.Put(ctx, "a", 3)
+	if ok, _ := lru.PutIfVersion(ctx, "a", 4, version); ok {
+		t.Fatal("TestBasicCache_PutIfVersion failed.  Expected insert with stale version to fail")
+	}
+
+	_, version, _, _ = lru.GetWithVersion(ctx, "a")
+	if ok, _ := lru.PutIfVersion(ctx, "a", 5, version); !ok {
+		t.Fatal("TestBasicCache_PutIfVersion failed.  Expected insert with current version to succeed")
+	}
+	if v, _, _ := lru.Get(ctx, "a"); v != 5 {
+		t.Fatalf("TestBasicCache_PutIfVersion failed.  Expected 5, got %v", v)
+	}
+
+	if _, version, ok, _ := lru.GetWithVersion(ctx, "missing"); ok || version != 0 {
+		t.Fatalf("TestBasicCache_PutIfVersion failed.  Expected version 0 for missing key, got %v", version)
+	}
+}
+
+func TestBasicCache_IdleTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0, WithIdleTimeout(50*time.Millisecond))
+	defer lru.Close()
+
+	// Regular operations keep the cache open beyond the idle timeout
+	for i := 0; i < 10; i++ {
+		if err := lru.Put(ctx, i, i); err != nil {
+			t.Fatalf("TestBasicCache_IdleTimeout failed.  Unexpected error: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if err := lru.Put(ctx, "a", 1); !errors.Is(err, ErrAttemptToUseInvalidCache) {
+		t.Fatalf("TestBasicCache_IdleTimeout failed.  Expected error: %v, got error: %v", ErrAttemptToUseInvalidCache, err)
+	}
+}
+
+func TestBasicCache_Update(t *testing.T) {
+	ctx := context.Background()
+
+	add := func(value any, ok bool) (any, error) {
+		if !ok {
+			return 1, nil
+		}
+		return value.(int) + 1, nil
+	}
+
+	for _, opts := range [][]Option{nil, {WithConcurrentUpdates()}} {
+		lru, _ := NewBasicCache(ctx, 0, 0, opts...)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				lru.Update(ctx, "a", add)
+				lru.Update(ctx, i, add)
+			}()
+		}
+		wg.Wait()
+
+		if v, _, _ := lru.Get(ctx, "a"); v != 50 {
+			t.Fatalf("TestBasicCache_Update failed.  Expected 50, got %v", v)
+		}
+		if l, _ := lru.Len(); l != 51 {
+			t.Fatalf("TestBasicCache_Update failed.  Expected 51 entries, got %d", l)
+		}
+
+		errFailed := errors.New("failed")
+		if _, err := lru.Update(ctx, "a", func(value any, ok bool) (any, error) { return nil, errFailed }); err != errFailed {
+			t.Fatalf("TestBasicCache_Update failed.  Expected error: %v, got error: %v", errFailed, err)
+		}
+		if _, err := lru.Update(ctx, "a", func(value any, ok bool) (any, error) { return nil, nil }); err != ErrInvalidValueToAddToCache {
+			t.Fatalf("TestBasicCache_Update failed.  Expected error: %v, got error: %v", ErrInvalidValueToAddToCache, err)
+		}
+		if v, _ := lru.Update(ctx, "a", add); v != 51 {
+			t.Fatalf("TestBasicCache_Update failed.  Expected value to be unchanged by failed updates, got %v", v)
+		}
+
+		lru.Close()
+
+		if _, err := lru.Update(ctx, "a", add); err != ErrAttemptToUseInvalidCache {
+			t.Fatalf("TestBasicCache_Update failed.  Expected error: %v, got error: %v", ErrAttemptToUseInvalidCache, err)
+		}
+	}
+}
+
+// BenchmarkBasicCache_Update compares Updates made by the goroutine of the cache
+// (the default) with those made under a lock for each key (ConcurrentUpdates).
+// The default wins when the func is fast, as each Update is a single request to the
+// cache; ConcurrentUpdates wins when the func is slow, as Updates of different keys
+// then proceed in parallel rather than being serialised by the cache.
+func BenchmarkBasicCache_Update(b *testing.B) {
+	ctx := context.Background()
+
+	fast := func(value any, ok bool) (any, error) {
+		if !ok {
+			return 1, nil
+		}
+		return value.(int) + 1, nil
+	}
+	slow := func(value any, ok bool) (any, error) {
+		time.Sleep(50 * time.Microsecond)
+		return fast(value, ok)
+	}
+
+	for _, fn := range []struct {
+		name string
+		fn   func(value any, ok bool) (any, error)
+	}{{"Fast", fast}, {"Slow", slow}} {
+		for _, mode := range []struct {
+			name string
+			opts []Option
+		}{{"Cache", nil}, {"KeyLock", []Option{WithConcurrentUpdates()}}} {
+			b.Run(fn.name+mode.name, func(b *testing.B) {
+				lru, _ := NewBasicCache(ctx, 0, 0, mode.opts...)
+				defer lru.Close()
+
+				// Ensure several goroutines make Updates, even with few CPUs
+				b.SetParallelism(8)
+
+				var n atomic.Int64
+				b.RunParallel(func(pb *testing.PB) {
+					key := n.Add(1)
+					for pb.Next() {
+						lru.Update(ctx, key, fn.fn)
+					}
+				})
+			})
+		}
+	}
+}
+
+func BenchmarkBasicCache_LockOSThread(b *testing.B) {
+	ctx := context.Background()
+
+	for _, mode := range []struct {
+		name string
+		opts []Option
+	}{{"Default", nil}, {"Locked", []Option{WithLockOSThread()}}} {
+		b.Run(mode.name, func(b *testing.B) {
+			lru, _ := NewBasicCache(ctx, 0, 0, mode.opts...)
+			defer lru.Close()
+			lru.Put(ctx, 1, 1)
+
+			// Busy goroutines compete with the cache for the scheduler
+			stop := make(chan struct{})
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						select {
+						case <-stop:
+							return
+						default:
+							runtime.Gosched()
+						}
+					}
+				}()
+			}
+			defer func() {
+				close(stop)
+				wg.Wait()
+			}()
+
+			latencies := make([]time.Duration, b.N)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				start := time.Now()
+				lru.Get(ctx, 1)
+				latencies[i] = time.Since(start)
+			}
+			b.StopTimer()
+
+			slices.Sort(latencies)
+			b.ReportMetric(float64(latencies[b.N/2].Nanoseconds()), "p50-ns")
+			b.ReportMetric(float64(latencies[b.N*99/100].Nanoseconds()), "p99-ns")
+		})
+	}
+}
+
+func TestBasicCache_GetEntry(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+	defer lru.Close()
+
+	if e, err := lru.GetEntry(ctx, "a"); e != nil || err != nil {
+		t.Fatalf("TestBasicCache_GetEntry failed.  Expected nil Entry for missing key, got %v, %v", e, err)
+	}
+
+	before := time.Now()
+	lru.Put(ctx, "a", "hello")
+	lru.Put(ctx, "b", 1)
+	lru.Get(ctx, "a")
+	lru.Get(ctx, "a")
+
+	e, err := lru.GetEntry(ctx, "a")
+	if err != nil || e == nil {
+		t.Fatalf("TestBasicCache_GetEntry failed.  Unexpected result: %v, %v", e, err)
+	}
+	if e.Key != "a" || e.Value != "hello" {
+		t.Fatalf("TestBasicCache_GetEntry failed.  Expected a: hello, got %v: %v", e.Key, e.Value)
+	}
+	if e.AccessCount != 2 {
+		t.Fatalf("TestBasicCache_GetEntry failed.  Expected AccessCount of 2, got %d", e.AccessCount)
+	}
+	if e.InsertedAt.Before(before) || e.LastAccessed.Before(e.InsertedAt) {
+		t.Fatalf("TestBasicCache_GetEntry failed.  Unexpected times: %v, %v", e.InsertedAt, e.LastAccessed)
+	}
+	if e.Size != EstimateSize("hello") {
+		t.Fatalf("TestBasicCache_GetEntry failed.  Expected Size %d, got %d", EstimateSize("hello"), e.Size)
+	}
+	if !e.ExpiresAt.IsZero() || e.Version == 0 {
+		t.Fatalf("TestBasicCache_GetEntry failed.  Unexpected expiry or version: %v, %d", e.ExpiresAt, e.Version)
+	}
+
+	// GetEntry does not count as an access, nor change the lru status
+	if e, _ := lru.GetEntry(ctx, "a"); e.AccessCount != 2 {
+		t.Fatalf("TestBasicCache_GetEntry failed.  Expected AccessCount to remain 2, got %d", e.AccessCount)
+	}
+	lru.GetEntry(ctx, "b")
+	if keys, _ := lru.Keys(); keys[0] != "a" {
+		t.Fatalf("TestBasicCache_GetEntry failed.  Expected a to remain most recently used, got %v", keys)
+	}
+}
+
+func TestBasicCache_GetBatchInto(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+	defer lru.Close()
+
+	lru.PutBatch(ctx, []KeyVal{{Key: "a", Value: 1}, {Key: "b", Value: 2}})
+
+	res, err := lru.GetBatchInto(ctx, []Key{"a", "b", "c"}, nil)
+	if err != nil || len(res) != 3 {
+		t.Fatalf("TestBasicCache_GetBatchInto failed.  Unexpected result: %v, %v", res, err)
+	}
+	first := res[0]
+
+	// Reuse the slice, and the CacheResults it holds
+	res, err = lru.GetBatchInto(ctx, []Key{"b", "c"}, res[:0])
+	if err != nil || len(res) != 2 {
+		t.Fatalf("TestBasicCache_GetBatchInto failed.  Unexpected result: %v, %v", res, err)
+	}
+	if res[0] != first {
+		t.Fatal("TestBasicCache_GetBatchInto failed.  Expected CacheResult to be reused")
+	}
+	if res[0].Key != "b" || res[0].Value != 2 || !res[0].OK || res[1].Key != "c" || res[1].OK {
+		t.Fatalf("TestBasicCache_GetBatchInto failed.  Unexpected results: %v, %v", res[0], res[1])
+	}
+
+	// Existing results in dst are retained
+	res, _ = lru.GetBatchInto(ctx, []Key{"a"}, res)
+	if len(res) != 3 || res[0].Key != "b" || res[2].Key != "a" || res[2].Value != 1 {
+		t.Fatalf("TestBasicCache_GetBatchInto failed.  Unexpected results: %v", res)
+	}
+}
+
+func TestBasicCache_GetBatchIntoReuseAfterTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 10*time.Millisecond)
+	defer lru.Close()
+
+	keys := []Key{1, 2}
+	lru.PutBatch(ctx, []KeyVal{{Key: 1, Value: 1}, {Key: 2, Value: 2}})
+	dst, _ := lru.GetBatchInto(ctx, keys, nil)
+
+	// A slow Update occupies the cache goroutine, so that the GetBatchInto times out
+	// whilst its request is still queued
+	go lru.Update(ctx, 1, func(value any, ok bool) (any, error) {
+		time.Sleep(50 * time.Millisecond)
+		return value, nil
+	})
+	time.Sleep(time.Millisecond)
+
+	if _, err := lru.GetBatchInto(ctx, keys, dst[:0]); err != ErrTimeout {
+		t.Fatalf("TestBasicCache_GetBatchIntoReuseAfterTimeout failed.  Expected error: %v, got error: %v", ErrTimeout, err)
+	}
+
+	// dst is reused by the caller whilst the abandoned request is processed,
+	// which the race detector reports should the cache goroutine write to it
+	for i := 0; i < 10; i++ {
+		for _, r := range dst {
+			r.Value = i
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	lru.SetTimeout(0)
+	res, err := lru.GetBatchInto(ctx, keys, dst[:0])
+	if err != nil || len(res) != 2 || res[0].Value != 1 || res[1].Value != 2 {
+		t.Fatalf("TestBasicCache_GetBatchIntoReuseAfterTimeout failed.  Expected values 1 and 2, got %v", err)
+	}
+}
+
+func BenchmarkBasicCache_GetBatchInto(b *testing.B) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+	defer lru.Close()
+
+	keys := []Key{}
+	for i := 0; i < 10; i++ {
+		lru.Put(ctx, i, i)
+		keys = append(keys, i)
+	}
+
+	b.Run("GetBatch", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			lru.GetBatch(ctx, keys)
+		}
+	})
+	b.Run("GetBatchInto", func(b *testing.B) {
+		b.ReportAllocs()
+		var res []*CacheResult
+		for i := 0; i < b.N; i++ {
+			res, _ = lru.GetBatchInto(ctx, keys, res[:0])
+		}
+	})
+}
+
+func TestBasicCache_AllowNilValues(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+	defer lru.Close()
+
+	if err := lru.Put(ctx, "a", nil); err != ErrInvalidValueToAddToCache {
+		t.Fatalf("TestBasicCache_AllowNilValues failed.  Expected error: %v, got error: %v", ErrInvalidValueToAddToCache, err)
+	}
+
+	copier := func(v any) any { return v.(string) + "!" }
+	lru, _ = NewBasicCache(ctx, 0, 0, WithAllowNilValues(), WithCopyOnGet(copier), WithCopyOnPut(copier))
+	defer lru.Close()
+
+	if err := lru.PutBatch(ctx, []KeyVal{{Key: "a", Value: nil}, {Key: "b", Value: "b"}}); err != nil {
+		t.Fatalf("TestBasicCache_AllowNilValues failed.  Unexpected error: %v", err)
+	}
+
+	if v, ok, err := lru.Get(ctx, "a"); v != nil || !ok || err != nil {
+		t.Fatalf("TestBasicCache_AllowNilValues failed.  Expected cached nil, got %v, %v, %v", v, ok, err)
+	}
+	if v, ok, _ := lru.Get(ctx, "b"); v != "b!!" || !ok {
+		t.Fatalf("TestBasicCache_AllowNilValues failed.  Expected b!!, got %v, %v", v, ok)
+	}
+	if v, ok, _ := lru.Get(ctx, "c"); v != nil || ok {
+		t.Fatalf("TestBasicCache_AllowNilValues failed.  Expected c not to be found, got %v, %v", v, ok)
+	}
+	if has, _ := lru.Contains("a"); !has {
+		t.Fatal("TestBasicCache_AllowNilValues failed.  Expected a to be held")
+	}
+}
+
+func TestBasicCache_SaturatedTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 50*time.Millisecond)
+	defer lru.Close()
+
+	// Block the cache, and fill the queue of puts behind it
+	release := make(chan struct{})
+	started := make(chan struct{})
+	lru.Put(ctx, "a", 1)
+	go lru.ForEach(func(key Key, value any) bool {
+		close(started)
+		<-release
+		return false
+	})
+	<-started
+	for i := 0; i < requestChannelSize; i++ {
+		lru.put <- &putRequest{kvs: []KeyVal{{Key: i, Value: i}}, c: make(chan struct{}, 1)}
+	}
+
+	start := time.Now()
+	err := lru.Put(ctx, "b", 2)
+	elapsed := time.Since(start)
+	close(release)
+
+	if err != ErrTimeout {
+		t.Fatalf("TestBasicCache_SaturatedTimeout failed.  Expected error: %v, got error: %v", ErrTimeout, err)
+	}
+	if elapsed > 200*time.Millisecond {
+		t.Fatalf("TestBasicCache_SaturatedTimeout failed.  Expected timeout after 50ms, took %v", elapsed)
+	}
+
+	// The cache recovers once unblocked, having responded to the abandoned requests
+	if err := lru.Put(ctx, "c", 3); err != nil {
+		t.Fatalf("TestBasicCache_SaturatedTimeout failed.  Unexpected error: %v", err)
+	}
+	if l, _ := lru.Len(); l != requestChannelSize+2 {
+		t.Fatalf("TestBasicCache_SaturatedTimeout failed.  Expected %d items, got %d", requestChannelSize+2, l)
+	}
+}
+
+func TestBasicCache_SkipNilCheck(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0, WithSkipNilCheck())
+	defer lru.Close()
+
+	if err := lru.PutBatch(ctx, []KeyVal{{Key: "a", Value: 1}, {Key: "b", Value: nil}, {Key: "c", Value: 3}}); err != nil {
+		t.Fatalf("TestBasicCache_SkipNilCheck failed.  Unexpected error: %v", err)
+	}
+	if l, _ := lru.Len(); l != 3 {
+		t.Fatalf("TestBasicCache_SkipNilCheck failed.  Expected 3 entries, got %d", l)
+	}
+	if v, ok, _ := lru.Get(ctx, "b"); v != nil || !ok {
+		t.Fatalf("TestBasicCache_SkipNilCheck failed.  Expected nil value to be stored, got %v, %v", v, ok)
+	}
+}
+
+func TestBasicCache_GetRaw(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+	defer lru.Close()
+
+	lru.PutWithTTL(ctx, "short", 1, 10*time.Millisecond)
+	lru.Put(ctx, "live", 2)
+
+	if v, state, err := lru.GetRaw("live"); v != 2 || state != EntryLive || err != nil {
+		t.Fatalf("TestBasicCache_GetRaw failed.  Expected live 2, got %v, %v, %v", v, state, err)
+	}
+	if v, state, err := lru.GetRaw("missing"); v != nil || state != EntryAbsent || err != nil {
+		t.Fatalf("TestBasicCache_GetRaw failed.  Expected absent, got %v, %v, %v", v, state, err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	// Expired entries are reported, without being removed
+	for i := 0; i < 2; i++ {
+		if v, state, _ := lru.GetRaw("short"); v != 1 || state != EntryExpired {
+			t.Fatalf("TestBasicCache_GetRaw failed.  Expected expired 1, got %v, %v", v, state)
+		}
+	}
+
+	// Retrieval removes the expired entry
+	lru.Get(ctx, "short")
+	if _, state, _ := lru.GetRaw("short"); state != EntryAbsent {
+		t.Fatalf("TestBasicCache_GetRaw failed.  Expected absent after Get, got %v", state)
+	}
+}
+
+func TestBasicCache_EvictionBatchSize(t *testing.T) {
+	ctx := context.Background()
+
+	var evictions atomic.Int64
+	lru, _ := NewBasicCache(ctx, 100, 0,
+		WithEvictionBatchSize(10),
+		WithOnEvict(func(key Key, value any) { evictions.Add(1) }))
+	defer lru.Close()
+
+	for i := 0; i < 100; i++ {
+		lru.Put(ctx, i, i)
+	}
+
+	evicted, err := lru.Resize(10)
+	if err != nil {
+		t.Fatalf("TestBasicCache_EvictionBatchSize failed.  Unexpected error: %v", err)
+	}
+	if len(evicted) != 10 || evicted[0].Key != 0 {
+		t.Fatalf("TestBasicCache_EvictionBatchSize failed.  Expected the 10 oldest entries to be evicted by Resize, got %v", evicted)
+	}
+
+	// The remaining excess is evicted in subsequent batches
+	deadline := time.Now().Add(time.Second)
+	for l, _ := lru.Len(); l != 10; l, _ = lru.Len() {
+		if time.Now().After(deadline) {
+			t.Fatalf("TestBasicCache_EvictionBatchSize failed.  Expected Len to reach 10, got %d", l)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := evictions.Load(); n != 90 {
+		t.Fatalf("TestBasicCache_EvictionBatchSize failed.  Expected 90 evictions, got %d", n)
+	}
+	if v, ok, _ := lru.Get(ctx, 99); !ok || v != 99 {
+		t.Fatalf("TestBasicCache_EvictionBatchSize failed.  Expected most recent entry to be retained, got %v, %v", v, ok)
+	}
+}
+
+func TestBasicCache_RemoveContext(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 10, 0)
+	defer lru.Close()
+
+	lru.PutBatch(ctx, []KeyVal{{Key: 1, Value: 1}, {Key: 2, Value: 2}, {Key: 3, Value: 3}})
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if err := lru.RemoveContext(cctx, 1); err != ErrInvalidContext {
+		t.Fatalf("TestBasicCache_RemoveContext failed.  Expected ErrInvalidContext, got %v", err)
+	}
+	if _, err := lru.RemoveBatchContext(cctx, []Key{2, 3}); err != ErrInvalidContext {
+		t.Fatalf("TestBasicCache_RemoveContext failed.  Expected ErrInvalidContext for batch, got %v", err)
+	}
+	if l, _ := lru.Len(); l != 3 {
+		t.Fatalf("TestBasicCache_RemoveContext failed.  Expected all entries to remain, got %d", l)
+	}
+
+	if err := lru.RemoveContext(ctx, 1); err != nil {
+		t.Fatalf("TestBasicCache_RemoveContext failed.  Unexpected error: %v", err)
+	}
+	if n, err := lru.RemoveBatchContext(ctx, []Key{2, 3, 4}); err != nil || n != 2 {
+		t.Fatalf("TestBasicCache_RemoveContext failed.  Expected 2 removals, got %d, %v", n, err)
+	}
+	if l, _ := lru.Len(); l != 0 {
+		t.Fatalf("TestBasicCache_RemoveContext failed.  Expected empty cache, got %d", l)
+	}
+}
+
+func TestBasicCache_Swap(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+	defer lru.Close()
+
+	old, existed, err := lru.Swap(ctx, "a", 1)
+	if err != nil || existed || old != nil {
+		t.Fatalf("TestBasicCache_Swap failed.  Expected absent key, got %v, %v, %v", old, existed, err)
+	}
+
+	old, existed, err = lru.Swap(ctx, "a", 2)
+	if err != nil || !existed || old != 1 {
+		t.Fatalf("TestBasicCache_Swap failed.  Expected previous value 1, got %v, %v, %v", old, existed, err)
+	}
+	if v, ok, _ := lru.Get(ctx, "a"); !ok || v != 2 {
+		t.Fatalf("TestBasicCache_Swap failed.  Expected new value 2, got %v, %v", v, ok)
+	}
+
+	if _, _, err := lru.Swap(ctx, "a", nil); !errors.Is(err, ErrInvalidValueToAddToCache) {
+		t.Fatalf("TestBasicCache_Swap failed.  Expected error: %v, got error: %v", ErrInvalidValueToAddToCache, err)
+	}
+	if v, _, _ := lru.Get(ctx, "a"); v != 2 {
+		t.Fatalf("TestBasicCache_Swap failed.  Expected value to be unchanged, got %v", v)
+	}
+
+	// Concurrent swaps each observe a distinct previous value
+	var wg sync.WaitGroup
+	seen := make(chan any, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			old, _, _ := lru.Swap(ctx, "b", i)
+			seen <- old
+		}(i)
+	}
+	wg.Wait()
+	close(seen)
+	distinct := map[any]bool{}
+	for old := range seen {
+		if distinct[old] {
+			t.Fatalf("TestBasicCache_Swap failed.  Previous value %v returned twice", old)
+		}
+		distinct[old] = true
+	}
+}
+
+func TestBasicCache_Merge(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+	defer lru.Close()
+
+	sum := func(existing, incoming any) any {
+		return existing.(int) + incoming.(int)
+	}
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := lru.Merge(ctx, "total", i, sum); err != nil {
+				t.Errorf("TestBasicCache_Merge failed.  Unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if v, ok, _ := lru.Get(ctx, "total"); !ok || v != 5050 {
+		t.Fatalf("TestBasicCache_Merge failed.  Expected 5050, got %v, %v", v, ok)
+	}
+
+	if err := lru.Merge(ctx, "total", 1, nil); !errors.Is(err, ErrInvalidMerge) {
+		t.Fatalf("TestBasicCache_Merge failed.  Expected error: %v, got error: %v", ErrInvalidMerge, err)
+	}
+
+	// A panic in merge leaves the value unchanged
+	if err := lru.Merge(ctx, "total", "x", sum); err == nil {
+		t.Fatal("TestBasicCache_Merge failed.  Expected error from panic in merge")
+	}
+	if v, _, _ := lru.Get(ctx, "total"); v != 5050 {
+		t.Fatalf("TestBasicCache_Merge failed.  Expected value to be unchanged, got %v", v)
+	}
+}
+
+func TestBasicCache_GetOrLoadWithTTL(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0, WithTTL(time.Hour))
+	defer lru.Close()
+
+	calls := 0
+	loader := func(ctx context.Context, key Key) (any, error) {
+		calls++
+		if key == "bad" {
+			return nil, errors.New("failed")
+		}
+		return calls, nil
+	}
+
+	v, err := lru.GetOrLoadWithTTL(ctx, "a", 20*time.Millisecond, loader)
+	if err != nil || v != 1 {
+		t.Fatalf("TestBasicCache_GetOrLoadWithTTL failed.  Expected 1, got %v, %v", v, err)
+	}
+	_, expires, _, _ := lru.GetWithExpiry(ctx, "a")
+	if time.Until(expires) > 20*time.Millisecond {
+		t.Fatalf("TestBasicCache_GetOrLoadWithTTL failed.  Expected the ttl to be applied, got expiry %v", expires)
+	}
+
+	// Held values are returned without loading
+	if v, _ := lru.GetOrLoadWithTTL(ctx, "a", 20*time.Millisecond, loader); v != 1 || calls != 1 {
+		t.Fatalf("TestBasicCache_GetOrLoadWithTTL failed.  Expected held value 1, got %v after %d calls", v, calls)
+	}
+
+	// Zero applies the default TTL
+	lru.GetOrLoad(ctx, "b", loader)
+	if _, expires, _, _ := lru.GetWithExpiry(ctx, "b"); time.Until(expires) < 59*time.Minute {
+		t.Fatalf("TestBasicCache_GetOrLoadWithTTL failed.  Expected the default ttl to be applied, got expiry %v", expires)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if v, _ := lru.GetOrLoadWithTTL(ctx, "a", 0, loader); v != 3 {
+		t.Fatalf("TestBasicCache_GetOrLoadWithTTL failed.  Expected expired value to be reloaded, got %v", v)
+	}
+
+	if _, err := lru.GetOrLoad(ctx, "bad", loader); err == nil {
+		t.Fatal("TestBasicCache_GetOrLoadWithTTL failed.  Expected loader error")
+	}
+	if ok, _ := lru.Contains("bad"); ok {
+		t.Fatal("TestBasicCache_GetOrLoadWithTTL failed.  Expected nothing to be added on error")
+	}
+
+	if _, err := lru.GetOrLoadWithTTL(ctx, "a", -1, loader); !errors.Is(err, ErrInvalidTTL) {
+		t.Fatalf("TestBasicCache_GetOrLoadWithTTL failed.  Expected error: %v, got error: %v", ErrInvalidTTL, err)
+	}
+}
+
+func BenchmarkBasicCache_Get(b *testing.B) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0, WithTracingDisabled())
+	defer lru.Close()
+	lru.Put(ctx, 1, 1)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lru.Get(ctx, 1)
+	}
+}
+
+func TestBasicCache_GetMatchesGetBatch(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+	lru.Put(ctx, 1, 1)
+
+	for _, key := range []Key{1, 2, []int{1}} {
+		v, ok, err := lru.Get(ctx, key)
+		res, berr := lru.GetBatch(ctx, []Key{key})
+		if fmt.Sprint(err) != fmt.Sprint(berr) {
+			t.Fatalf("TestBasicCache_GetMatchesGetBatch failed.  Expected error %v, got %v", berr, err)
+		}
+		if berr == nil && (v != res[0].Value || ok != res[0].OK) {
+			t.Fatalf("TestBasicCache_GetMatchesGetBatch failed.  Expected %v, %v, got %v, %v", res[0].Value, res[0].OK, v, ok)
+		}
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, _, err := lru.Get(cctx, 1); err != ErrInvalidContext {
+		t.Fatalf("TestBasicCache_GetMatchesGetBatch failed.  Expected error: %v, got error: %v", ErrInvalidContext, err)
+	}
+
+	lru.Close()
+	if _, _, err := lru.Get(ctx, 1); err != ErrAttemptToUseInvalidCache {
+		t.Fatalf("TestBasicCache_GetMatchesGetBatch failed.  Expected error: %v, got error: %v", ErrAttemptToUseInvalidCache, err)
+	}
+}
+
+func TestBasicCache_SetTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, time.Second)
+
+	if err := lru.SetTimeout(100 * time.Millisecond); err != nil {
+		t.Fatalf("TestBasicCache_SetTimeout failed.  Unexpected error: %v", err)
+	}
+	if d := lru.Config().Timeout; d != 100*time.Millisecond {
+		t.Fatalf("TestBasicCache_SetTimeout failed.  Expected timeout of 100ms, got %v", d)
+	}
+
+	// The new timeout applies to subsequent operations
+	lru.Put(ctx, 1, 1)
+	if v, ok, err := lru.Get(ctx, 1); err != nil || !ok || v != 1 {
+		t.Fatalf("TestBasicCache_SetTimeout failed.  Expected 1, got %v, %v, %v", v, ok, err)
+	}
+
+	lru.SetTimeout(0)
+	if d := lru.Config().Timeout; d != infiniteTimeout {
+		t.Fatalf("TestBasicCache_SetTimeout failed.  Expected infinite timeout, got %v", d)
+	}
+
+	lru.Close()
+	if err := lru.SetTimeout(time.Second); err != ErrAttemptToUseInvalidCache {
+		t.Fatalf("TestBasicCache_SetTimeout failed.  Expected error: %v, got error: %v", ErrAttemptToUseInvalidCache, err)
+	}
+}
+
+func TestGetBatch_Empty(t *testing.T) {
+	ctx := context.Background()
+
+	basic, _ := NewBasicCache(ctx, 0, 0)
+	arc, _ := NewARCCache(ctx, 10, 0)
+	loading, _ := NewLoadingCache(ctx, NewMapLoader(map[Key]any{}), 0, 0)
+	a, _ := NewBasicCache(ctx, 0, 0)
+	partitioned, _ := NewPartitionedCache(ctx, func(key Key) (Partition, error) { return "A", nil }, []PartitionInfo{{Name: "A", Cache: a}})
+
+	for _, c := range []Cache{basic, arc, loading, partitioned} {
+		for _, keys := range [][]Key{nil, {}} {
+			res, err := c.GetBatch(ctx, keys)
+			if err != nil || res == nil || len(res) != 0 {
+				t.Fatalf("TestGetBatch_Empty failed.  Expected empty results from %T, got %v, %v", c, res, err)
+			}
+		}
+		c.Close()
+	}
+}
+
+func BenchmarkBasicCache_Fill(b *testing.B) {
+	ctx := context.Background()
+
+	const entries = 1_000_000
+	const batchSize = 1000
+
+	batches := make([][]KeyVal, 0, entries/batchSize)
+	for i := 0; i < entries; i += batchSize {
+		batch := make([]KeyVal, batchSize)
+		for j := range batch {
+			batch[j] = KeyVal{Key: i + j, Value: i + j}
+		}
+		batches = append(batches, batch)
+	}
+
+	for _, mode := range []struct {
+		name string
+		opts []Option
+	}{{"Default", nil}, {"PresizeMap", []Option{WithPresizeMap()}}} {
+		b.Run(mode.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				lru, _ := NewBasicCache(ctx, entries, 0, append(mode.opts, WithTracingDisabled())...)
+				for _, batch := range batches {
+					lru.PutBatch(ctx, batch)
+				}
+				lru.Close()
+			}
+		})
+	}
+}
+
+func TestBasicCache_PresizeMap(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 2, 0, WithPresizeMap())
+	defer lru.Close()
+
+	for i := 0; i < 3; i++ {
+		lru.Put(ctx, i, i)
+	}
+	lru.Clear()
+	for i := 0; i < 3; i++ {
+		lru.Put(ctx, i, i)
+	}
+
+	if n, _ := lru.Len(); n != 2 {
+		t.Fatalf("TestBasicCache_PresizeMap failed.  Expected 2 entries, got %d", n)
+	}
+	if _, ok, _ := lru.Get(ctx, 0); ok {
+		t.Fatal("TestBasicCache_PresizeMap failed.  Expected 0 to be evicted")
+	}
+}
@@ -28,7 +28,7 @@ func ExampleNewBasicCache() {
 
 	sizeUnchanged, _ := cache.Len() // Has entry
 
-	cache.Remove(key) // Removed
+	cache.RemoveContext(ctx, key) // Removed
 
 	size0, _ := cache.Len() // Now empty
 
@@ -37,3 +37,12 @@ func ExampleNewBasicCache() {
 	fmt.Println(val == v, size1, sizeUnchanged, size0, ok)
 	// Output: true 1 1 0 false
 }
+
+// Each of the caches implements the Cache interface
+var (
+	_ Cache = (*BasicCache)(nil)
+	_ Cache = (*ARCCache)(nil)
+	_ Cache = (*LoadingCache)(nil)
+	_ Cache = (*PartitionedCache)(nil)
+	_ Cache = (*TieredCache)(nil)
+)
@@ -0,0 +1,146 @@
+package lru
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// SlabbedCache is a cache of fixed size byte buffers, which are drawn from a pool
+// and returned to it once they leave the cache, so that filling the cache does not
+// allocate a new buffer for each entry.  This suits values of a uniform size, where
+// the allocation of buffers would otherwise create work for the garbage collector.
+//
+// Ownership of buffers is as follows:
+//   - Buffer hands out a buffer from the pool, which the caller owns until it is Put
+//   - Put passes ownership of the buffer to the cache, so the caller must not use it again
+//   - Get returns the buffer held by the cache, which remains owned by the cache; it must
+//     not be modified, and must not be used once its key is Put, Removed or evicted, as it
+//     may then be handed out by Buffer and overwritten.  Callers that need the value for
+//     longer should copy it.
+//
+// Buffers are recycled when they are evicted to maintain the capacity of the cache, by
+// Resize or Clear, or replaced by Put.  Buffers that are Removed, expire, or are held
+// when the cache is closed are left to the garbage collector.
+type SlabbedCache struct {
+	cache *BasicCache
+	size  int
+	reset func([]byte)
+	pool  sync.Pool
+}
+
+// Buffer returns a buffer of the size of the buffers of the cache, from the pool
+// if one is available.  The caller owns the buffer until it is passed to Put.
+func (s *SlabbedCache) Buffer() []byte {
+	return *s.pool.Get().(*[]byte)
+}
+
+// recycle resets the buffer and returns it to the pool
+func (s *SlabbedCache) recycle(value any) {
+	buf, ok := value.([]byte)
+	if !ok || cap(buf) < s.size {
+		return
+	}
+	buf = buf[:s.size]
+	if s.reset != nil {
+		s.reset(buf)
+	}
+	s.pool.Put(&buf)
+}
+
+// Put inserts the buffer at the specified key, replacing (and recycling) any prior buffer.
+// Ownership of buf passes to the cache.  ErrBufferSizeMismatch is returned if buf
+// is not the size of the buffers of the cache, in which case it remains with the caller.
+func (s *SlabbedCache) Put(ctx context.Context, key Key, buf []byte) error {
+	if len(buf) != s.size {
+		return ErrBufferSizeMismatch
+	}
+	old, existed, err := s.cache.Swap(ctx, key, buf)
+	if err != nil {
+		return err
+	}
+	if existed {
+		s.recycle(old)
+	}
+	return nil
+}
+
+// Get retrieves the buffer at the specified key, which remains owned by the cache
+func (s *SlabbedCache) Get(ctx context.Context, key Key) ([]byte, bool, error) {
+	v, ok, err := s.cache.Get(ctx, key)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return v.([]byte), true, nil
+}
+
+// Remove evicts the key and its associated buffer
+func (s *SlabbedCache) Remove(ctx context.Context, key Key) error {
+	return s.cache.RemoveContext(ctx, key)
+}
+
+// Len returns the number of buffers held by the cache
+func (s *SlabbedCache) Len() (int, error) {
+	return s.cache.Len()
+}
+
+// Resize changes the capacity of the cache, recycling the buffers that are evicted
+func (s *SlabbedCache) Resize(maxEntries int) error {
+	_, err := s.cache.Resize(maxEntries)
+	return err
+}
+
+// Clear removes all the buffers from the cache, recycling them
+func (s *SlabbedCache) Clear() error {
+	_, err := s.cache.Clear()
+	return err
+}
+
+// Close empties the cache, releases all resources
+func (s *SlabbedCache) Close() {
+	s.cache.Close()
+}
+
+var ErrInvalidBufferSize = errors.New("bufferSize must be a positive integer")
+
+var ErrBufferSizeMismatch = errors.New("buffer does not have the size of the buffers of the cache")
+
+// NewSlabbedCache creates a new cache of buffers of bufferSize bytes, with the specified
+// capacity and timeout for request processing, as for NewBasicCache.
+// reset, if provided, is applied to each buffer as it is recycled (for example, to
+// zero it), so that its prior contents are not visible to the next user.
+// Any OnEvict in opts is called before the evicted buffer is recycled.
+// Close() should be called when the cache is no longer needed, to release resources
+func NewSlabbedCache(ctx context.Context, maxEntries int, timeout time.Duration, bufferSize int, reset func([]byte), opts ...Option) (*SlabbedCache, error) {
+	if bufferSize <= 0 {
+		return nil, ErrInvalidBufferSize
+	}
+
+	s := &SlabbedCache{
+		size:  bufferSize,
+		reset: reset,
+	}
+	s.pool.New = func() any {
+		buf := make([]byte, bufferSize)
+		return &buf
+	}
+
+	recycleOnEvict := func(o *Options) {
+		onEvict := o.OnEvict
+		o.OnEvict = func(key Key, value any) {
+			if onEvict != nil {
+				onEvict(key, value)
+			}
+			s.recycle(value)
+		}
+	}
+
+	c, err := NewBasicCache(ctx, maxEntries, timeout, append(opts[:len(opts):len(opts)], recycleOnEvict)...)
+	if err != nil {
+		return nil, err
+	}
+	s.cache = c
+
+	return s, nil
+}
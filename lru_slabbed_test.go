@@ -0,0 +1,79 @@
+package lru
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNewSlabbedCache(t *testing.T) {
+	if _, err := NewSlabbedCache(context.Background(), 10, 0, 0, nil); err != ErrInvalidBufferSize {
+		t.Fatalf("TestNewSlabbedCache failed.  Expected error: %v, got error: %v", ErrInvalidBufferSize, err)
+	}
+}
+
+func TestSlabbedCache_Recycle(t *testing.T) {
+	ctx := context.Background()
+
+	resets := 0
+	reset := func(buf []byte) {
+		resets++
+		clear(buf)
+	}
+
+	evicted := []Key{}
+	s, _ := NewSlabbedCache(ctx, 2, 0, 4, reset, WithOnEvict(func(key Key, value any) {
+		evicted = append(evicted, key)
+	}))
+	defer s.Close()
+
+	for i := 0; i < 3; i++ {
+		buf := s.Buffer()
+		if len(buf) != 4 {
+			t.Fatalf("TestSlabbedCache_Recycle failed.  Expected buffer of 4 bytes, got %d", len(buf))
+		}
+		buf[0] = byte(i)
+		if err := s.Put(ctx, i, buf); err != nil {
+			t.Fatalf("TestSlabbedCache_Recycle failed.  Unexpected error: %v", err)
+		}
+	}
+
+	// Key 0 is evicted to maintain capacity, and its buffer recycled
+	if resets != 1 || len(evicted) != 1 || evicted[0] != 0 {
+		t.Fatalf("TestSlabbedCache_Recycle failed.  Expected eviction of 0 to be recycled, got %d resets, evictions %v", resets, evicted)
+	}
+	if buf, ok, _ := s.Get(ctx, 2); !ok || buf[0] != 2 {
+		t.Fatalf("TestSlabbedCache_Recycle failed.  Expected buffer for 2, got %v, %v", buf, ok)
+	}
+
+	// Replaced buffers are recycled
+	s.Put(ctx, 2, s.Buffer())
+	if resets != 2 {
+		t.Fatalf("TestSlabbedCache_Recycle failed.  Expected replaced buffer to be recycled, got %d resets", resets)
+	}
+
+	s.Clear()
+	if resets != 4 {
+		t.Fatalf("TestSlabbedCache_Recycle failed.  Expected cleared buffers to be recycled, got %d resets", resets)
+	}
+
+	if err := s.Put(ctx, 1, make([]byte, 5)); err != ErrBufferSizeMismatch {
+		t.Fatalf("TestSlabbedCache_Recycle failed.  Expected error: %v, got error: %v", ErrBufferSizeMismatch, err)
+	}
+}
+
+func TestNewSlabbedCache_Options(t *testing.T) {
+	ctx := context.Background()
+
+	// Spare capacity in opts must not be written by the constructor
+	opts := make([]Option, 1, 2)
+	opts[0] = WithTTL(time.Minute)
+	spare := opts[:2]
+
+	s, _ := NewSlabbedCache(ctx, 10, 0, 4, nil, opts...)
+	defer s.Close()
+
+	if spare[1] != nil {
+		t.Fatal("TestNewSlabbedCache_Options failed.  Expected the options of the caller to be unchanged")
+	}
+}
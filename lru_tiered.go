@@ -0,0 +1,344 @@
+package lru
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// TieredCache is an implementation of a Cache that fronts a larger (typically
+// slower) L2 cache with a smaller L1 cache.  Retrievals check L1 first, falling
+// back to L2, with L2 hits promoted into L1.
+type TieredCache struct {
+	privateImp
+	o      Options
+	l1     Cache
+	l2     Cache
+	behind sync.WaitGroup
+	// writes queues the writes to L2 when TieredWriteBehind is set, so that they
+	// are applied in order by a single goroutine
+	writes chan *tieredWrite
+	// lck guards closed and the sending of writes, so that none is queued once Close
+	// closes the queue
+	lck    sync.Mutex
+	closed bool
+	// stop releases the closing of the cache when its context completes
+	stop func() bool
+
+	l1Hits          atomic.Uint64
+	l2Hits          atomic.Uint64
+	misses          atomic.Uint64
+	promotionErrors atomic.Uint64
+}
+
+// TieredStats reports the retrievals served by each tier of a TieredCache
+type TieredStats struct {
+	// L1Hits is the number of keys found in L1
+	L1Hits uint64
+	// L2Hits is the number of keys not found in L1 that were found in L2
+	L2Hits uint64
+	// Misses is the number of keys found in neither tier
+	Misses uint64
+	// PromotionErrors is the number of L2 hits that could not be promoted into L1
+	PromotionErrors uint64
+}
+
+// Stats returns the number of retrievals served by each tier since the cache was created
+func (t *TieredCache) Stats() TieredStats {
+	return TieredStats{
+		L1Hits:          t.l1Hits.Load(),
+		L2Hits:          t.l2Hits.Load(),
+		Misses:          t.misses.Load(),
+		PromotionErrors: t.promotionErrors.Load(),
+	}
+}
+
+// tieredWrite is a write to L2, either of vals or the removal of key, that
+// is queued when TieredWriteBehind is set.  If c is not nil, the result of
+// the write is sent to it.
+type tieredWrite struct {
+	ctx    context.Context
+	vals   []KeyVal
+	remove bool
+	key    Key
+	c      chan error
+}
+
+// writeBehind applies the queued writes to L2, in the order they were queued,
+// until the queue is closed and emptied
+func (t *TieredCache) writeBehind() {
+	defer t.behind.Done()
+	for w := range t.writes {
+		var err error
+		switch {
+		case w.remove:
+			err = t.l2.RemoveContext(w.ctx, w.key)
+		case w.vals != nil:
+			err = t.l2.PutBatch(w.ctx, w.vals)
+		}
+		if w.c != nil {
+			w.c <- err
+		}
+	}
+}
+
+// enqueue adds the write to the queue, waiting for room should the queue be full
+func (t *TieredCache) enqueue(ctx context.Context, w *tieredWrite) error {
+	t.lck.Lock()
+	defer t.lck.Unlock()
+
+	if t.closed {
+		return ErrAttemptToUseInvalidCache
+	}
+	select {
+	case <-ctx.Done():
+		return ErrInvalidContext
+	case t.writes <- w:
+		return nil
+	}
+}
+
+// flush waits until the writes queued before it have been applied to L2
+func (t *TieredCache) flush(ctx context.Context) error {
+	if t.writes == nil {
+		return nil
+	}
+	w := &tieredWrite{ctx: ctx, c: make(chan error, 1)}
+	if err := t.enqueue(ctx, w); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ErrInvalidContext
+	case err := <-w.c:
+		return err
+	}
+}
+
+// iterator is implemented by caches that can enumerate their entries
+type iterator interface {
+	ForEach(fn func(key Key, value any) bool) error
+}
+
+// Close empties both caches, releases all resources.
+// Close waits for any pending writes to the L2 cache to complete.
+func (t *TieredCache) Close() {
+	t.lck.Lock()
+	if t.closed {
+		t.lck.Unlock()
+		return
+	}
+	t.closed = true
+	if t.writes != nil {
+		close(t.writes)
+	}
+	t.lck.Unlock()
+
+	t.stop()
+	t.behind.Wait()
+	t.l1.Close()
+	t.l2.Close()
+}
+
+// Get retrieves the value at the specified key
+func (t *TieredCache) Get(ctx context.Context, key Key) (any, bool, error) {
+	res, err := t.GetBatch(ctx, []Key{key})
+	if err != nil {
+		return nil, false, err
+	}
+	if len(res) == 0 {
+		return nil, false, ErrUnknown
+	}
+	return res[0].Value, res[0].OK, res[0].Err
+}
+
+// GetBatch retrieves the values at the specified keys, from L1 if present,
+// otherwise from L2, in which case the values are promoted into L1
+func (t *TieredCache) GetBatch(ctx context.Context, keys []Key) ([]*CacheResult, error) {
+	res, err := t.l1.GetBatch(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) != len(keys) {
+		return nil, ErrUnknown
+	}
+
+	misses := []int{}
+	missKeys := []Key{}
+	for i, r := range res {
+		if !r.OK {
+			misses = append(misses, i)
+			missKeys = append(missKeys, keys[i])
+		}
+	}
+
+	t.l1Hits.Add(uint64(len(keys) - len(missKeys)))
+	if len(missKeys) == 0 {
+		return res, nil
+	}
+
+	l2Res, err := t.l2.GetBatch(ctx, missKeys)
+	if err != nil {
+		return nil, err
+	}
+	if len(l2Res) != len(missKeys) {
+		return nil, ErrUnknown
+	}
+
+	promote := []KeyVal{}
+	for i, r := range l2Res {
+		res[misses[i]] = r
+		if r.OK {
+			promote = append(promote, KeyVal{Key: r.Key, Value: r.Value})
+		}
+	}
+	t.l2Hits.Add(uint64(len(promote)))
+	t.misses.Add(uint64(len(missKeys) - len(promote)))
+
+	// Promotion is best effort, as the values have been retrieved from L2
+	if len(promote) > 0 {
+		if err := t.l1.PutBatch(ctx, promote); err != nil {
+			t.promotionErrors.Add(uint64(len(promote)))
+		}
+	}
+
+	return res, nil
+}
+
+// Len returns the number of distinct keys held across both caches, if both can
+// enumerate their entries.  Otherwise the sum of their usage is returned, which
+// counts keys held by both caches twice.
+func (t *TieredCache) Len() (int, error) {
+	i1, ok1 := t.l1.(iterator)
+	i2, ok2 := t.l2.(iterator)
+	if !ok1 || !ok2 {
+		l1, err := t.l1.Len()
+		if err != nil {
+			return 0, err
+		}
+		l2, err := t.l2.Len()
+		if err != nil {
+			return 0, err
+		}
+		return l1 + l2, nil
+	}
+
+	keys := map[Key]struct{}{}
+	add := func(key Key, _ any) bool {
+		keys[key] = struct{}{}
+		return true
+	}
+	if err := i1.ForEach(add); err != nil {
+		return 0, err
+	}
+	if err := i2.ForEach(add); err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+// Put inserts the value at the specified key, replacing any prior content
+func (t *TieredCache) Put(ctx context.Context, key Key, val any) error {
+	return t.PutBatch(ctx, []KeyVal{{Key: key, Value: val}})
+}
+
+// PutBatch inserts the values into L1, and into L2 either before returning or,
+// if TieredWriteBehind is set, asynchronously.  Asynchronous writes to L2 are
+// queued, and applied in the order they were made; their errors are discarded.
+// PutBatch waits for room should the queue be full.
+func (t *TieredCache) PutBatch(ctx context.Context, vals []KeyVal) error {
+	if err := t.l1.PutBatch(ctx, vals); err != nil {
+		return err
+	}
+
+	if t.writes != nil {
+		return t.enqueue(ctx, &tieredWrite{ctx: context.WithoutCancel(ctx), vals: vals})
+	}
+
+	return t.l2.PutBatch(ctx, vals)
+}
+
+// Remove evicts the key and its associated value from both caches
+func (t *TieredCache) Remove(key Key) error {
+	return t.RemoveContext(context.Background(), key)
+}
+
+// RemoveContext is Remove, with the removals abandoned with ErrInvalidContext
+// should the context complete first.  If TieredWriteBehind is set, the removal
+// from L2 is queued after any pending writes, so that they cannot restore the key,
+// and RemoveContext waits for it to be applied.
+func (t *TieredCache) RemoveContext(ctx context.Context, key Key) error {
+	err := t.l1.RemoveContext(ctx, key)
+
+	if t.writes != nil {
+		w := &tieredWrite{ctx: ctx, remove: true, key: key, c: make(chan error, 1)}
+		if qerr := t.enqueue(ctx, w); qerr != nil {
+			return errors.Join(err, qerr)
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ErrInvalidContext)
+		case qerr := <-w.c:
+			return errors.Join(err, qerr)
+		}
+	}
+
+	return errors.Join(err, t.l2.RemoveContext(ctx, key))
+}
+
+// GetFirst retrieves the value at the specified key from the first of the caches that
+// holds it, returning the cache that served it.  Caches that fail are skipped, with
+// their errors returned only if no cache holds the key.  Unlike TieredCache, the value
+// is not promoted into the earlier caches; the caller may Put it if required.
+func GetFirst(ctx context.Context, key Key, caches ...Cache) (any, bool, Cache, error) {
+	var errs []error
+	for _, c := range caches {
+		if c == nil {
+			continue
+		}
+		v, ok, err := c.Get(ctx, key)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ok {
+			return v, true, c, nil
+		}
+	}
+	return nil, false, nil, errors.Join(errs...)
+}
+
+var ErrInvalidTier = errors.New("tiered caches must not be nil")
+
+// NewTieredCache creates a new cache in which l1 fronts l2.  The provided caches
+// are assumed to be owned by the TieredCache instance once they are added.
+// Additional behaviour can be configured using opts.
+// The context controls the lifetime of the cache, which is closed should it complete.
+// Close() should be called when the cache is no longer needed, to release resources.
+func NewTieredCache(ctx context.Context, l1, l2 Cache, opts ...Option) (*TieredCache, error) {
+
+	select {
+	case <-ctx.Done():
+		return nil, ErrInvalidContext
+	default:
+	}
+
+	if l1 == nil || l2 == nil {
+		return nil, ErrInvalidTier
+	}
+
+	t := &TieredCache{
+		o:  newOptions(opts),
+		l1: l1,
+		l2: l2,
+	}
+	if t.o.TieredWriteBehind {
+		t.writes = make(chan *tieredWrite, requestChannelSize)
+		t.behind.Add(1)
+		go t.writeBehind()
+	}
+	t.stop = context.AfterFunc(ctx, t.Close)
+
+	return t, nil
+}
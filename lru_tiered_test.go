@@ -0,0 +1,221 @@
+package lru
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestTieredCache(t *testing.T, opts ...Option) (*TieredCache, *BasicCache, *BasicCache) {
+	ctx := context.Background()
+
+	l1, _ := NewBasicCache(ctx, 2, 0)
+	l2, _ := NewBasicCache(ctx, 0, 0)
+
+	c, err := NewTieredCache(ctx, l1, l2, opts...)
+	if err != nil {
+		t.Fatalf("Unexpected error creating TieredCache: %v", err)
+	}
+	return c, l1, l2
+}
+
+func TestNewTieredCache(t *testing.T) {
+	if _, err := NewTieredCache(context.Background(), nil, nil); err != ErrInvalidTier {
+		t.Fatalf("TestNewTieredCache failed.  Expected error: %v, got error: %v", ErrInvalidTier, err)
+	}
+}
+
+func TestTieredCache_Promotion(t *testing.T) {
+	ctx := context.Background()
+
+	c, l1, _ := newTestTieredCache(t)
+	defer c.Close()
+
+	var _ Cache = c
+
+	for i := 0; i < 5; i++ {
+		c.Put(ctx, i, i)
+	}
+
+	if ok, _ := l1.Contains(0); ok {
+		t.Fatal("TestTieredCache_Promotion failed.  Expected 0 to have been evicted from L1")
+	}
+
+	v, ok, err := c.Get(ctx, 0)
+	if err != nil || !ok || v != 0 {
+		t.Fatalf("TestTieredCache_Promotion failed.  Expected hit from L2, got %v, %v, %v", v, ok, err)
+	}
+
+	if ok, _ := l1.Contains(0); !ok {
+		t.Fatal("TestTieredCache_Promotion failed.  Expected 0 to have been promoted to L1")
+	}
+
+	if l, _ := c.Len(); l != 5 {
+		t.Fatalf("TestTieredCache_Promotion failed.  Expected Len = 5, got %v", l)
+	}
+
+	c.Remove(0)
+	if _, ok, _ := c.Get(ctx, 0); ok {
+		t.Fatal("TestTieredCache_Promotion failed.  Expected 0 to have been removed from both tiers")
+	}
+}
+
+func TestTieredCache_Stats(t *testing.T) {
+	ctx := context.Background()
+
+	// L1 rejects every value, so that promotion fails
+	l1, _ := NewBasicCache(ctx, 2, 0, WithMaxValueSize(1, func(any) int64 { return 2 }))
+	l2, _ := NewBasicCache(ctx, 0, 0)
+
+	c, _ := NewTieredCache(ctx, l1, l2)
+	defer c.Close()
+
+	l2.Put(ctx, "a", 1)
+
+	// A failed promotion does not prevent the value retrieved from L2 being returned
+	if v, ok, err := c.Get(ctx, "a"); err != nil || !ok || v != 1 {
+		t.Fatalf("TestTieredCache_Stats failed.  Expected hit from L2, got %v, %v, %v", v, ok, err)
+	}
+	c.Get(ctx, "missing")
+
+	expected := TieredStats{L2Hits: 1, Misses: 1, PromotionErrors: 1}
+	if s := c.Stats(); s != expected {
+		t.Fatalf("TestTieredCache_Stats failed.  Expected %+v, got %+v", expected, s)
+	}
+}
+
+func TestTieredCache_Context(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	l1, _ := NewBasicCache(context.Background(), 2, 0)
+	l2, _ := NewBasicCache(context.Background(), 0, 0)
+
+	c, _ := NewTieredCache(ctx, l1, l2, WithTieredWriteBehind())
+	defer c.Close()
+
+	// Completing the context of the cache closes it, and its tiers
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+
+	if err := c.Put(context.Background(), "a", 1); err != ErrAttemptToUseInvalidCache {
+		t.Fatalf("TestTieredCache_Context failed.  Expected error: %v, got error: %v", ErrAttemptToUseInvalidCache, err)
+	}
+	if err := l2.Ping(context.Background()); err != ErrAttemptToUseInvalidCache {
+		t.Fatalf("TestTieredCache_Context failed.  Expected error: %v, got error: %v", ErrAttemptToUseInvalidCache, err)
+	}
+
+	if _, err := NewTieredCache(ctx, l1, l2); err != ErrInvalidContext {
+		t.Fatalf("TestTieredCache_Context failed.  Expected error: %v, got error: %v", ErrInvalidContext, err)
+	}
+}
+
+func TestTieredCache_WriteBehind(t *testing.T) {
+	ctx := context.Background()
+
+	c, _, l2 := newTestTieredCache(t, WithTieredWriteBehind())
+
+	if err := c.Put(ctx, "a", 1); err != nil {
+		t.Fatalf("TestTieredCache_WriteBehind failed.  Expected success, but got error %v", err)
+	}
+
+	c.flush(ctx)
+
+	if ok, _ := l2.Contains("a"); !ok {
+		t.Fatal("TestTieredCache_WriteBehind failed.  Expected a to have been written to L2")
+	}
+
+	c.Close()
+}
+
+func TestTieredCache_WriteBehindOrder(t *testing.T) {
+	ctx := context.Background()
+
+	c, _, l2 := newTestTieredCache(t, WithTieredWriteBehind())
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprint(i)
+		c.Put(ctx, key, 1)
+		c.Put(ctx, key, 2)
+		if i%2 == 0 {
+			if err := c.Remove(key); err != nil {
+				t.Fatalf("TestTieredCache_WriteBehindOrder failed.  Expected success, but got error %v", err)
+			}
+		}
+	}
+
+	// Close applies the pending writes before closing the tiers, so check them first
+	c.flush(ctx)
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprint(i)
+		v, ok, _ := l2.Get(ctx, key)
+		if i%2 == 0 && ok {
+			t.Fatalf("TestTieredCache_WriteBehindOrder failed.  Expected %v to have been removed from L2, got %v", key, v)
+		}
+		if i%2 == 1 && (!ok || v != 2) {
+			t.Fatalf("TestTieredCache_WriteBehindOrder failed.  Expected %v to hold 2 in L2, got %v, %v", key, v, ok)
+		}
+	}
+
+	c.Close()
+}
+
+// slowL2Cache delays each PutBatch of the underlying cache, counting the values written
+type slowL2Cache struct {
+	*BasicCache
+	written atomic.Int64
+}
+
+func (c *slowL2Cache) PutBatch(ctx context.Context, vals []KeyVal) error {
+	time.Sleep(time.Millisecond)
+	c.written.Add(int64(len(vals)))
+	return c.BasicCache.PutBatch(ctx, vals)
+}
+
+func TestTieredCache_WriteBehindClose(t *testing.T) {
+	ctx := context.Background()
+
+	l1, _ := NewBasicCache(ctx, 0, 0)
+	b, _ := NewBasicCache(ctx, 0, 0)
+	l2 := &slowL2Cache{BasicCache: b}
+	c, _ := NewTieredCache(ctx, l1, l2, WithTieredWriteBehind())
+
+	for i := 0; i < 10; i++ {
+		c.Put(ctx, i, i)
+	}
+
+	// Close waits for the pending writes to L2
+	c.Close()
+	if n := l2.written.Load(); n != 10 {
+		t.Fatalf("TestTieredCache_WriteBehindClose failed.  Expected 10 values written to L2, got %d", n)
+	}
+
+	if err := c.Put(ctx, "a", 1); err != ErrAttemptToUseInvalidCache {
+		t.Fatalf("TestTieredCache_WriteBehindClose failed.  Expected error: %v, got error: %v", ErrAttemptToUseInvalidCache, err)
+	}
+}
+
+func TestGetFirst(t *testing.T) {
+	ctx := context.Background()
+
+	local, _ := NewBasicCache(ctx, 0, 0)
+	defer local.Close()
+	remote, _ := NewBasicCache(ctx, 0, 0)
+	defer remote.Close()
+
+	remote.Put(ctx, "a", 1)
+
+	v, ok, c, err := GetFirst(ctx, "a", local, remote)
+	if err != nil || !ok || v != 1 || c != remote {
+		t.Fatalf("TestGetFirst failed.  Expected hit from remote, got %v, %v, %v, %v", v, ok, c, err)
+	}
+	if ok, _ := local.Contains("a"); ok {
+		t.Fatal("TestGetFirst failed.  Expected no promotion into local")
+	}
+
+	if _, ok, c, err := GetFirst(ctx, "missing", local, remote); ok || c != nil || err != nil {
+		t.Fatalf("TestGetFirst failed.  Expected miss, got %v, %v, %v", ok, c, err)
+	}
+}
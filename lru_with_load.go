@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"go.opentelemetry.io/otel/attribute"
@@ -11,26 +12,177 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
-// LoaderResult provides the outcome of an attempt to load the specified key
+// LoaderResult provides the outcome of an attempt to load the specified key.
+// A nil Value with no Err indicates that the key could not be found, and
+// is reported in the CacheResult for the key as ErrLoaderReturnedNil.
+// TTL, if positive, is the time-to-live with which a LoadingCache caches the value,
+// rather than the default TTL of the cache, so that the values of a single call to
+// the Loader may expire at different times.  TTL is ignored by a PartitionLoader.
 type LoaderResult struct {
 	Key   Key
 	Value any
 	Err   error
+	TTL   time.Duration
 }
 
-// Loader is a func that returns the value for the specified keys
+var ErrLoaderReturnedNil = errors.New("loader returned nil value for key")
+
+var ErrMalformedLoaderResult = errors.New("loader returned more than one result for key")
+
+var ErrTooManyInflight = errors.New("too many gets are loading from the loader")
+
+// LoaderError describes the failure of the Loader to load a specific key,
+// and is returned in the Err of the CacheResult for that key
+type LoaderError struct {
+	Key Key
+	Err error
+}
+
+func (e *LoaderError) Error() string {
+	return fmt.Sprintf("loader failed for key %v: %v", e.Key, e.Err)
+}
+
+func (e *LoaderError) Unwrap() error {
+	return e.Err
+}
+
+// Loader is a func that returns the value for the specified keys.
+// Results are matched to the requested keys, so may be in any order; results for
+// keys that were not requested are ignored, and requested keys without a result
+// are reported as not found.  At most one result may be returned for each key.
 type Loader func(ctx context.Context, key []Key) ([]LoaderResult, error)
 
+// GroupLoader is a func that returns the values of all the keys of the specified group,
+// as determined by the Grouper option
+type GroupLoader func(ctx context.Context, group Key) ([]LoaderResult, error)
+
+// groupedLoader returns a Loader that loads the keys that belong to a group with
+// groupLoader, once per group, and the remaining keys with loader.  If the load of
+// a group fails, the error is reported for each of the requested keys of the group.
+// Only the first result for each key is returned.
+func groupedLoader(loader Loader, grouper func(key Key) (Key, bool), groupLoader GroupLoader) Loader {
+	return func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		ungrouped := []Key{}
+		groups := []Key{}
+		members := map[Key][]Key{}
+		for _, key := range keys {
+			group, ok := grouper(key)
+			if !ok {
+				ungrouped = append(ungrouped, key)
+				continue
+			}
+			if _, ok := members[group]; !ok {
+				groups = append(groups, group)
+			}
+			members[group] = append(members[group], key)
+		}
+
+		res := []LoaderResult{}
+		if len(ungrouped) > 0 {
+			r, err := loader(ctx, ungrouped)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, r...)
+		}
+		for _, group := range groups {
+			r, err := groupLoader(ctx, group)
+			if err != nil {
+				for _, key := range members[group] {
+					res = append(res, LoaderResult{Key: key, Err: err})
+				}
+				continue
+			}
+			res = append(res, r...)
+		}
+
+		returned := map[Key]bool{}
+		unique := res[:0]
+		for _, r := range res {
+			if !returned[r.Key] {
+				returned[r.Key] = true
+				unique = append(unique, r)
+			}
+		}
+		return unique, nil
+	}
+}
+
 // LoadingCache is an implementation of Cache that will attempt to populate
 // itself for a missing Key, using a specified Loader function
 type LoadingCache struct {
 	privateImp
+	o      Options
 	cache  *BasicCache
 	loader Loader
+	// loads limits the number of concurrent calls to the loader, if not nil
+	loads chan struct{}
+	// inflightGets limits the number of Gets that are loading, if not nil
+	inflightGets chan struct{}
+
+	pendingLck sync.Mutex
+	pending    map[chan struct{}]struct{}
+
+	flightLck sync.Mutex
+	inflight  map[Key]*flight
+
+	// failures holds the recent failures of the loader, if LoaderErrorTTL is set
+	failuresLck sync.Mutex
+	failures    map[Key]*failure
+
+	// writebacks queues the asynchronous writebacks for the workers, if AsyncWriteback is set
+	writebacks  chan *writebackJob
+	workers     sync.WaitGroup
+	writebackMu sync.RWMutex
+	closed      bool
+}
+
+// WritebackOverflowPolicy determines what happens to an asynchronous writeback
+// when the writeback queue of a LoadingCache is full
+type WritebackOverflowPolicy int
+
+const (
+	// WritebackBlock waits until there is space in the queue
+	WritebackBlock WritebackOverflowPolicy = iota
+	// WritebackSync adds the values to the cache before GetBatch returns, as if AsyncWriteback were not set
+	WritebackSync
+	// WritebackDrop discards the values, which are loaded again when next requested
+	WritebackDrop
+)
+
+// writebackJob is an asynchronous writeback, and the func to call once it is complete
+type writebackJob struct {
+	ctx  context.Context
+	vals []KeyVal
+	ttls map[Key]time.Duration
+	done func()
+}
+
+// failure is a failure of the loader for a key, which is reported until expires
+type failure struct {
+	err     error
+	expires time.Time
 }
 
-// Close empties the cache, releases all resources
+// flight is the load of a key that is in progress, and its outcome once done is closed
+type flight struct {
+	done  chan struct{}
+	res   LoaderResult
+	found bool
+	err   error
+}
+
+// Close empties the cache, releases all resources.
+// Any queued asynchronous writebacks are completed first.
 func (l *LoadingCache) Close() {
+	l.writebackMu.Lock()
+	if !l.closed && l.writebacks != nil {
+		close(l.writebacks)
+	}
+	l.closed = true
+	l.writebackMu.Unlock()
+
+	l.workers.Wait()
 	l.cache.Close()
 }
 
@@ -46,109 +198,938 @@ func (l *LoadingCache) Get(ctx context.Context, key Key) (any, bool, error) {
 	return res[0].Value, res[0].OK, res[0].Err
 }
 
+// Source describes where the value of a key was retrieved from
+type Source int
+
+const (
+	// SourceMiss indicates that no value was found for the key
+	SourceMiss Source = iota
+	// SourceHit indicates that the value was already held by the cache
+	SourceHit
+	// SourceLoaded indicates that the value was retrieved by the Loader
+	SourceLoaded
+)
+
+// GetWithSource retrieves the value at the specified key, together with its Source
+func (l *LoadingCache) GetWithSource(ctx context.Context, key Key) (any, Source, error) {
+	res, sources, err := l.GetBatchWithSource(ctx, []Key{key})
+	if err != nil {
+		return nil, SourceMiss, err
+	}
+	if len(res) == 0 {
+		return nil, SourceMiss, ErrUnknown
+	}
+	return res[0].Value, sources[0], res[0].Err
+}
+
 const (
 	oTELLoadingCacheGetBatchStarted = "LoadingCache.GetBatch started"
 	oTELLoadingCacheGetBatchEnded   = "LoadingCache.GetBatch ended"
 	oTELLoadingCacheGetBatchError   = "LoadingCache.GetBatch Retrieval Error"
+	oTELLoadingCacheGetBatchSpan    = "LoadingCache.GetBatch"
 )
 
-// GetBatch retrieves the values at the specified keys
-func (l *LoadingCache) GetBatch(ctx context.Context, keys []Key) (res []*CacheResult, err error) {
+// GetBatch retrieves the values at the specified keys, returning their
+// results in the same order as keys, whether they were held or loaded.
+// If PartialResults is set and ctx completes whilst keys are being loaded, the
+// keys already resolved are returned, with the other keys reporting the returned error.
+func (l *LoadingCache) GetBatch(ctx context.Context, keys []Key) ([]*CacheResult, error) {
+	res, _, err := l.GetBatchWithSource(ctx, keys)
+	return res, err
+}
+
+// GetBatchWithSource retrieves the values at the specified keys, together with
+// the Source of the value of each key, in the same order as the CacheResults
+func (l *LoadingCache) GetBatchWithSource(ctx context.Context, keys []Key) (res []*CacheResult, sources []Source, err error) {
 
 	select {
 	case <-ctx.Done():
-		return nil, ErrInvalidContext
+		return nil, nil, ErrInvalidContext
 	default:
 	}
 
 	if len(keys) == 0 {
-		return []*CacheResult{}, nil
+		return []*CacheResult{}, []Source{}, nil
 	}
 
-	curSpan := trace.SpanFromContext(ctx)
+	ctx, curSpan, endSpan := startSpan(ctx, l.o, oTELLoadingCacheGetBatchSpan)
+	defer endSpan()
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("unexpected error: %v", r)
-			curSpan.AddEvent(oTELLoadingCacheGetBatchError, trace.WithTimestamp(time.Now().UTC()))
-			curSpan.SetStatus(codes.Error, err.Error())
-		} else {
+			l.o.panicked(r)
+			if curSpan != nil {
+				curSpan.AddEvent(oTELLoadingCacheGetBatchError, trace.WithTimestamp(time.Now().UTC()))
+				curSpan.SetStatus(codes.Error, err.Error())
+			}
+		} else if curSpan != nil {
 			curSpan.AddEvent(oTELLoadingCacheGetBatchEnded, trace.WithAttributes(attribute.Int("Retrieved", len(res))), trace.WithTimestamp(time.Now().UTC()))
 		}
 	}()
 
-	curSpan.AddEvent(oTELLoadingCacheGetBatchStarted, trace.WithAttributes(attribute.Int("Requested", len(keys))), trace.WithTimestamp(time.Now().UTC()))
+	if curSpan != nil {
+		curSpan.AddEvent(oTELLoadingCacheGetBatchStarted, trace.WithAttributes(attribute.Int("Requested", len(keys))), trace.WithTimestamp(time.Now().UTC()))
+	}
 
 	res, err = l.cache.GetBatch(ctx, keys)
 
 	if err != nil {
-		return nil, err
+		if l.o.PartialResults && ctx.Err() != nil {
+			// No keys have been resolved
+			err = partialResultsError(ctx)
+			res = make([]*CacheResult, len(keys))
+			for i, key := range keys {
+				res[i] = &CacheResult{KeyVal: KeyVal{Key: key}, Err: err}
+			}
+			return res, make([]Source, len(keys)), err
+		}
+		return nil, nil, err
 	}
 	if len(res) != len(keys) {
-		return nil, ErrUnknown
+		return nil, nil, ErrUnknown
 	}
 
+	sources = make([]Source, len(res))
 	loaderKeys := []Key{}
-	for _, r := range res {
+	for i, r := range res {
 		if r.Err != nil || !r.OK {
+			if err := l.recentFailure(r.Key); err != nil {
+				r.Err = &LoaderError{Key: r.Key, Err: err}
+				continue
+			}
 			loaderKeys = append(loaderKeys, r.Key)
+		} else {
+			sources[i] = SourceHit
 		}
 	}
 
 	if len(loaderKeys) > 0 {
 
-		loadResp, err := l.loader(ctx, loaderKeys)
+		loadCtx := ctx
+		if l.o.LoaderDeadline > 0 {
+			var cancel context.CancelFunc
+			loadCtx, cancel = context.WithTimeout(ctx, l.o.LoaderDeadline)
+			defer cancel()
+		}
+
+		release, err := l.admitGet(ctx)
 		if err != nil {
-			return nil, err
+			if l.o.PartialResults && ctx.Err() != nil {
+				err = partialResultsError(ctx)
+				markUnresolved(res, err)
+				return res, sources, err
+			}
+			return nil, nil, err
 		}
-		if len(loadResp) != len(loaderKeys) {
-			return nil, ErrUnknown
-		}
-
-		toCache := []KeyVal{}
-		for _, lr := range loadResp {
-			for _, cr := range res {
-				if lr.Key == cr.Key {
-					if lr.Err != nil {
-						cr.Err = lr.Err
-						cr.OK = false
-					} else {
-						cr.Value = lr.Value
-						if cr.Value != nil {
-							cr.OK = true
-							toCache = append(toCache, KeyVal{Key: lr.Key, Value: lr.Value})
-						}
-					}
+		loadResp, loadErr := l.loadShared(loadCtx, loaderKeys)
+		release()
+		partial := loadErr != nil && l.o.PartialResults && ctx.Err() != nil
+		// Keys that are not loaded within the LoaderDeadline remain misses
+		expired := loadErr != nil && ctx.Err() == nil && loadCtx.Err() != nil
+		if loadErr != nil && !partial && !expired {
+			return nil, nil, loadErr
+		}
+
+		toCache, err := l.mergeLoaderResults(res, loadResp)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		l.recordFailures(loaderKeys, loadResp)
+		l.writeback(ctx, toCache, loaderTTLs(loadResp))
+
+		for i, r := range res {
+			if r.OK && sources[i] != SourceHit {
+				sources[i] = SourceLoaded
+			}
+		}
+
+		if partial {
+			err = partialResultsError(ctx)
+			markUnresolved(res, err)
+			return res, sources, err
+		}
+	}
+
+	return res, sources, nil
+}
+
+// mergeLoaderResults updates the results of the keys that were not found, or failed, from
+// the results of the loader, returning the loaded values that should be added to the cache.
+// The results are matched to the requested keys, ignoring any extra keys that
+// the loader returned, and leaving keys that it did not return as misses.
+func mergeLoaderResults(res []*CacheResult, loadResp []LoaderResult) ([]KeyVal, error) {
+	requested := map[Key][]*CacheResult{}
+	for _, cr := range res {
+		if cr.Err != nil || !cr.OK {
+			requested[cr.Key] = append(requested[cr.Key], cr)
+		}
+	}
+
+	merged := map[Key]bool{}
+	toCache := []KeyVal{}
+	for _, lr := range loadResp {
+		crs, ok := requested[lr.Key]
+		if !ok {
+			continue
+		}
+		if merged[lr.Key] {
+			return nil, &LoaderError{Key: lr.Key, Err: ErrMalformedLoaderResult}
+		}
+		merged[lr.Key] = true
+
+		for _, cr := range crs {
+			if lr.Err != nil {
+				cr.Err = &LoaderError{Key: cr.Key, Err: lr.Err}
+				cr.OK = false
+			} else {
+				cr.Value = lr.Value
+				if cr.Value != nil {
+					cr.OK = true
+				} else {
+					// Distinguishes the key not being found by the loader
+					cr.Err = ErrLoaderReturnedNil
+				}
+			}
+		}
+		if lr.Err == nil && lr.Value != nil {
+			toCache = append(toCache, KeyVal{Key: lr.Key, Value: lr.Value})
+		}
+	}
+
+	return toCache, nil
+}
+
+// mergeLoaderResults merges the results of the loader as for mergeLoaderResults, adding
+// the values of the keys that were not requested to those that should be added to the
+// cache if a GroupLoader is in use, as these are the other keys of the loaded groups.
+func (l *LoadingCache) mergeLoaderResults(res []*CacheResult, loadResp []LoaderResult) ([]KeyVal, error) {
+	toCache, err := mergeLoaderResults(res, loadResp)
+	if err != nil || l.o.Grouper == nil || l.o.GroupLoader == nil {
+		return toCache, err
+	}
+
+	requested := map[Key]bool{}
+	for _, cr := range res {
+		requested[cr.Key] = true
+	}
+	for _, lr := range loadResp {
+		if !requested[lr.Key] && lr.Err == nil && lr.Value != nil {
+			requested[lr.Key] = true
+			toCache = append(toCache, KeyVal{Key: lr.Key, Value: lr.Value})
+		}
+	}
+	return toCache, nil
+}
+
+// recentFailure returns the error of the loader for the key, if it failed within the LoaderErrorTTL
+func (l *LoadingCache) recentFailure(key Key) error {
+	if l.o.LoaderErrorTTL <= 0 {
+		return nil
+	}
+
+	l.failuresLck.Lock()
+	defer l.failuresLck.Unlock()
+
+	f, ok := l.failures[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(f.expires) {
+		delete(l.failures, key)
+		return nil
+	}
+	return f.err
+}
+
+// recordFailures remembers the keys that the loader failed to load, for the LoaderErrorTTL,
+// and forgets those that it loaded.  Expired failures are discarded.
+func (l *LoadingCache) recordFailures(keys []Key, loadResp []LoaderResult) {
+	if l.o.LoaderErrorTTL <= 0 {
+		return
+	}
+
+	requested := make(map[Key]bool, len(keys))
+	for _, key := range keys {
+		requested[key] = true
+	}
+
+	l.failuresLck.Lock()
+	defer l.failuresLck.Unlock()
+
+	now := time.Now()
+	for key, f := range l.failures {
+		if now.After(f.expires) {
+			delete(l.failures, key)
+		}
+	}
+	for _, lr := range loadResp {
+		if !requested[lr.Key] {
+			continue
+		}
+		if lr.Err == nil {
+			delete(l.failures, lr.Key)
+			continue
+		}
+		l.failures[lr.Key] = &failure{err: lr.Err, expires: now.Add(l.o.LoaderErrorTTL)}
+	}
+}
+
+// markUnresolved sets the Err of the results of keys that were neither found nor failed
+func markUnresolved(res []*CacheResult, err error) {
+	for _, r := range res {
+		if r.Err == nil && !r.OK {
+			r.Err = err
+		}
+	}
+}
+
+// admitGet permits a Get to load its misses, if allowed by MaxInflightGets, returning
+// the func to be called once the loading is complete
+func (l *LoadingCache) admitGet(ctx context.Context) (func(), error) {
+	if l.inflightGets == nil {
+		return func() {}, nil
+	}
+
+	if l.o.BlockInflightGets {
+		select {
+		case <-ctx.Done():
+			return nil, ErrInvalidContext
+		case l.inflightGets <- struct{}{}:
+		}
+	} else {
+		select {
+		case l.inflightGets <- struct{}{}:
+		default:
+			return nil, ErrTooManyInflight
+		}
+	}
+	return func() { <-l.inflightGets }, nil
+}
+
+// load invokes the loader for the keys, once permitted by MaxConcurrentLoads
+func (l *LoadingCache) load(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+	if l.loads != nil {
+		select {
+		case <-ctx.Done():
+			return nil, ErrInvalidContext
+		case l.loads <- struct{}{}:
+		}
+		defer func() { <-l.loads }()
+	}
+
+	return l.loader(ctx, keys)
+}
+
+// loadWithRetry invokes the loader for the keys, retrying those that fail
+// (or all keys, if the loader fails completely) up to LoaderRetries times,
+// with an exponential backoff between attempts.  Retries cease if the
+// context completes, with the outcome of the last attempt returned.
+func (l *LoadingCache) loadWithRetry(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+	resp, err := l.load(ctx, keys)
+
+	backoff := l.o.LoaderBackoff
+	for attempt := 0; attempt < l.o.LoaderRetries; attempt++ {
+
+		retryKeys := keys
+		if err == nil {
+			retryKeys = []Key{}
+			for _, r := range resp {
+				if r.Err != nil {
+					retryKeys = append(retryKeys, r.Key)
+				}
+			}
+		}
+		if len(retryKeys) == 0 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return resp, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+
+		retryResp, retryErr := l.load(ctx, retryKeys)
+		if err != nil {
+			resp, err = retryResp, retryErr
+			continue
+		}
+		if retryErr != nil {
+			continue
+		}
+
+		for i, r := range resp {
+			for _, rr := range retryResp {
+				if r.Key == rr.Key {
+					resp[i] = rr
 					break
 				}
 			}
 		}
+	}
+
+	return resp, err
+}
+
+// loadShared loads the keys, sharing the outcome of loads of the same keys that are
+// already in flight for other requests, so that each key is loaded at most once at a time.
+// If the load of a shared key fails completely, then its error is reported for that key.
+func (l *LoadingCache) loadShared(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+	owned := []Key{}
+	mine := map[Key]*flight{}
+	waits := map[Key]*flight{}
+
+	l.flightLck.Lock()
+	for _, key := range keys {
+		if f, ok := l.inflight[key]; ok {
+			if _, ok := mine[key]; !ok {
+				waits[key] = f
+			}
+			continue
+		}
+		f := &flight{done: make(chan struct{})}
+		l.inflight[key] = f
+		mine[key] = f
+		owned = append(owned, key)
+	}
+	l.flightLck.Unlock()
+
+	var resp []LoaderResult
+	var err error
+	if len(owned) > 0 {
+		resp, err = l.loadWithRetry(ctx, owned)
+
+		l.flightLck.Lock()
+		for _, r := range resp {
+			if f, ok := mine[r.Key]; ok && !f.found {
+				f.res, f.found = r, true
+			}
+		}
+		for key, f := range mine {
+			f.err = err
+			delete(l.inflight, key)
+			close(f.done)
+		}
+		l.flightLck.Unlock()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	returned := map[Key]bool{}
+	for _, r := range resp {
+		returned[r.Key] = true
+	}
+	for key, f := range waits {
+		select {
+		case <-ctx.Done():
+			// The keys loaded so far are returned, for use as partial results
+			return resp, ErrInvalidContext
+		case <-f.done:
+		}
+		if returned[key] {
+			continue
+		}
+		if f.err != nil {
+			resp = append(resp, LoaderResult{Key: key, Err: f.err})
+		} else if f.found {
+			resp = append(resp, f.res)
+		}
+	}
+
+	return resp, nil
+}
+
+// Prefetch loads, and adds to the cache, those keys that are not already held, returning
+// immediately whilst this is done asynchronously.  Loads are shared with concurrent
+// requests for the same keys, so that a key is not loaded twice.  Any errors are discarded,
+// with keys that fail to load remaining absent.  The prefetch ceases if ctx completes,
+// so ctx should outlive the call to Prefetch.  FlushPending waits for prefetches to complete.
+func (l *LoadingCache) Prefetch(ctx context.Context, keys []Key) {
+	done := l.startPending()
+
+	go func() {
+		defer done()
+
+		present, err := l.cache.ContainsBatch(keys)
+		if err != nil {
+			return
+		}
+
+		missing := []Key{}
+		for _, key := range keys {
+			if !present[key] {
+				missing = append(missing, key)
+			}
+		}
+		if len(missing) > 0 {
+			l.GetBatch(ctx, missing)
+		}
+	}()
+}
+
+// Reload calls the loader for the key, whether or not it is held, replacing any
+// held value with the value loaded, which is returned.  This avoids the window
+// in which another Get could load a stale value, were the key removed and then
+// retrieved.  See ReloadBatch.
+func (l *LoadingCache) Reload(ctx context.Context, key Key) (any, error) {
+	res, err := l.ReloadBatch(ctx, []Key{key})
+	if err != nil {
+		return nil, err
+	}
+	if len(res) != 1 {
+		return nil, ErrUnknown
+	}
+	return res[0].Value, res[0].Err
+}
+
+// ReloadBatch calls the loader for the keys, whether or not they are held, replacing
+// the values held with those loaded, which are returned as for GetBatch.  The load is
+// not shared with loads of the same keys already in flight, as these may have started
+// before the change that prompted the reload (although such a load still adds its value
+// to the cache once complete), and failures within the LoaderErrorTTL do not prevent
+// the load.  Keys that the loader does not find are removed from the cache,
+// whilst keys that fail to load retain any value already held, with the error reported
+// in their results.  The values are added to the cache before returning, even if
+// AsyncWriteback is set.
+func (l *LoadingCache) ReloadBatch(ctx context.Context, keys []Key) ([]*CacheResult, error) {
 
-		l.PutBatch(ctx, toCache)
+	select {
+	case <-ctx.Done():
+		return nil, ErrInvalidContext
+	default:
+	}
+
+	if l.cache.closed.Load() {
+		return nil, ErrAttemptToUseInvalidCache
+	}
+	if err := checkKeys(keys...); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return []*CacheResult{}, nil
+	}
+
+	release, err := l.admitGet(ctx)
+	if err != nil {
+		return nil, err
+	}
+	loadResp, err := l.loadWithRetry(ctx, keys)
+	release()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*CacheResult, len(keys))
+	for i, key := range keys {
+		res[i] = &CacheResult{KeyVal: KeyVal{Key: key}}
+	}
+	toCache, err := l.mergeLoaderResults(res, loadResp)
+	if err != nil {
+		return nil, err
+	}
+	l.recordFailures(keys, loadResp)
+
+	ctx = context.WithoutCancel(ctx)
+	if err := l.putLoaded(ctx, toCache, loaderTTLs(loadResp)); err != nil {
+		return nil, err
+	}
+
+	notFound := []Key{}
+	for _, r := range res {
+		if (!r.OK && r.Err == nil) || errors.Is(r.Err, ErrLoaderReturnedNil) {
+			notFound = append(notFound, r.Key)
+		}
+	}
+	if len(notFound) > 0 {
+		if _, err := l.cache.RemoveBatchContext(ctx, notFound); err != nil {
+			return nil, err
+		}
 	}
 
 	return res, nil
 }
 
+// ScheduleRefresh reloads the keys every interval, regardless of whether they are
+// held or have been accessed, adding the loaded values to the cache so that they
+// are kept fresh.  Keys that fail to load retain any value already held.
+// The refresh continues until the returned func is called or the cache is closed.
+// If interval <= 0 then no refresh is scheduled.
+func (l *LoadingCache) ScheduleRefresh(keys []Key, interval time.Duration) (stop func()) {
+	if interval <= 0 || len(keys) == 0 {
+		return func() {}
+	}
+
+	keys = append([]Key(nil), keys...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var once sync.Once
+	stop = func() { once.Do(cancel) }
+
+	go func() {
+		defer stop()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-l.cache.done:
+				return
+			case <-ticker.C:
+				l.refresh(ctx, keys)
+			}
+		}
+	}()
+
+	return stop
+}
+
+// refresh loads the keys, adding those that load successfully to the cache
+func (l *LoadingCache) refresh(ctx context.Context, keys []Key) {
+	loadResp, err := l.loadShared(ctx, keys)
+	if err != nil {
+		return
+	}
+
+	res := make([]*CacheResult, len(keys))
+	for i, key := range keys {
+		res[i] = &CacheResult{KeyVal: KeyVal{Key: key}}
+	}
+	toCache, err := l.mergeLoaderResults(res, loadResp)
+	if err != nil || len(toCache) == 0 {
+		return
+	}
+
+	l.writeback(ctx, toCache, loaderTTLs(loadResp))
+}
+
+// startPending tracks an operation as pending, until the returned func is called
+func (l *LoadingCache) startPending() func() {
+	done := make(chan struct{})
+
+	l.pendingLck.Lock()
+	l.pending[done] = struct{}{}
+	l.pendingLck.Unlock()
+
+	return func() {
+		l.pendingLck.Lock()
+		delete(l.pending, done)
+		l.pendingLck.Unlock()
+		close(done)
+	}
+}
+
+// writeback adds the loaded values to the cache, tracking it as pending until complete.
+// The values of ctx (such as the current span) are retained for the writeback, but its
+// cancellation is not, so that loaded values are cached even if the request that
+// caused them to be loaded completes first.
+// Values with a TTL in ttls are cached with that TTL, and the others with the default TTL.
+// The writeback completes before returning, unless AsyncWriteback is set.
+func (l *LoadingCache) writeback(ctx context.Context, vals []KeyVal, ttls map[Key]time.Duration) {
+	ctx = context.WithoutCancel(ctx)
+
+	done := l.startPending()
+
+	if l.o.AsyncWriteback && l.enqueueWriteback(ctx, vals, ttls, done) {
+		return
+	}
+
+	defer done()
+	l.putLoaded(ctx, vals, ttls)
+}
+
+// loaderTTLs returns the TTLs of the results of the loader that specify one
+func loaderTTLs(loadResp []LoaderResult) map[Key]time.Duration {
+	var ttls map[Key]time.Duration
+	for _, lr := range loadResp {
+		if lr.TTL > 0 {
+			if ttls == nil {
+				ttls = map[Key]time.Duration{}
+			}
+			ttls[lr.Key] = lr.TTL
+		}
+	}
+	return ttls
+}
+
+// putLoaded adds the loaded values to the cache, each with its TTL from ttls, if any.
+// Values with the same TTL are added together, so that a batch with a single TTL
+// (or none) is added by a single request.
+func (l *LoadingCache) putLoaded(ctx context.Context, vals []KeyVal, ttls map[Key]time.Duration) error {
+	if len(ttls) == 0 {
+		return l.cache.PutBatch(ctx, vals)
+	}
+
+	order := []time.Duration{}
+	byTTL := map[time.Duration][]KeyVal{}
+	for _, kv := range vals {
+		ttl := ttls[kv.Key]
+		if _, ok := byTTL[ttl]; !ok {
+			order = append(order, ttl)
+		}
+		byTTL[ttl] = append(byTTL[ttl], kv)
+	}
+	var errs []error
+	for _, ttl := range order {
+		if err := l.cache.putBatch(ctx, byTTL[ttl], ttl); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// enqueueWriteback queues the values for a writeback worker, returning false if
+// the writeback should instead be completed by the caller.  If the queue is full then
+// the WritebackOverflow policy is applied, after reporting it to OnWritebackOverflow.
+func (l *LoadingCache) enqueueWriteback(ctx context.Context, vals []KeyVal, ttls map[Key]time.Duration, done func()) bool {
+	l.writebackMu.RLock()
+	defer l.writebackMu.RUnlock()
+	if l.closed {
+		done()
+		return true
+	}
+
+	job := &writebackJob{
+		ctx:  ctx,
+		vals: vals,
+		ttls: ttls,
+		done: done,
+	}
+
+	select {
+	case l.writebacks <- job:
+		return true
+	default:
+	}
+
+	if l.o.OnWritebackOverflow != nil {
+		l.o.OnWritebackOverflow(vals, l.o.WritebackOverflow)
+	}
+
+	switch l.o.WritebackOverflow {
+	case WritebackSync:
+		return false
+	case WritebackDrop:
+		done()
+		return true
+	default:
+		l.writebacks <- job
+		return true
+	}
+}
+
+// FlushPending blocks until all writebacks of loaded values to the cache, that were
+// started by prior calls to Get, GetBatch or Prefetch, have completed.
+// It is safe to call concurrently with other operations on the cache.
+// An error is raised if the context completes before the writebacks.
+func (l *LoadingCache) FlushPending(ctx context.Context) error {
+	l.pendingLck.Lock()
+	waitFor := make([]chan struct{}, 0, len(l.pending))
+	for ch := range l.pending {
+		waitFor = append(waitFor, ch)
+	}
+	l.pendingLck.Unlock()
+
+	for _, ch := range waitFor {
+		select {
+		case <-ctx.Done():
+			return ErrInvalidContext
+		case <-ch:
+		}
+	}
+	return nil
+}
+
+// GetRaw returns the value and state of the key, including if expired, without invoking the loader
+func (l *LoadingCache) GetRaw(key Key) (any, EntryState, error) {
+	return l.cache.GetRaw(key)
+}
+
+// GetEntry returns a description of the entry at the specified key, without invoking the loader
+func (l *LoadingCache) GetEntry(ctx context.Context, key Key) (*Entry, error) {
+	return l.cache.GetEntry(ctx, key)
+}
+
+// GetWithVersion retrieves the value at the specified key and its version, without invoking the loader
+func (l *LoadingCache) GetWithVersion(ctx context.Context, key Key) (any, uint64, bool, error) {
+	return l.cache.GetWithVersion(ctx, key)
+}
+
+// PutIfVersion inserts the value at the specified key, only if its version matches expected
+func (l *LoadingCache) PutIfVersion(ctx context.Context, key Key, val any, expected uint64) (bool, error) {
+	return l.cache.PutIfVersion(ctx, key, val, expected)
+}
+
+// Update atomically replaces the value at the specified key with that returned by fn, without invoking the loader
+func (l *LoadingCache) Update(ctx context.Context, key Key, fn func(value any, ok bool) (any, error)) (any, error) {
+	return l.cache.Update(ctx, key, fn)
+}
+
+// Swap atomically replaces the value at the specified key, returning the value replaced, without invoking the loader
+func (l *LoadingCache) Swap(ctx context.Context, key Key, val any) (any, bool, error) {
+	return l.cache.Swap(ctx, key, val)
+}
+
+// Merge atomically combines the value at the specified key with val, without invoking the loader
+func (l *LoadingCache) Merge(ctx context.Context, key Key, val any, merge func(existing, incoming any) any) error {
+	return l.cache.Merge(ctx, key, val, merge)
+}
+
+// Increment atomically adds delta to the int64 value of the key, without invoking the loader
+func (l *LoadingCache) Increment(ctx context.Context, key Key, delta int64) (int64, error) {
+	return l.cache.Increment(ctx, key, delta)
+}
+
+// Contains returns true if the key is held in the cache, without invoking the loader
+func (l *LoadingCache) Contains(key Key) (bool, error) {
+	return l.cache.Contains(key)
+}
+
+// ContainsBatch reports whether each of the keys is held in the cache, without invoking the loader
+func (l *LoadingCache) ContainsBatch(keys []Key) (map[Key]bool, error) {
+	return l.cache.ContainsBatch(keys)
+}
+
+// Find returns a snapshot of the entries whose values satisfy pred, without invoking the loader
+func (l *LoadingCache) Find(pred func(value any) bool) ([]KeyVal, error) {
+	return l.cache.Find(pred)
+}
+
+// Keys returns the keys in the cache, from the most to least recently used
+func (l *LoadingCache) Keys() ([]Key, error) {
+	return l.cache.Keys()
+}
+
+// Snapshot returns a copy of the entries in the cache, from the most to least recently used
+func (l *LoadingCache) Snapshot() ([]KeyVal, error) {
+	return l.cache.Snapshot()
+}
+
+// Restore adds the entries to the cache, preserving their order as returned by Snapshot
+func (l *LoadingCache) Restore(ctx context.Context, vals []KeyVal) error {
+	return l.cache.Restore(ctx, vals)
+}
+
 // Len returns the current usage of the cache
 func (l *LoadingCache) Len() (int, error) {
 	return l.cache.Len()
 }
 
+// LenContext returns the current usage of the cache, unless the context completes first
+func (l *LoadingCache) LenContext(ctx context.Context) (int, error) {
+	return l.cache.LenContext(ctx)
+}
+
+// Config returns the configuration of the cache
+func (l *LoadingCache) Config() CacheConfig {
+	cfg := l.cache.Config()
+	cfg.Policy = PolicyLoadingLRU
+	return cfg
+}
+
+// SetTimeout changes the time allowed for each subsequent operation on the cache
+func (l *LoadingCache) SetTimeout(d time.Duration) error {
+	return l.cache.SetTimeout(d)
+}
+
+// ChannelStats returns the number of requests currently queued within the cache
+func (l *LoadingCache) ChannelStats() (put, get, rm, other int, err error) {
+	return l.cache.ChannelStats()
+}
+
+// Weight returns the total weight of the entries in the cache
+func (l *LoadingCache) Weight() (int, error) {
+	return l.cache.Weight()
+}
+
 // Put inserts the value at the specified key, replacing any prior content
 func (l *LoadingCache) Put(ctx context.Context, key Key, val any) (err error) {
 	return l.cache.Put(ctx, key, val)
 }
 
-// Put inserts the value at the specified key, replacing any prior content
+// PutWithTTL inserts the value at the specified key, replacing any prior content,
+// which expires after the ttl
+func (l *LoadingCache) PutWithTTL(ctx context.Context, key Key, val any, ttl time.Duration) (err error) {
+	return l.cache.PutWithTTL(ctx, key, val, ttl)
+}
+
+// PutBatch inserts multiple key/values at once
 func (l *LoadingCache) PutBatch(ctx context.Context, vals []KeyVal) (err error) {
 	return l.cache.PutBatch(ctx, vals)
 }
 
+// RemoveBatch evicts the keys and their associated values, returning the number removed
+func (l *LoadingCache) RemoveBatch(keys []Key) (int, error) {
+	return l.cache.RemoveBatch(keys)
+}
+
 // Remove evicts the key and its associated value
 func (l *LoadingCache) Remove(key Key) (err error) {
 	return l.cache.Remove(key)
 }
 
+// RemoveContext evicts the key and its associated value, unless the context completes first
+func (l *LoadingCache) RemoveContext(ctx context.Context, key Key) error {
+	return l.cache.RemoveContext(ctx, key)
+}
+
+// RemoveBatchContext evicts the keys and their associated values, unless the context completes first
+func (l *LoadingCache) RemoveBatchContext(ctx context.Context, keys []Key) (int, error) {
+	return l.cache.RemoveBatchContext(ctx, keys)
+}
+
+// RemoveWhere evicts all keys for which pred returns true, returning the number removed
+func (l *LoadingCache) RemoveWhere(pred func(key Key, value any) bool) (int, error) {
+	return l.cache.RemoveWhere(pred)
+}
+
+// ForEach calls fn for each entry in the cache, stopping early if fn returns false
+func (l *LoadingCache) ForEach(fn func(key Key, value any) bool) error {
+	return l.cache.ForEach(fn)
+}
+
+// Resize changes the capacity of the cache, returning any entries evicted as a result
+func (l *LoadingCache) Resize(maxEntries int) ([]KeyVal, error) {
+	return l.cache.Resize(maxEntries)
+}
+
+// Evict removes up to n of the least recently used entries, returning the number removed
+func (l *LoadingCache) Evict(n int) (int, error) {
+	return l.cache.Evict(n)
+}
+
+// Pin exempts the key from eviction to maintain the capacity of the cache
+func (l *LoadingCache) Pin(key Key) (bool, error) {
+	return l.cache.Pin(key)
+}
+
+// Unpin allows the key to be evicted once more
+func (l *LoadingCache) Unpin(key Key) (bool, error) {
+	return l.cache.Unpin(key)
+}
+
+// Clear evicts all entries from the cache, returning them
+func (l *LoadingCache) Clear() ([]KeyVal, error) {
+	return l.cache.Clear()
+}
+
+// Drain removes all entries from the cache without evicting them, returning them
+// from the most to least recently used
+func (l *LoadingCache) Drain() ([]KeyVal, error) {
+	return l.cache.Drain()
+}
+
+// Ping confirms that the cache is able to process requests
+func (l *LoadingCache) Ping(ctx context.Context) error {
+	return l.cache.Ping(ctx)
+}
+
 var ErrInvalidLoader = errors.New("loader must not be nil")
 
 // NewLoadingCache creates a new LRU cache instance with the specified capacity
@@ -158,8 +1139,9 @@ var ErrInvalidLoader = errors.New("loader must not be nil")
 // least recently used item.  If capacity = 0 then cache will grow
 // indefinitely.
 // If timeout <= 0 then an infinite timeout is used (not recommended)
+// Additional behaviour can be configured using opts.
 // Close() should be called when the cache is no longer needed, to release resources
-func NewLoadingCache(ctx context.Context, loader Loader, maxEntries int, timeout time.Duration) (*LoadingCache, error) {
+func NewLoadingCache(ctx context.Context, loader Loader, maxEntries int, timeout time.Duration, opts ...Option) (*LoadingCache, error) {
 
 	select {
 	case <-ctx.Done():
@@ -171,40 +1153,112 @@ func NewLoadingCache(ctx context.Context, loader Loader, maxEntries int, timeout
 		return nil, ErrInvalidLoader
 	}
 
+	o := newOptions(opts)
+
+	if o.Grouper != nil && o.GroupLoader != nil {
+		loader = groupedLoader(loader, o.Grouper, o.GroupLoader)
+	}
+
 	// Ensures recovery from panic, converted to error
 	wrapped := func(ctx context.Context, keys []Key) (cr []LoaderResult, err error) {
 
-		curSpan := trace.SpanFromContext(ctx)
+		ctx, curSpan, endSpan := startSpan(ctx, o, oTELLoaderSpan)
+		defer endSpan()
 		defer func() {
 			if r := recover(); r != nil {
 				err = fmt.Errorf("unexpected error: %v", r)
-				curSpan.AddEvent(oTELLoaderError, trace.WithTimestamp(time.Now().UTC()))
-				curSpan.SetStatus(codes.Error, err.Error())
-			} else {
+				o.panicked(r)
+				if curSpan != nil {
+					curSpan.AddEvent(oTELLoaderError, trace.WithTimestamp(time.Now().UTC()))
+					curSpan.SetStatus(codes.Error, err.Error())
+				}
+			} else if curSpan != nil {
 				curSpan.AddEvent(oTELLoaderEnded, trace.WithAttributes(attribute.Int("Loaded", len(cr))), trace.WithTimestamp(time.Now().UTC()))
 			}
+			// A child span of the loader is annotated with the number of keys requested and
+			// values loaded, and the status of the load, which are not added to the caller's span
+			if curSpan != nil && o.Tracer != nil {
+				loaded := 0
+				for _, r := range cr {
+					if r.Err == nil && r.Value != nil {
+						loaded++
+					}
+				}
+				curSpan.SetAttributes(
+					attribute.Int(oTELLoaderRequestedAttr, len(keys)),
+					attribute.Int(oTELLoaderLoadedAttr, loaded))
+				if err != nil {
+					curSpan.SetStatus(codes.Error, err.Error())
+				}
+			}
 		}()
 
-		curSpan.AddEvent(oTELLoaderStarted, trace.WithAttributes(attribute.Int("Requested", len(keys))), trace.WithTimestamp(time.Now().UTC()))
+		if curSpan != nil {
+			curSpan.AddEvent(oTELLoaderStarted, trace.WithAttributes(attribute.Int("Requested", len(keys))), trace.WithTimestamp(time.Now().UTC()))
+		}
 
 		cr, err = loader(ctx, keys)
 
 		return
 	}
 
-	c, err := NewBasicCache(ctx, maxEntries, timeout)
+	c, err := NewBasicCache(ctx, maxEntries, timeout, opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	return &LoadingCache{
-		cache:  c,
-		loader: wrapped,
-	}, nil
+	var loads chan struct{}
+	if o.MaxConcurrentLoads > 0 {
+		loads = make(chan struct{}, o.MaxConcurrentLoads)
+	}
+
+	var inflightGets chan struct{}
+	if o.MaxInflightGets > 0 {
+		inflightGets = make(chan struct{}, o.MaxInflightGets)
+	}
+
+	l := &LoadingCache{
+		o:            o,
+		cache:        c,
+		loader:       wrapped,
+		loads:        loads,
+		inflightGets: inflightGets,
+		pending:      map[chan struct{}]struct{}{},
+		inflight:     map[Key]*flight{},
+		failures:     map[Key]*failure{},
+	}
+
+	if o.AsyncWriteback {
+		workers := max(1, o.WritebackWorkers)
+		size := o.WritebackQueueSize
+		if size <= 0 {
+			size = requestChannelSize
+		}
+		l.writebacks = make(chan *writebackJob, size)
+		l.workers.Add(workers)
+		for i := 0; i < workers; i++ {
+			go l.writebackWorker()
+		}
+	}
+
+	return l, nil
+}
+
+// writebackWorker completes queued asynchronous writebacks, until the queue is closed
+func (l *LoadingCache) writebackWorker() {
+	defer l.workers.Done()
+	for job := range l.writebacks {
+		l.putLoaded(job.ctx, job.vals, job.ttls)
+		job.done()
+	}
 }
 
 const (
 	oTELLoaderStarted = "Loader started"
 	oTELLoaderEnded   = "Loader ended"
 	oTELLoaderError   = "Loader Error"
+	oTELLoaderSpan    = "Loader"
+
+	oTELLoaderRequestedAttr = "lru.loader.requested"
+	oTELLoaderLoadedAttr    = "lru.loader.loaded"
 )
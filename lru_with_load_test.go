@@ -3,6 +3,10 @@ package lru
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -144,7 +148,9 @@ func TestLoadingCache_Get_2(t *testing.T) {
 			t.Fatal("TestLoadingCache_Get_2 failed.  Expected ok = true, got ok = false")
 		}
 
-		time.Sleep(100 * time.Microsecond) // Allow LoadingCache to populate on separate goroutine
+		if err := lru.FlushPending(context.Background()); err != nil {
+			t.Fatalf("TestLoadingCache_Get_2 failed.  Expected no error, got '%v'", err)
+		}
 
 		l, err := lru.Len()
 		if err != nil {
@@ -160,3 +166,919 @@ func TestLoadingCache_Get_2(t *testing.T) {
 	f() // first test verify can insert
 	f() // second test verifies retrieved from cache, with no reinsert
 }
+
+func TestLoadingCache_FlushPending(t *testing.T) {
+	loader := NewMapLoader(map[Key]any{"a": 1, "b": 2, "c": 3})
+
+	ctx := context.Background()
+
+	lru, _ := NewLoadingCache(ctx, loader, 0, 0)
+	defer lru.Close()
+
+	var wg sync.WaitGroup
+	for _, k := range []Key{"a", "b", "c"} {
+		wg.Add(1)
+		go func(key Key) {
+			defer wg.Done()
+			lru.Get(ctx, key)
+			lru.FlushPending(ctx)
+		}(k)
+	}
+	wg.Wait()
+
+	if err := lru.FlushPending(ctx); err != nil {
+		t.Fatalf("TestLoadingCache_FlushPending failed.  Expected no error, got '%v'", err)
+	}
+
+	if l, _ := lru.Len(); l != 3 {
+		t.Fatalf("TestLoadingCache_FlushPending failed.  Expected Len = 3, got %v", l)
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := lru.FlushPending(cctx); err != nil {
+		t.Fatalf("TestLoadingCache_FlushPending failed.  Expected no error with nothing pending, got '%v'", err)
+	}
+}
+
+func TestLoadingCache_LoaderError(t *testing.T) {
+	errBackend := errors.New("backend unavailable")
+
+	loader := func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		res := []LoaderResult{}
+		for _, k := range keys {
+			if k == "bad" {
+				res = append(res, LoaderResult{Key: k, Err: errBackend})
+			} else {
+				res = append(res, LoaderResult{Key: k, Value: 1})
+			}
+		}
+		return res, nil
+	}
+
+	ctx := context.Background()
+
+	lru, _ := NewLoadingCache(ctx, loader, 0, 0)
+	defer lru.Close()
+
+	res, err := lru.GetBatch(ctx, []Key{"good", "bad"})
+	if err != nil {
+		t.Fatalf("TestLoadingCache_LoaderError failed.  Expected no error, got '%v'", err)
+	}
+	if res[0].Err != nil || !res[0].OK {
+		t.Fatalf("TestLoadingCache_LoaderError failed.  Unexpected result for good key: %v", res[0])
+	}
+
+	var le *LoaderError
+	if !errors.As(res[1].Err, &le) {
+		t.Fatalf("TestLoadingCache_LoaderError failed.  Expected LoaderError, got '%v'", res[1].Err)
+	}
+	if le.Key != "bad" {
+		t.Fatalf("TestLoadingCache_LoaderError failed.  Expected key 'bad', got '%v'", le.Key)
+	}
+	if !errors.Is(res[1].Err, errBackend) {
+		t.Fatalf("TestLoadingCache_LoaderError failed.  Expected wrapped error '%v', got '%v'", errBackend, res[1].Err)
+	}
+}
+
+func TestLoadingCache_MaxConcurrentLoads(t *testing.T) {
+	var lck sync.Mutex
+	active, maxActive := 0, 0
+
+	loader := func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		lck.Lock()
+		active++
+		maxActive = max(maxActive, active)
+		lck.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		lck.Lock()
+		active--
+		lck.Unlock()
+
+		res := []LoaderResult{}
+		for _, k := range keys {
+			res = append(res, LoaderResult{Key: k, Value: k})
+		}
+		return res, nil
+	}
+
+	ctx := context.Background()
+
+	lru, _ := NewLoadingCache(ctx, loader, 0, 0, WithMaxConcurrentLoads(2))
+	defer lru.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(v int) {
+			defer wg.Done()
+			lru.Get(ctx, v)
+		}(i)
+	}
+	wg.Wait()
+
+	if maxActive > 2 {
+		t.Fatalf("TestLoadingCache_MaxConcurrentLoads failed.  Expected at most 2 concurrent loads, got %v", maxActive)
+	}
+
+	// A blocked load respects the context of the caller
+	lru.loads <- struct{}{}
+	lru.loads <- struct{}{}
+	defer func() { <-lru.loads; <-lru.loads }()
+
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+
+	if _, _, err := lru.Get(cctx, "blocked"); !errors.Is(err, ErrInvalidContext) {
+		t.Fatalf("TestLoadingCache_MaxConcurrentLoads failed.  Expected error: %v, got error: %v", ErrInvalidContext, err)
+	}
+}
+
+func TestLoadingCache_MaxInflightGets(t *testing.T) {
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		<-release
+		res := []LoaderResult{}
+		for _, k := range keys {
+			res = append(res, LoaderResult{Key: k, Value: k})
+		}
+		return res, nil
+	}
+
+	lru, _ := NewLoadingCache(ctx, loader, 0, 0, WithMaxInflightGets(1, false))
+	defer lru.Close()
+
+	done := make(chan error)
+	go func() {
+		_, _, err := lru.Get(ctx, "loading")
+		done <- err
+	}()
+	for len(lru.inflightGets) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Misses beyond the limit are rejected, whilst hits are served
+	if _, _, err := lru.Get(ctx, "rejected"); err != ErrTooManyInflight {
+		t.Fatalf("TestLoadingCache_MaxInflightGets failed.  Expected error: %v, got error: %v", ErrTooManyInflight, err)
+	}
+	lru.Put(ctx, "hit", 1)
+	if v, ok, err := lru.Get(ctx, "hit"); err != nil || !ok || v != 1 {
+		t.Fatalf("TestLoadingCache_MaxInflightGets failed.  Expected hit, got %v, %v, %v", v, ok, err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("TestLoadingCache_MaxInflightGets failed.  Unexpected error: %v", err)
+	}
+	if v, ok, err := lru.Get(ctx, "rejected"); err != nil || !ok || v != "rejected" {
+		t.Fatalf("TestLoadingCache_MaxInflightGets failed.  Expected load once admitted, got %v, %v, %v", v, ok, err)
+	}
+
+	// Blocked Gets respect the context of the caller
+	blocking, _ := NewLoadingCache(ctx, loader, 0, 0, WithMaxInflightGets(1, true))
+	defer blocking.Close()
+
+	blocking.inflightGets <- struct{}{}
+	defer func() { <-blocking.inflightGets }()
+
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+
+	if _, _, err := blocking.Get(cctx, "blocked"); !errors.Is(err, ErrInvalidContext) {
+		t.Fatalf("TestLoadingCache_MaxInflightGets failed.  Expected error: %v, got error: %v", ErrInvalidContext, err)
+	}
+}
+
+func TestLoadingCache_GroupLoader(t *testing.T) {
+	ctx := context.Background()
+
+	rows := map[Key]map[Key]any{
+		"row1": {"row1.a": 1, "row1.b": 2, "row1.c": 3},
+	}
+
+	grouper := func(key Key) (Key, bool) {
+		s, ok := key.(string)
+		if !ok || !strings.Contains(s, ".") {
+			return nil, false
+		}
+		return strings.Split(s, ".")[0], true
+	}
+
+	var groupLoads atomic.Int32
+	groupLoader := func(ctx context.Context, group Key) ([]LoaderResult, error) {
+		groupLoads.Add(1)
+		row, ok := rows[group]
+		if !ok {
+			return nil, errors.New("unknown row")
+		}
+		res := []LoaderResult{}
+		for k, v := range row {
+			res = append(res, LoaderResult{Key: k, Value: v})
+		}
+		return res, nil
+	}
+
+	lru, _ := NewLoadingCache(ctx, NewMapLoader(map[Key]any{"ungrouped": 0}), 0, 0, WithGroupLoader(grouper, groupLoader))
+	defer lru.Close()
+
+	if v, ok, err := lru.Get(ctx, "row1.a"); err != nil || !ok || v != 1 {
+		t.Fatalf("TestLoadingCache_GroupLoader failed.  Expected 1, got %v, %v, %v", v, ok, err)
+	}
+
+	// The other keys of the group were cached by the first miss
+	if n, _ := lru.Len(); n != 3 {
+		t.Fatalf("TestLoadingCache_GroupLoader failed.  Expected the group of 3 to be cached, got %d", n)
+	}
+	if v, ok, err := lru.Get(ctx, "row1.c"); err != nil || !ok || v != 3 || groupLoads.Load() != 1 {
+		t.Fatalf("TestLoadingCache_GroupLoader failed.  Expected 3 without a further load, got %v, %v, %v after %d loads", v, ok, err, groupLoads.Load())
+	}
+
+	// Keys without a group use the Loader
+	if v, ok, err := lru.Get(ctx, "ungrouped"); err != nil || !ok || v != 0 {
+		t.Fatalf("TestLoadingCache_GroupLoader failed.  Expected 0, got %v, %v, %v", v, ok, err)
+	}
+
+	// A failed group is reported for the requested keys of the group
+	var le *LoaderError
+	if _, _, err := lru.Get(ctx, "row2.a"); !errors.As(err, &le) || le.Key != "row2.a" {
+		t.Fatalf("TestLoadingCache_GroupLoader failed.  Expected loader error for row2.a, got %v", err)
+	}
+}
+
+func TestLoadingCache_LoaderResultTTL(t *testing.T) {
+	ctx := context.Background()
+
+	loader := func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		return []LoaderResult{
+			{Key: "short", Value: 1, TTL: 20 * time.Millisecond},
+			{Key: "long", Value: 2, TTL: time.Minute},
+			{Key: "default", Value: 3},
+		}, nil
+	}
+
+	for _, opts := range [][]Option{nil, {WithAsyncWriteback(1)}} {
+		lru, _ := NewLoadingCache(ctx, loader, 0, 0, append(opts, WithTTL(time.Hour))...)
+
+		// The keys are loaded together, but each is cached with its own TTL
+		if _, err := lru.GetBatch(ctx, []Key{"short", "long", "default"}); err != nil {
+			t.Fatalf("TestLoadingCache_LoaderResultTTL failed.  Unexpected error: %v", err)
+		}
+		lru.FlushPending(ctx)
+
+		expiries := map[Key]time.Duration{}
+		for _, key := range []Key{"short", "long", "default"} {
+			_, expiry, ok, _ := lru.cache.GetWithExpiry(ctx, key)
+			if !ok {
+				t.Fatalf("TestLoadingCache_LoaderResultTTL failed.  Expected %v to be cached", key)
+			}
+			expiries[key] = time.Until(expiry)
+		}
+		if expiries["short"] > 20*time.Millisecond || expiries["long"] > time.Minute || expiries["long"] < 50*time.Second || expiries["default"] < 50*time.Minute {
+			t.Fatalf("TestLoadingCache_LoaderResultTTL failed.  Expected expiry by TTL of each key, got %v", expiries)
+		}
+
+		time.Sleep(30 * time.Millisecond)
+		if _, ok, _ := lru.cache.Get(ctx, "short"); ok {
+			t.Fatal("TestLoadingCache_LoaderResultTTL failed.  Expected short to have expired")
+		}
+		if _, ok, _ := lru.cache.Get(ctx, "long"); !ok {
+			t.Fatal("TestLoadingCache_LoaderResultTTL failed.  Expected long not to have expired")
+		}
+
+		lru.Close()
+	}
+}
+
+func TestLoadingCache_Reload(t *testing.T) {
+	ctx := context.Background()
+
+	errFailed := errors.New("failed")
+
+	var lck sync.Mutex
+	data := map[Key]any{"a": 1, "b": 1, "gone": 1}
+	loader := func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		lck.Lock()
+		defer lck.Unlock()
+		res := []LoaderResult{}
+		for _, k := range keys {
+			if k == "bad" {
+				res = append(res, LoaderResult{Key: k, Err: errFailed})
+				continue
+			}
+			res = append(res, LoaderResult{Key: k, Value: data[k]})
+		}
+		return res, nil
+	}
+
+	lru, _ := NewLoadingCache(ctx, loader, 0, 0)
+	defer lru.Close()
+
+	lru.GetBatch(ctx, []Key{"a", "b", "gone"})
+	lru.Put(ctx, "bad", 1)
+
+	// The backend changes, which Get does not see whilst the values are held
+	lck.Lock()
+	data["a"], data["b"] = 2, 2
+	delete(data, "gone")
+	lck.Unlock()
+
+	if v, _, _ := lru.Get(ctx, "a"); v != 1 {
+		t.Fatalf("TestLoadingCache_Reload failed.  Expected held value of 1, got %v", v)
+	}
+	if v, err := lru.Reload(ctx, "a"); err != nil || v != 2 {
+		t.Fatalf("TestLoadingCache_Reload failed.  Expected reloaded value of 2, got %v, %v", v, err)
+	}
+	if v, _, _ := lru.Get(ctx, "a"); v != 2 {
+		t.Fatalf("TestLoadingCache_Reload failed.  Expected held value of 2, got %v", v)
+	}
+
+	res, err := lru.ReloadBatch(ctx, []Key{"b", "gone", "bad"})
+	if err != nil {
+		t.Fatalf("TestLoadingCache_Reload failed.  Unexpected error: %v", err)
+	}
+	if !res[0].OK || res[0].Value != 2 || !errors.Is(res[1].Err, ErrLoaderReturnedNil) || !errors.Is(res[2].Err, errFailed) {
+		t.Fatalf("TestLoadingCache_Reload failed.  Unexpected results %v, %v, %v", res[0], res[1], res[2])
+	}
+
+	// Keys that are not found are removed, whilst keys that fail retain their value
+	if ok, _ := lru.Contains("gone"); ok {
+		t.Fatal("TestLoadingCache_Reload failed.  Expected gone to be removed")
+	}
+	if ok, _ := lru.Contains("bad"); !ok {
+		t.Fatal("TestLoadingCache_Reload failed.  Expected bad to retain its value")
+	}
+
+	lru.Close()
+	if _, err := lru.Reload(ctx, "a"); err != ErrAttemptToUseInvalidCache {
+		t.Fatalf("TestLoadingCache_Reload failed.  Expected error: %v, got error: %v", ErrAttemptToUseInvalidCache, err)
+	}
+}
+
+func TestLoadingCache_LoaderReturnedNil(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewLoadingCache(ctx, NewMapLoader(map[Key]any{"a": 1}), 0, 0)
+	defer lru.Close()
+
+	v, ok, err := lru.Get(ctx, "missing")
+	if !errors.Is(err, ErrLoaderReturnedNil) {
+		t.Fatalf("TestLoadingCache_LoaderReturnedNil failed.  Expected error: %v, got error: %v", ErrLoaderReturnedNil, err)
+	}
+	if ok || v != nil {
+		t.Fatalf("TestLoadingCache_LoaderReturnedNil failed.  Expected miss, got %v, %v", v, ok)
+	}
+
+	if l, _ := lru.Len(); l != 0 {
+		t.Fatalf("TestLoadingCache_LoaderReturnedNil failed.  Expected Len = 0, got %v", l)
+	}
+}
+
+func TestLoadingCache_LoaderRetries(t *testing.T) {
+	errTransient := errors.New("transient failure")
+
+	var lck sync.Mutex
+	calls := map[Key]int{}
+
+	// Key "a" succeeds on the third attempt, "b" always fails, "c" always succeeds
+	loader := func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		lck.Lock()
+		defer lck.Unlock()
+
+		res := []LoaderResult{}
+		for _, k := range keys {
+			calls[k]++
+			switch {
+			case k == "a" && calls[k] >= 3, k == "c":
+				res = append(res, LoaderResult{Key: k, Value: k})
+			default:
+				res = append(res, LoaderResult{Key: k, Err: errTransient})
+			}
+		}
+		return res, nil
+	}
+
+	ctx := context.Background()
+
+	lru, _ := NewLoadingCache(ctx, loader, 0, 0, WithLoaderRetries(3, time.Millisecond))
+	defer lru.Close()
+
+	res, err := lru.GetBatch(ctx, []Key{"a", "b", "c"})
+	if err != nil {
+		t.Fatalf("TestLoadingCache_LoaderRetries failed.  Expected no error, got '%v'", err)
+	}
+	if !res[0].OK || res[0].Value != "a" {
+		t.Fatalf("TestLoadingCache_LoaderRetries failed.  Expected a to load after retries, got %v", res[0])
+	}
+	if res[1].OK || !errors.Is(res[1].Err, errTransient) {
+		t.Fatalf("TestLoadingCache_LoaderRetries failed.  Expected b to fail, got %v", res[1])
+	}
+	if !res[2].OK {
+		t.Fatalf("TestLoadingCache_LoaderRetries failed.  Expected c to load, got %v", res[2])
+	}
+
+	if calls["a"] != 3 || calls["b"] != 4 || calls["c"] != 1 {
+		t.Fatalf("TestLoadingCache_LoaderRetries failed.  Unexpected loader calls %v", calls)
+	}
+}
+
+func TestLoadingCache_WritebackContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The request context ends once the value has been loaded
+	loader := func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		defer cancel()
+		return []LoaderResult{{Key: keys[0], Value: 42}}, nil
+	}
+
+	lru, _ := NewLoadingCache(context.Background(), loader, 0, 0)
+	defer lru.Close()
+
+	if v, ok, err := lru.Get(ctx, "key"); err != nil || !ok || v != 42 {
+		t.Fatalf("TestLoadingCache_WritebackContext failed.  Unexpected result: %v, %v, %v", v, ok, err)
+	}
+
+	if l, _ := lru.Len(); l != 1 {
+		t.Fatalf("TestLoadingCache_WritebackContext failed.  Expected loaded value to be cached, got Len = %v", l)
+	}
+}
+
+func TestLoadingCache_LoaderSubsetAndSuperset(t *testing.T) {
+	ctx := context.Background()
+
+	loader := func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		// Omits "b", and adds "z" which was not requested
+		return []LoaderResult{
+			{Key: "z", Value: 26},
+			{Key: "a", Value: 1},
+		}, nil
+	}
+
+	lru, _ := NewLoadingCache(ctx, loader, 0, 0)
+	defer lru.Close()
+
+	res, err := lru.GetBatch(ctx, []Key{"a", "b"})
+	if err != nil {
+		t.Fatalf("TestLoadingCache_LoaderSubsetAndSuperset failed.  Expected success, but got error %v", err)
+	}
+	if !res[0].OK || res[0].Value != 1 {
+		t.Fatalf("TestLoadingCache_LoaderSubsetAndSuperset failed.  Expected a to be loaded, got %v", res[0])
+	}
+	if res[1].OK || res[1].Err != nil {
+		t.Fatalf("TestLoadingCache_LoaderSubsetAndSuperset failed.  Expected b to be a miss, got %v", res[1])
+	}
+	if ok, _ := lru.Contains("z"); ok {
+		t.Fatal("TestLoadingCache_LoaderSubsetAndSuperset failed.  Expected unrequested key not to be cached")
+	}
+}
+
+func TestLoadingCache_LoaderDuplicateResults(t *testing.T) {
+	ctx := context.Background()
+
+	loader := func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		return []LoaderResult{
+			{Key: "a", Value: 1},
+			{Key: "a", Value: 2},
+		}, nil
+	}
+
+	lru, _ := NewLoadingCache(ctx, loader, 0, 0)
+	defer lru.Close()
+
+	if _, err := lru.GetBatch(ctx, []Key{"a"}); !errors.Is(err, ErrMalformedLoaderResult) {
+		t.Fatalf("TestLoadingCache_LoaderDuplicateResults failed.  Expected error: %v, got error: %v", ErrMalformedLoaderResult, err)
+	}
+}
+
+func TestLoadingCache_GetWithSource(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewLoadingCache(ctx, NewMapLoader(map[Key]any{"a": 1, "b": 2}), 0, 0)
+	defer lru.Close()
+
+	if _, src, _ := lru.GetWithSource(ctx, "a"); src != SourceLoaded {
+		t.Fatalf("TestLoadingCache_GetWithSource failed.  Expected SourceLoaded, got %v", src)
+	}
+	if _, src, _ := lru.GetWithSource(ctx, "a"); src != SourceHit {
+		t.Fatalf("TestLoadingCache_GetWithSource failed.  Expected SourceHit, got %v", src)
+	}
+
+	_, sources, err := lru.GetBatchWithSource(ctx, []Key{"a", "b", "missing"})
+	if err != nil {
+		t.Fatalf("TestLoadingCache_GetWithSource failed.  Expected success, but got error %v", err)
+	}
+	expected := []Source{SourceHit, SourceLoaded, SourceMiss}
+	for i, src := range sources {
+		if src != expected[i] {
+			t.Fatalf("TestLoadingCache_GetWithSource failed.  Expected %v, got %v", expected, sources)
+		}
+	}
+}
+
+func TestLoadingCache_SingleFlight(t *testing.T) {
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 10)
+	var calls atomic.Int64
+
+	loader := func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		calls.Add(1)
+		started <- struct{}{}
+		<-release
+		res := []LoaderResult{}
+		for _, k := range keys {
+			res = append(res, LoaderResult{Key: k, Value: k})
+		}
+		return res, nil
+	}
+
+	lru, _ := NewLoadingCache(ctx, loader, 0, 0)
+	defer lru.Close()
+
+	lru.Prefetch(ctx, []Key{"a"})
+	<-started
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if v, ok, err := lru.Get(ctx, "a"); !ok || v != "a" || err != nil {
+			t.Errorf("TestLoadingCache_SingleFlight failed.  Expected a, got %v, %v, %v", v, ok, err)
+		}
+	}()
+
+	// Allow the Get to join the prefetch's load
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if err := lru.FlushPending(ctx); err != nil {
+		t.Fatalf("TestLoadingCache_SingleFlight failed.  Expected success, but got error %v", err)
+	}
+
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("TestLoadingCache_SingleFlight failed.  Expected 1 call to loader, got %v", n)
+	}
+	if ok, _ := lru.Contains("a"); !ok {
+		t.Fatal("TestLoadingCache_SingleFlight failed.  Expected a to have been prefetched")
+	}
+}
+
+func TestLoadingCache_AsyncWriteback(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewLoadingCache(ctx, NewMapLoader(map[Key]any{"a": 1}), 0, 0, WithAsyncWriteback(2))
+	defer lru.Close()
+
+	if v, ok, err := lru.Get(ctx, "a"); !ok || v != 1 || err != nil {
+		t.Fatalf("TestLoadingCache_AsyncWriteback failed.  Expected 1, got %v, %v, %v", v, ok, err)
+	}
+
+	if err := lru.FlushPending(ctx); err != nil {
+		t.Fatalf("TestLoadingCache_AsyncWriteback failed.  Expected success, but got error %v", err)
+	}
+
+	if l, _ := lru.Len(); l != 1 {
+		t.Fatalf("TestLoadingCache_AsyncWriteback failed.  Expected Len = 1, got %v", l)
+	}
+}
+
+func TestResultsToMapAndErrors(t *testing.T) {
+	ctx := context.Background()
+
+	lru, _ := NewLoadingCache(ctx, NewMapLoader(map[Key]any{"a": 1, "b": 2}), 0, 0)
+	defer lru.Close()
+
+	res, _ := lru.GetBatch(ctx, []Key{"a", "b", "missing"})
+
+	m := ResultsToMap(res)
+	if len(m) != 2 || m["a"] != 1 || m["b"] != 2 {
+		t.Fatalf("TestResultsToMapAndErrors failed.  Expected map of a and b, got %v", m)
+	}
+
+	errs := ResultsErrors(res)
+	if len(errs) != 1 || !errors.Is(errs["missing"], ErrLoaderReturnedNil) {
+		t.Fatalf("TestResultsToMapAndErrors failed.  Expected error for missing, got %v", errs)
+	}
+}
+
+func TestLoadingCache_AsyncWritebackClose(t *testing.T) {
+	ctx := context.Background()
+
+	data := map[Key]any{}
+	for i := 0; i < 50; i++ {
+		data[i] = i
+	}
+
+	lru, _ := NewLoadingCache(ctx, NewMapLoader(data), 0, 0, WithAsyncWriteback(1))
+
+	for i := 0; i < 50; i++ {
+		lru.Get(ctx, i)
+	}
+
+	lru.Close()
+
+	// Close drains the queue, so no writebacks remain
+	cctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	if err := lru.FlushPending(cctx); err != nil {
+		t.Fatalf("TestLoadingCache_AsyncWritebackClose failed.  Expected no pending writebacks, got error %v", err)
+	}
+
+	// Loads after Close do not panic
+	lru.Get(ctx, 1)
+}
+
+func TestLoadingCache_ScheduleRefresh(t *testing.T) {
+	ctx := context.Background()
+
+	var loads atomic.Int64
+	loader := func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		n := loads.Add(1)
+		res := []LoaderResult{}
+		for _, key := range keys {
+			res = append(res, LoaderResult{Key: key, Value: n})
+		}
+		return res, nil
+	}
+
+	lru, _ := NewLoadingCache(ctx, loader, 0, 0)
+	defer lru.Close()
+
+	stop := lru.ScheduleRefresh([]Key{1, 2}, 5*time.Millisecond)
+
+	// Refreshes occur without the keys being requested
+	deadline := time.Now().Add(time.Second)
+	for loads.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("TestLoadingCache_ScheduleRefresh failed.  Expected repeated refreshes, got %d", loads.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	stop()
+	stop()
+	lru.FlushPending(ctx)
+
+	n := loads.Load()
+	time.Sleep(20 * time.Millisecond)
+	if m := loads.Load(); m > n+1 {
+		t.Fatalf("TestLoadingCache_ScheduleRefresh failed.  Expected refreshes to cease after stop, got %d then %d", n, m)
+	}
+
+	if v, state, _ := lru.GetRaw(1); state != EntryLive || v.(int64) < 3 {
+		t.Fatalf("TestLoadingCache_ScheduleRefresh failed.  Expected refreshed value, got %v, %v", v, state)
+	}
+}
+
+func TestLoadingCache_ScheduleRefreshClose(t *testing.T) {
+	ctx := context.Background()
+
+	var loads atomic.Int64
+	loader := func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		loads.Add(1)
+		return []LoaderResult{}, nil
+	}
+
+	lru, _ := NewLoadingCache(ctx, loader, 0, 0)
+
+	lru.ScheduleRefresh([]Key{1}, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	lru.Close()
+
+	time.Sleep(5 * time.Millisecond)
+	n := loads.Load()
+	time.Sleep(20 * time.Millisecond)
+	if m := loads.Load(); m != n {
+		t.Fatalf("TestLoadingCache_ScheduleRefreshClose failed.  Expected refreshes to cease after Close, got %d then %d", n, m)
+	}
+}
+
+func TestLoadingCache_PartialResults(t *testing.T) {
+	ctx := context.Background()
+
+	loader := func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	for _, partial := range []bool{false, true} {
+		opts := []Option{}
+		if partial {
+			opts = append(opts, WithPartialResults())
+		}
+		lru, _ := NewLoadingCache(ctx, loader, 0, 0, opts...)
+		defer lru.Close()
+
+		lru.Put(ctx, 1, "held")
+
+		cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		res, err := lru.GetBatch(cctx, []Key{1, 2})
+		cancel()
+
+		if !partial {
+			if err == nil || res != nil {
+				t.Fatalf("TestLoadingCache_PartialResults failed.  Expected error and no results, got %v, %v", res, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrInvalidContext) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("TestLoadingCache_PartialResults failed.  Expected wrapped context error, got %v", err)
+		}
+		if len(res) != 2 || !res[0].OK || res[0].Value != "held" {
+			t.Fatalf("TestLoadingCache_PartialResults failed.  Expected resolved key to be returned, got %v", res)
+		}
+		if res[1].OK || res[1].Err != err {
+			t.Fatalf("TestLoadingCache_PartialResults failed.  Expected unresolved key to report the error, got %v, %v", res[1].OK, res[1].Err)
+		}
+	}
+}
+
+func TestLoadingCache_GetBatchOrder(t *testing.T) {
+	ctx := context.Background()
+
+	// Results are returned in the reverse order to that requested
+	loader := func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		res := []LoaderResult{}
+		for i := len(keys) - 1; i >= 0; i-- {
+			res = append(res, LoaderResult{Key: keys[i], Value: fmt.Sprintf("loaded %v", keys[i])})
+		}
+		return res, nil
+	}
+
+	lru, _ := NewLoadingCache(ctx, loader, 0, 0)
+	defer lru.Close()
+
+	for i := 0; i < 10; i += 2 {
+		lru.Put(ctx, i, fmt.Sprintf("held %v", i))
+	}
+
+	keys := []Key{9, 0, 7, 2, 5, 4, 3, 6, 1, 8, 3}
+	res, sources, err := lru.GetBatchWithSource(ctx, keys)
+	if err != nil {
+		t.Fatalf("TestLoadingCache_GetBatchOrder failed.  Unexpected error: %v", err)
+	}
+	if len(res) != len(keys) {
+		t.Fatalf("TestLoadingCache_GetBatchOrder failed.  Expected %d results, got %d", len(keys), len(res))
+	}
+	for i, key := range keys {
+		expected, source := fmt.Sprintf("loaded %v", key), SourceLoaded
+		if key.(int)%2 == 0 {
+			expected, source = fmt.Sprintf("held %v", key), SourceHit
+		}
+		if res[i].Key != key || !res[i].OK || res[i].Value != expected || sources[i] != source {
+			t.Fatalf("TestLoadingCache_GetBatchOrder failed.  Expected %v (%v) at %d, got %v: %v (%v)", expected, source, i, res[i].Key, res[i].Value, sources[i])
+		}
+	}
+}
+
+func TestLoadingCache_LoaderDeadline(t *testing.T) {
+	ctx := context.Background()
+
+	loader := func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		if keys[0] == "fast" {
+			return []LoaderResult{{Key: "fast", Value: "loaded"}}, nil
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	lru, _ := NewLoadingCache(ctx, loader, 0, 0, WithLoaderDeadline(10*time.Millisecond))
+	defer lru.Close()
+
+	lru.Put(ctx, 1, "held")
+
+	start := time.Now()
+	res, sources, err := lru.GetBatchWithSource(ctx, []Key{1, 2})
+	if err != nil {
+		t.Fatalf("TestLoadingCache_LoaderDeadline failed.  Unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("TestLoadingCache_LoaderDeadline failed.  Expected the loader to be abandoned, took %v", elapsed)
+	}
+	if !res[0].OK || res[0].Value != "held" || sources[0] != SourceHit {
+		t.Fatalf("TestLoadingCache_LoaderDeadline failed.  Expected held key to be returned, got %v, %v", res[0].Value, sources[0])
+	}
+	if res[1].OK || res[1].Err != nil || sources[1] != SourceMiss {
+		t.Fatalf("TestLoadingCache_LoaderDeadline failed.  Expected a miss, got %v, %v, %v", res[1].OK, res[1].Err, sources[1])
+	}
+
+	// Loads that complete within the deadline are unaffected
+	if v, ok, err := lru.Get(ctx, "fast"); err != nil || !ok || v != "loaded" {
+		t.Fatalf("TestLoadingCache_LoaderDeadline failed.  Expected loaded value, got %v, %v, %v", v, ok, err)
+	}
+}
+
+func TestLoadingCache_LoaderErrorTTL(t *testing.T) {
+	ctx := context.Background()
+
+	errFailed := errors.New("failed")
+
+	var calls atomic.Int64
+	loader := func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		calls.Add(1)
+		res := []LoaderResult{}
+		for _, key := range keys {
+			if key == "bad" {
+				res = append(res, LoaderResult{Key: key, Err: errFailed})
+			} else {
+				res = append(res, LoaderResult{Key: key, Value: key})
+			}
+		}
+		return res, nil
+	}
+
+	lru, _ := NewLoadingCache(ctx, loader, 0, 0, WithLoaderErrorTTL(50*time.Millisecond))
+	defer lru.Close()
+
+	for i := 0; i < 3; i++ {
+		_, ok, err := lru.Get(ctx, "bad")
+		var le *LoaderError
+		if ok || !errors.As(err, &le) || !errors.Is(err, errFailed) {
+			t.Fatalf("TestLoadingCache_LoaderErrorTTL failed.  Expected LoaderError wrapping %v, got %v, %v", errFailed, ok, err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("TestLoadingCache_LoaderErrorTTL failed.  Expected the loader to be called once, got %d", n)
+	}
+
+	// Other keys are still loaded whilst the failure is remembered
+	res, _ := lru.GetBatch(ctx, []Key{"bad", "good"})
+	if res[0].Err == nil || !res[1].OK || res[1].Value != "good" {
+		t.Fatalf("TestLoadingCache_LoaderErrorTTL failed.  Unexpected results %v, %v", res[0], res[1])
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("TestLoadingCache_LoaderErrorTTL failed.  Expected the loader to be called for good only, got %d calls", n)
+	}
+
+	// The loader is retried once the failure expires
+	time.Sleep(60 * time.Millisecond)
+	lru.Get(ctx, "bad")
+	if n := calls.Load(); n != 3 {
+		t.Fatalf("TestLoadingCache_LoaderErrorTTL failed.  Expected the loader to be retried, got %d calls", n)
+	}
+}
+
+func TestLoadingCache_WritebackOverflow(t *testing.T) {
+	ctx := context.Background()
+
+	data := map[Key]any{1: 1, 2: 2, 3: 3}
+
+	for _, policy := range []WritebackOverflowPolicy{WritebackSync, WritebackDrop} {
+		entered := make(chan struct{})
+		release := make(chan struct{})
+
+		// The writeback of key 1 blocks its worker until released
+		copier := func(v any) any {
+			if v == 1 {
+				close(entered)
+				<-release
+			}
+			return v
+		}
+
+		var overflowed []KeyVal
+		lru, _ := NewLoadingCache(ctx, NewMapLoader(data), 0, 0,
+			WithAsyncWriteback(1),
+			WithWritebackQueue(1, policy),
+			WithCopyOnPut(copier),
+			WithOnWritebackOverflow(func(vals []KeyVal, p WritebackOverflowPolicy) {
+				if p != policy {
+					t.Errorf("TestLoadingCache_WritebackOverflow failed.  Expected policy %v, got %v", policy, p)
+				}
+				overflowed = append(overflowed, vals...)
+			}))
+
+		lru.Get(ctx, 1)
+		<-entered
+		lru.Get(ctx, 2) // Queued
+		lru.Get(ctx, 3) // Overflows
+
+		if len(overflowed) != 1 || overflowed[0].Key != 3 {
+			t.Fatalf("TestLoadingCache_WritebackOverflow failed.  Expected overflow of key 3, got %v", overflowed)
+		}
+
+		if ok, _ := lru.Contains(3); ok != (policy == WritebackSync) {
+			t.Fatalf("TestLoadingCache_WritebackOverflow failed.  Unexpected presence of key 3 for policy %v: %v", policy, ok)
+		}
+
+		close(release)
+		lru.FlushPending(ctx)
+
+		for _, key := range []Key{1, 2} {
+			if ok, _ := lru.Contains(key); !ok {
+				t.Fatalf("TestLoadingCache_WritebackOverflow failed.  Expected key %v to have been written back", key)
+			}
+		}
+		if ok, _ := lru.Contains(3); ok != (policy == WritebackSync) {
+			t.Fatalf("TestLoadingCache_WritebackOverflow failed.  Unexpected presence of key 3 for policy %v: %v", policy, ok)
+		}
+
+		lru.Close()
+	}
+}
@@ -0,0 +1,37 @@
+package lru
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// NewMapLoader returns a Loader that serves values from the provided map,
+// which simplifies testing code that uses a LoadingCache.
+// Keys that are not present in the map are returned with a nil Value,
+// so that the LoadingCache treats them as not found, reporting ErrLoaderReturnedNil.
+// The map must not be modified whilst the Loader is in use.
+func NewMapLoader(data map[Key]any) Loader {
+	l, _ := NewCountingMapLoader(data)
+	return l
+}
+
+// NewCountingMapLoader behaves as NewMapLoader, additionally returning a func
+// that reports the number of times the Loader has been invoked
+func NewCountingMapLoader(data map[Key]any) (Loader, func() int64) {
+	var calls atomic.Int64
+
+	loader := func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		calls.Add(1)
+
+		res := make([]LoaderResult, 0, len(keys))
+		for _, k := range keys {
+			res = append(res, LoaderResult{
+				Key:   k,
+				Value: data[k],
+			})
+		}
+		return res, nil
+	}
+
+	return loader, calls.Load
+}
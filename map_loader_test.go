@@ -0,0 +1,51 @@
+package lru
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNewMapLoader(t *testing.T) {
+	loader := NewMapLoader(map[Key]any{"a": 1, "b": 2})
+
+	res, err := loader(context.Background(), []Key{"a", "missing", "b"})
+	if err != nil {
+		t.Fatalf("TestNewMapLoader failed.  Expected no error, got '%v'", err)
+	}
+	if len(res) != 3 {
+		t.Fatalf("TestNewMapLoader failed.  Expected 3 results, got %v", len(res))
+	}
+	if res[0].Key != "a" || res[0].Value != 1 {
+		t.Fatalf("TestNewMapLoader failed.  Unexpected result %v", res[0])
+	}
+	if res[1].Key != "missing" || res[1].Value != nil {
+		t.Fatalf("TestNewMapLoader failed.  Unexpected result %v", res[1])
+	}
+	if res[2].Key != "b" || res[2].Value != 2 {
+		t.Fatalf("TestNewMapLoader failed.  Unexpected result %v", res[2])
+	}
+}
+
+func TestNewCountingMapLoader(t *testing.T) {
+	loader, calls := NewCountingMapLoader(map[Key]any{"a": 1})
+
+	ctx := context.Background()
+
+	lru, _ := NewLoadingCache(ctx, loader, 0, 0)
+	defer lru.Close()
+
+	for i := 0; i < 3; i++ {
+		v, ok, err := lru.Get(ctx, "a")
+		if err != nil || !ok || v != 1 {
+			t.Fatalf("TestNewCountingMapLoader failed.  Unexpected result: %v, %v, %v", v, ok, err)
+		}
+	}
+
+	if _, ok, _ := lru.Get(ctx, "missing"); ok {
+		t.Fatal("TestNewCountingMapLoader failed.  Expected ok = false for missing key")
+	}
+
+	if n := calls(); n != 2 {
+		t.Fatalf("TestNewCountingMapLoader failed.  Expected 2 loader calls, got %v", n)
+	}
+}
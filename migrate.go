@@ -0,0 +1,75 @@
+package lru
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrSourceNotIterable = errors.New("source cache cannot enumerate its entries")
+
+var ErrInvalidMigration = errors.New("source and destination caches must not be nil")
+
+// migrateBatchSize is the number of entries added to dst by each PutBatch of Migrate
+const migrateBatchSize = 64
+
+// Migrate copies all the entries of src into dst, returning the number of entries transferred.
+// The entries are added to dst from the least to most recently used, so that dst
+// evicts the least recently used entries if it has insufficient capacity.
+// src must be able to enumerate its entries (as BasicCache and LoadingCache do),
+// otherwise ErrSourceNotIterable is returned.  src is not modified.
+// The entries are added in batches of migrateBatchSize.  If dst rejects a batch, each
+// entry of that batch is added individually, so that a failure for one entry does
+// not prevent the others from being migrated, before the migration resumes with the
+// next batch; the errors of the failed entries are joined in the returned error.
+func Migrate(ctx context.Context, src, dst Cache) (int, error) {
+	if src == nil || dst == nil {
+		return 0, ErrInvalidMigration
+	}
+
+	i, ok := src.(iterator)
+	if !ok {
+		return 0, ErrSourceNotIterable
+	}
+
+	vals := []KeyVal{}
+	if err := i.ForEach(func(key Key, value any) bool {
+		vals = append(vals, KeyVal{Key: key, Value: value})
+		return true
+	}); err != nil {
+		return 0, err
+	}
+
+	// ForEach returns most recently used first, so reverse to preserve lru order in dst
+	for l, r := 0, len(vals)-1; l < r; l, r = l+1, r-1 {
+		vals[l], vals[r] = vals[r], vals[l]
+	}
+
+	// Progress is tracked by batch, so that the entries of earlier batches, which
+	// have been copied already, are not added again when a later batch fails
+	n := 0
+	var errs []error
+	for start := 0; start < len(vals); start += migrateBatchSize {
+		batch := vals[start:min(start+migrateBatchSize, len(vals))]
+
+		if ctx.Err() != nil {
+			return n, errors.Join(append(errs, ErrInvalidContext)...)
+		}
+		if err := dst.PutBatch(ctx, batch); err == nil {
+			n += len(batch)
+			continue
+		}
+
+		for _, kv := range batch {
+			if ctx.Err() != nil {
+				return n, errors.Join(append(errs, ErrInvalidContext)...)
+			}
+			if err := dst.Put(ctx, kv.Key, kv.Value); err != nil {
+				errs = append(errs, fmt.Errorf("key %v: %w", kv.Key, err))
+				continue
+			}
+			n++
+		}
+	}
+	return n, errors.Join(errs...)
+}
@@ -0,0 +1,125 @@
+package lru
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+
+	src, _ := NewBasicCache(ctx, 0, 0)
+	defer src.Close()
+
+	for i := 0; i < 5; i++ {
+		src.Put(ctx, i, i)
+	}
+	src.Get(ctx, 0) // 0 is now the most recently used
+
+	dst, _ := NewBasicCache(ctx, 3, 0)
+	defer dst.Close()
+
+	n, err := Migrate(ctx, src, dst)
+	if err != nil {
+		t.Fatalf("TestMigrate failed.  Unexpected error: %v", err)
+	}
+	if n != 5 {
+		t.Fatalf("TestMigrate failed.  Expected 5 transferred, got %d", n)
+	}
+
+	// dst retains the most recently used entries of src
+	for _, k := range []Key{0, 4, 3} {
+		if v, ok, _ := dst.Get(ctx, k); !ok || v != k {
+			t.Fatalf("TestMigrate failed.  Expected %v, got %v, %v", k, v, ok)
+		}
+	}
+	if l, _ := src.Len(); l != 5 {
+		t.Fatalf("TestMigrate failed.  Expected src to be unchanged, got %d", l)
+	}
+}
+
+func TestMigrate_EntryErrors(t *testing.T) {
+	ctx := context.Background()
+
+	src, _ := NewBasicCache(ctx, 0, 0)
+	defer src.Close()
+
+	src.PutBatch(ctx, []KeyVal{{Key: "a", Value: 1}, {Key: "b", Value: 100}, {Key: "c", Value: 2}})
+
+	sizer := func(v any) int64 { return int64(v.(int)) }
+	dst, _ := NewBasicCache(ctx, 0, 0, WithMaxValueSize(10, sizer), WithRejectWholeBatch())
+	defer dst.Close()
+
+	n, err := Migrate(ctx, src, dst)
+	if !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("TestMigrate_EntryErrors failed.  Expected ErrValueTooLarge, got %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("TestMigrate_EntryErrors failed.  Expected 2 transferred, got %d", n)
+	}
+	if _, ok, _ := dst.Get(ctx, "b"); ok {
+		t.Fatal("TestMigrate_EntryErrors failed.  Expected b not to be transferred")
+	}
+}
+
+// countingCache counts the calls to Put of the underlying cache
+type countingCache struct {
+	*BasicCache
+	puts int
+}
+
+func (c *countingCache) Put(ctx context.Context, key Key, val any) error {
+	c.puts++
+	return c.BasicCache.Put(ctx, key, val)
+}
+
+func TestMigrate_Resume(t *testing.T) {
+	ctx := context.Background()
+
+	src, _ := NewBasicCache(ctx, 0, 0)
+	defer src.Close()
+
+	entries := 2*migrateBatchSize + 2
+	for i := 0; i < entries; i++ {
+		src.Put(ctx, i, 1)
+	}
+	src.Put(ctx, migrateBatchSize+1, 100) // Too large, and now the most recently used
+
+	sizer := func(v any) int64 { return int64(v.(int)) }
+	b, _ := NewBasicCache(ctx, 0, 0, WithMaxValueSize(10, sizer))
+	defer b.Close()
+	dst := &countingCache{BasicCache: b}
+
+	n, err := Migrate(ctx, src, dst)
+	if !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("TestMigrate_Resume failed.  Expected ErrValueTooLarge, got %v", err)
+	}
+	if n != entries-1 {
+		t.Fatalf("TestMigrate_Resume failed.  Expected %d transferred, got %d", entries-1, n)
+	}
+
+	// Only the entries of the failed (last) batch are added individually
+	if expected := entries - 2*migrateBatchSize; dst.puts != expected {
+		t.Fatalf("TestMigrate_Resume failed.  Expected %d individual puts, got %d", expected, dst.puts)
+	}
+	if l, _ := dst.Len(); l != entries-1 {
+		t.Fatalf("TestMigrate_Resume failed.  Expected Len = %d, got %d", entries-1, l)
+	}
+}
+
+func TestMigrate_NotIterable(t *testing.T) {
+	ctx := context.Background()
+
+	src, _ := NewARCCache(ctx, 10, 0)
+	defer src.Close()
+	dst, _ := NewBasicCache(ctx, 0, 0)
+	defer dst.Close()
+
+	if _, err := Migrate(ctx, src, dst); err != ErrSourceNotIterable {
+		t.Fatalf("TestMigrate_NotIterable failed.  Expected ErrSourceNotIterable, got %v", err)
+	}
+	if _, err := Migrate(ctx, nil, dst); err != ErrInvalidMigration {
+		t.Fatalf("TestMigrate_NotIterable failed.  Expected ErrInvalidMigration, got %v", err)
+	}
+}
@@ -0,0 +1,548 @@
+package lru
+
+import (
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Options holds the optional configuration of a cache
+type Options struct {
+	// MaxValueSize, if positive, is the largest size of value (as measured
+	// by Sizer) that may be added to the cache.  Larger values are rejected
+	// with ErrValueTooLarge and are not stored.
+	MaxValueSize int64
+	// Sizer returns the size of a value, and must be provided if MaxValueSize is set
+	Sizer func(any) int64
+	// RejectWholeBatch, if true, causes PutBatch to reject every entry in the batch
+	// if any one of them exceeds MaxValueSize.  By default only the offending
+	// entries are rejected, with the remainder added to the cache.
+	RejectWholeBatch bool
+	// SkipNilValues, if true, causes PutBatch to skip entries with nil values, adding
+	// the remainder of the batch, rather than abandoning the batch at the first nil
+	// value.  The skipped entries are reported as PutErrors in the returned error,
+	// so a batch may partially succeed and still return an error.
+	SkipNilValues bool
+	// AllowNilValues, if true, allows nil values to be added to a BasicCache, so that
+	// the absence of a value (for example, a user without a profile) can itself be
+	// cached.  A retrieval of a cached nil returns a nil value that is found (ok is
+	// true), distinguishing it from a key that is not held.  By default nil values are
+	// rejected with ErrInvalidValueToAddToCache.  This takes precedence over SkipNilValues.
+	AllowNilValues bool
+	// SkipNilCheck, if true, removes the check of each value added to a BasicCache for
+	// nil, avoiding its cost for trusted callers that have already validated their values.
+	// Any nil value is then stored, and retrieved as found, as with AllowNilValues; this
+	// is unlikely to be intended, and in a LoadingCache the key is reported as found with
+	// a nil value rather than being loaded.  Only set this if values are known not to be nil.
+	SkipNilCheck bool
+	// TTL, if positive, is the default time-to-live of entries added to the cache.
+	// Expired entries are reported as not found, and are removed when next accessed
+	// or when evicted, so may be counted by Len until then.
+	TTL time.Duration
+	// SlidingExpiration, if true, resets the expiry of an entry to now+TTL each
+	// time it is successfully retrieved.  By default the expiry is fixed when the
+	// entry is written.
+	SlidingExpiration bool
+	// IdleTimeout, if positive, causes the cache to close itself if no operations are
+	// made on it for this duration, releasing its resources as though Close() had been
+	// called, so that subsequent operations return ErrAttemptToUseInvalidCache.
+	// This is intended for short-lived caches (for example, one per request) that
+	// might otherwise not be closed; it should not be set for a cache that must remain
+	// usable through quiet periods, as there is no way to reopen a closed cache.
+	IdleTimeout time.Duration
+	// ConcurrentUpdates, if true, causes Update to call its func on the caller's goroutine,
+	// holding a lock for the key, rather than on the goroutine of the cache.  Updates of
+	// different keys then proceed in parallel, and a slow func does not delay other
+	// operations, but each Update makes two requests of the cache (to get and then put
+	// the value), and is atomic only with respect to other Updates of the key, not to
+	// Puts or Removes.  This favours Updates with costly funcs spread across many keys,
+	// whilst the default favours Updates with fast funcs.
+	ConcurrentUpdates bool
+	// LockOSThread, if true, locks the goroutine of a cache to an OS thread for its
+	// lifetime, so that it is not migrated between threads by the scheduler, which can
+	// reduce the variance in latency of requests.  Each such cache dedicates an OS thread
+	// that no other goroutine can use, so this should only be set for a few caches
+	// in latency sensitive deployments, where GOMAXPROCS allows for the dedicated threads.
+	LockOSThread bool
+	// PresizeMap, if true, allocates the map of a bounded cache for its capacity when
+	// the cache is created (and again after Clear or Drain), so that the map is not repeatedly
+	// grown and rehashed as the cache fills.  This trades memory held by an empty cache
+	// for faster filling, so suits caches that are expected to fill.  It has no effect
+	// on unbounded caches, or if a Weigher is provided, as the capacity is then a weight.
+	PresizeMap bool
+	// Tracer, if provided, is used to start child spans for cache operations, to which
+	// the OpenTelemetry events are then added.  If not provided, no spans are created by
+	// the cache, and events are added to any span already present in the context.
+	Tracer trace.Tracer
+	// DisableTracing, if true, skips all OpenTelemetry work, so that no spans are
+	// started or retrieved from the context, and no events are added.  This avoids
+	// the overhead of tracing for latency sensitive uses, and takes precedence over Tracer.
+	DisableTracing bool
+	// TraceSampleRate, if greater than 1, limits tracing to one in every TraceSampleRate
+	// operations of each cache (counting Gets, Puts and Loader calls alike), with the
+	// others treated as though tracing were disabled.  This reduces the overhead of
+	// tracing caches under heavy load, whilst retaining representative events.
+	TraceSampleRate int
+	// KeyStringer, if provided, renders keys wherever they are reported for diagnostics,
+	// such as in trace events and error messages.  If not provided, keys are rendered
+	// using fmt, which can render different keys identically (for example, struct keys
+	// whose fields differ only in type), so this allows an unambiguous representation.
+	KeyStringer func(key Key) string
+	// KeyNormalizer, if provided, is applied to every key before it is used to
+	// store, retrieve or remove entries, so that logically equal keys match.
+	// The normalized key is the one held by the cache, and is therefore what
+	// is presented when entries are enumerated (for example, to RemoveWhere).
+	// CacheResults continue to report the key as requested.
+	KeyNormalizer func(Key) Key
+	// OnEvict, if provided, is called for each entry evicted from the cache, either
+	// to maintain its capacity or by Resize or Clear.  It is not called for entries
+	// removed explicitly.  OnEvict is called within the cache, so should be fast
+	// and must not call back into the cache.
+	OnEvict func(key Key, value any)
+	// OnAccess, if provided, is called for each key accessed by a Get, Put or Remove,
+	// with the operation (AccessGet, AccessPut or AccessRemove), the key, and whether
+	// it hit; for Get and Remove this is whether the key was held, whilst for Put
+	// it is whether the operation succeeded.  Batch operations call OnAccess once
+	// for each key.  OnAccess is called by the caller's goroutine once the cache has
+	// responded, so does not delay other operations on the cache, but does delay
+	// the return to the caller.  Keys are reported as held by the cache (see
+	// KeyNormalizer), rather than as requested.
+	OnAccess func(op string, key Key, hit bool)
+	// OnPanic, if provided, is called with the value recovered from any unexpected
+	// panic within the cache (for example, in a Loader, OnEvict, or a predicate), and
+	// the stack at the point of the panic.  By default such panics are discarded, or
+	// reported only as an error to the caller.  OnPanic should be fast, and must not
+	// call back into the cache.
+	OnPanic func(recovered any, stack []byte)
+	// Weigher, if provided, returns the weight of an entry, and the capacity of the
+	// cache is then measured as the total weight of its entries rather than their
+	// number.  Entries are evicted, oldest first, until the total weight is within
+	// the capacity, which may include the entry just added if it is heavier than
+	// the capacity.  Weights should not be negative, and are treated as zero if so.
+	Weigher func(key Key, value any) int
+	// EvictionBatchSize, if positive, limits the number of entries a BasicCache evicts
+	// at a time to maintain its capacity, with any further evictions made in batches
+	// between subsequent requests.  This prevents a single operation (for example, a
+	// Resize to a much smaller capacity, or a large PutBatch) blocking other requests
+	// whilst many entries are evicted, at the cost that the cache may transiently exceed
+	// its capacity.  Resize then returns only the entries evicted in the first batch,
+	// although OnEvict is called for every entry evicted.
+	EvictionBatchSize int
+	// MaxConcurrentLoads, if positive, limits the number of concurrent calls to the
+	// Loader of a LoadingCache.  Further loads wait until a call completes, or
+	// until their context completes, in which case ErrInvalidContext is returned.
+	MaxConcurrentLoads int
+	// MaxInflightGets, if positive, limits the number of Gets (or GetBatches) of a
+	// LoadingCache that may be loading their misses at once, whether calling the Loader
+	// or waiting on a load of the same keys by another Get.  This admission control
+	// protects the source of the Loader when misses spike; unlike MaxConcurrentLoads,
+	// it is applied before any loading, and further Gets are rejected rather than queued
+	// with ErrTooManyInflight, unless BlockInflightGets is set.  Gets served entirely
+	// from the cache are not limited.
+	MaxInflightGets int
+	// BlockInflightGets, if true, causes Gets beyond MaxInflightGets to wait until
+	// another completes its loading, or until their context completes, in which case
+	// ErrInvalidContext is returned.
+	BlockInflightGets bool
+	// LoaderRetries is the number of times a LoadingCache retries loading keys that
+	// failed, either individually or because the Loader returned an error.  Only the
+	// failed keys are retried.  If all attempts fail then the error from the last
+	// attempt is reported.
+	LoaderRetries int
+	// LoaderBackoff is the delay before the first retry, which doubles for each
+	// subsequent retry.  Retries stop if the context of the request completes.
+	LoaderBackoff time.Duration
+	// LoaderDeadline, if positive, limits the time that a GetBatch of a LoadingCache
+	// waits for the Loader, which is called with a context having this deadline.
+	// Should the deadline be exceeded, the keys that have not been loaded are
+	// returned as misses, together with the keys already held, rather than an error.
+	LoaderDeadline time.Duration
+	// Grouper and GroupLoader, if both provided, cause a LoadingCache to load a missing
+	// key together with the other keys of its group, so that keys which are accessed
+	// together (for example, the columns of a row) are loaded by a single call.  Grouper
+	// alone determines group membership: it returns the identifier of the group of a key,
+	// or false if the key belongs to no group, in which case the key is loaded by the
+	// Loader as usual.  GroupLoader is then called once for each group with a missing key,
+	// and every value it returns is added to the cache, whether or not it was requested.
+	// Keys of a group that GroupLoader does not return are not found.
+	// Loading a group can load entries that are never used, which adds to the load on the
+	// source and, in a bounded cache, may evict entries that are used; so groups should be
+	// small relative to the capacity, and hold keys that are likely to be used together.
+	// Groups are not shared between concurrent Gets, so misses of different keys of the
+	// same group may each load the group.
+	Grouper     func(key Key) (Key, bool)
+	GroupLoader GroupLoader
+	// LoaderErrorTTL, if positive, is the period for which a LoadingCache remembers that
+	// the Loader failed for a key, during which requests for the key report the error
+	// again without calling the Loader.  Only failures of individual keys are remembered,
+	// not those where the Loader returns an error for the whole call.  Zero disables this.
+	LoaderErrorTTL time.Duration
+	// CopyOnGet, if provided, is applied to each value retrieved from the cache,
+	// and the copy is returned, so that the caller may safely mutate it.
+	// Without a copier, the caller receives the value held by the cache, and
+	// mutating it (for example, a slice or map) changes the cached value.  This
+	// aliasing is the default, as it avoids the cost of copying.  Values passed
+	// to ForEach and RemoveWhere, and those returned on eviction, are not copied.
+	CopyOnGet func(any) any
+	// CopyOnPut, if provided, is applied to each value added to the cache, and
+	// the copy is held, so that the caller may continue to mutate the original.
+	CopyOnPut func(any) any
+	// AsyncWriteback, if true, causes a LoadingCache to add loaded values to the cache
+	// asynchronously, so that GetBatch returns without waiting for this to complete.
+	// This reduces the latency of requests that load values, at the cost that an
+	// immediately subsequent request (on any goroutine) may not find the values, and
+	// load them again.  FlushPending waits for outstanding writebacks to complete.
+	// By default, values are added to the cache before GetBatch returns.
+	AsyncWriteback bool
+	// WritebackWorkers is the number of goroutines that complete asynchronous
+	// writebacks, which are queued until a worker is available.  It defaults to 1.
+	WritebackWorkers int
+	// WritebackQueueSize is the number of asynchronous writebacks that may be queued
+	// awaiting a worker, which bounds the memory they hold.  It defaults to 100.
+	WritebackQueueSize int
+	// WritebackOverflow determines what happens to an asynchronous writeback when the
+	// queue is full, defaulting to WritebackBlock, which delays the GetBatch until there is space.
+	WritebackOverflow WritebackOverflowPolicy
+	// OnWritebackOverflow, if provided, is called with the values of each asynchronous
+	// writeback that finds the queue full, and the WritebackOverflow policy then applied,
+	// so that backpressure can be observed (for example, by counting overflows).
+	// It is called by the goroutine making the request, so should be fast.
+	OnWritebackOverflow func(vals []KeyVal, policy WritebackOverflowPolicy)
+	// GlobalMaxEntries, if positive, limits the total number of entries held across
+	// all the partitions of a PartitionedCache.  When exceeded after a Put, entries are
+	// evicted from the partition selected by GlobalEvictionPolicy.  This trades the
+	// isolation between partitions (which is the reason for partitioning) for a bound
+	// on the overall size, as activity in one partition can now evict entries from
+	// another.  The limit is enforced after each Put, so concurrent Puts may briefly
+	// exceed it.  All partitions must support Evict.
+	GlobalMaxEntries int
+	// GlobalEvictionPolicy determines the partition to evict from when GlobalMaxEntries
+	// is exceeded, defaulting to EvictFromLargestPartition.
+	GlobalEvictionPolicy PartitionEvictionPolicy
+	// PartitionTimeout, if positive, limits the time that a PartitionedCache waits for
+	// its partitions to respond to a GetBatch, after which ErrTimeout is returned
+	// and the context passed to the partitions is cancelled.
+	PartitionTimeout time.Duration
+	// PartitionLoader, if provided, is called by a PartitionedCache with the keys that
+	// are not found in their partitions, as the Loader of a LoadingCache would be, with
+	// the loaded values added to the partitions of their keys.  Keys that cannot be
+	// routed to a partition are not loaded.  LoaderRetries and MaxConcurrentLoads do
+	// not apply; these may instead be provided by partitions that are LoadingCaches.
+	PartitionLoader Loader
+	// PartialResults, if true, causes the GetBatch of a LoadingCache or PartitionedCache
+	// to return the results of the keys already resolved should the context complete
+	// part way through, rather than only ErrInvalidContext.  A result is returned for
+	// every key, with the Err of each unresolved key set to the returned error, which
+	// wraps both ErrInvalidContext and the cause of the context completing.
+	// If the context has already completed when GetBatch is called, no results are returned.
+	PartialResults bool
+	// TieredWriteBehind, if true, causes a TieredCache to add values to its L1 cache
+	// only, with the values written to its L2 cache asynchronously.  By default
+	// values are written to both caches before Put returns.
+	TieredWriteBehind bool
+
+	// traceSeq counts the operations of the cache, to sample them for tracing
+	traceSeq *atomic.Uint64
+}
+
+// Option allows the optional configuration of a cache to be specified
+type Option func(*Options)
+
+// WithMaxValueSize rejects values whose size, as determined by sizer, exceeds max
+func WithMaxValueSize(max int64, sizer func(any) int64) Option {
+	return func(o *Options) {
+		o.MaxValueSize = max
+		o.Sizer = sizer
+	}
+}
+
+// WithRejectWholeBatch causes PutBatch to add none of its entries if any of them are too large
+func WithRejectWholeBatch() Option {
+	return func(o *Options) {
+		o.RejectWholeBatch = true
+	}
+}
+
+// WithSkipNilValues causes PutBatch to skip, rather than stop at, entries with nil values
+func WithSkipNilValues() Option {
+	return func(o *Options) {
+		o.SkipNilValues = true
+	}
+}
+
+// WithAllowNilValues allows nil values to be added to the cache, and retrieved as found
+func WithAllowNilValues() Option {
+	return func(o *Options) {
+		o.AllowNilValues = true
+	}
+}
+
+// WithSkipNilCheck stops values being checked for nil before they are added to the cache
+func WithSkipNilCheck() Option {
+	return func(o *Options) {
+		o.SkipNilCheck = true
+	}
+}
+
+// WithTTL sets the default time-to-live of entries in the cache
+func WithTTL(ttl time.Duration) Option {
+	return func(o *Options) {
+		o.TTL = ttl
+	}
+}
+
+// WithSlidingExpiration causes each successful retrieval of an entry to extend its expiry
+func WithSlidingExpiration() Option {
+	return func(o *Options) {
+		o.SlidingExpiration = true
+	}
+}
+
+// WithIdleTimeout closes the cache once it has been idle for the specified duration
+func WithIdleTimeout(idle time.Duration) Option {
+	return func(o *Options) {
+		o.IdleTimeout = idle
+	}
+}
+
+// WithLockOSThread dedicates an OS thread to the goroutine of the cache
+func WithLockOSThread() Option {
+	return func(o *Options) {
+		o.LockOSThread = true
+	}
+}
+
+// WithPresizeMap allocates the map of a bounded cache for its capacity on creation
+func WithPresizeMap() Option {
+	return func(o *Options) {
+		o.PresizeMap = true
+	}
+}
+
+// WithConcurrentUpdates calls the func of Update outside the cache, with a lock for each key
+func WithConcurrentUpdates() Option {
+	return func(o *Options) {
+		o.ConcurrentUpdates = true
+	}
+}
+
+// WithTracer specifies the Tracer used to create spans for cache operations
+func WithTracer(tracer trace.Tracer) Option {
+	return func(o *Options) {
+		o.Tracer = tracer
+	}
+}
+
+// WithTraceSampleRate traces only one in every rate operations of the cache
+func WithTraceSampleRate(rate int) Option {
+	return func(o *Options) {
+		o.TraceSampleRate = rate
+	}
+}
+
+// WithKeyStringer specifies a func that renders keys for trace events and error messages
+func WithKeyStringer(stringer func(key Key) string) Option {
+	return func(o *Options) {
+		o.KeyStringer = stringer
+	}
+}
+
+// WithTracingDisabled skips all OpenTelemetry work within the cache
+func WithTracingDisabled() Option {
+	return func(o *Options) {
+		o.DisableTracing = true
+	}
+}
+
+// WithCopyOnGet returns copies of the values retrieved from the cache, made by copier
+func WithCopyOnGet(copier func(any) any) Option {
+	return func(o *Options) {
+		o.CopyOnGet = copier
+	}
+}
+
+// WithCopyOnPut holds copies of the values added to the cache, made by copier
+func WithCopyOnPut(copier func(any) any) Option {
+	return func(o *Options) {
+		o.CopyOnPut = copier
+	}
+}
+
+// WithKeyNormalizer specifies a func that is applied to all keys before use
+func WithKeyNormalizer(normalizer func(Key) Key) Option {
+	return func(o *Options) {
+		o.KeyNormalizer = normalizer
+	}
+}
+
+// WithOnEvict specifies a func to be called for each entry evicted from the cache
+func WithOnEvict(onEvict func(key Key, value any)) Option {
+	return func(o *Options) {
+		o.OnEvict = onEvict
+	}
+}
+
+// WithOnAccess specifies a func that is called for each key accessed by a Get, Put or Remove
+func WithOnAccess(onAccess func(op string, key Key, hit bool)) Option {
+	return func(o *Options) {
+		o.OnAccess = onAccess
+	}
+}
+
+// WithOnPanic specifies a func that is called for each unexpected panic recovered within the cache
+func WithOnPanic(onPanic func(recovered any, stack []byte)) Option {
+	return func(o *Options) {
+		o.OnPanic = onPanic
+	}
+}
+
+// WithWeigher specifies a func that determines the weight of each entry against the capacity
+func WithWeigher(weigher func(key Key, value any) int) Option {
+	return func(o *Options) {
+		o.Weigher = weigher
+	}
+}
+
+// WithEvictionBatchSize limits the number of entries evicted at a time to maintain the capacity
+func WithEvictionBatchSize(n int) Option {
+	return func(o *Options) {
+		o.EvictionBatchSize = n
+	}
+}
+
+// WithMaxConcurrentLoads limits the number of concurrent calls to the Loader of a LoadingCache
+func WithMaxConcurrentLoads(n int) Option {
+	return func(o *Options) {
+		o.MaxConcurrentLoads = n
+	}
+}
+
+// WithMaxInflightGets limits the number of Gets of a LoadingCache that may be loading at once,
+// with further Gets either waiting, if block is true, or failing with ErrTooManyInflight
+func WithMaxInflightGets(n int, block bool) Option {
+	return func(o *Options) {
+		o.MaxInflightGets = n
+		o.BlockInflightGets = block
+	}
+}
+
+// WithGroupLoader loads the missing keys of a LoadingCache together with the other keys
+// of their groups, as identified by grouper
+func WithGroupLoader(grouper func(key Key) (Key, bool), loader GroupLoader) Option {
+	return func(o *Options) {
+		o.Grouper = grouper
+		o.GroupLoader = loader
+	}
+}
+
+// WithLoaderRetries retries failed loads up to retries times, waiting initially for backoff
+// and doubling this for each subsequent retry
+func WithLoaderRetries(retries int, backoff time.Duration) Option {
+	return func(o *Options) {
+		o.LoaderRetries = retries
+		o.LoaderBackoff = backoff
+	}
+}
+
+// WithLoaderDeadline limits the time a LoadingCache waits for its Loader, with keys not
+// loaded in time returned as misses
+func WithLoaderDeadline(deadline time.Duration) Option {
+	return func(o *Options) {
+		o.LoaderDeadline = deadline
+	}
+}
+
+// WithLoaderErrorTTL reports the failure of the Loader for a key again, without
+// calling the Loader, until ttl has elapsed
+func WithLoaderErrorTTL(ttl time.Duration) Option {
+	return func(o *Options) {
+		o.LoaderErrorTTL = ttl
+	}
+}
+
+// WithAsyncWriteback adds loaded values to the cache asynchronously, using the specified number of workers
+func WithAsyncWriteback(workers int) Option {
+	return func(o *Options) {
+		o.AsyncWriteback = true
+		o.WritebackWorkers = workers
+	}
+}
+
+// WithWritebackQueue limits the number of queued asynchronous writebacks to size,
+// applying the policy to writebacks that find the queue full
+func WithWritebackQueue(size int, policy WritebackOverflowPolicy) Option {
+	return func(o *Options) {
+		o.WritebackQueueSize = size
+		o.WritebackOverflow = policy
+	}
+}
+
+// WithOnWritebackOverflow specifies a func that is called for each asynchronous writeback that finds the queue full
+func WithOnWritebackOverflow(onOverflow func(vals []KeyVal, policy WritebackOverflowPolicy)) Option {
+	return func(o *Options) {
+		o.OnWritebackOverflow = onOverflow
+	}
+}
+
+// WithGlobalMaxEntries limits the total entries across the partitions of a PartitionedCache,
+// evicting from partitions according to the policy when exceeded
+func WithGlobalMaxEntries(maxEntries int, policy PartitionEvictionPolicy) Option {
+	return func(o *Options) {
+		o.GlobalMaxEntries = maxEntries
+		o.GlobalEvictionPolicy = policy
+	}
+}
+
+// WithPartitionTimeout limits the time a PartitionedCache waits for its partitions to respond
+func WithPartitionTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.PartitionTimeout = timeout
+	}
+}
+
+// WithPartitionLoader loads the keys not found in a PartitionedCache using the loader
+func WithPartitionLoader(loader Loader) Option {
+	return func(o *Options) {
+		o.PartitionLoader = loader
+	}
+}
+
+// WithPartialResults returns the results already resolved by a GetBatch if its context completes
+func WithPartialResults() Option {
+	return func(o *Options) {
+		o.PartialResults = true
+	}
+}
+
+// WithTieredWriteBehind causes a TieredCache to write values to its L2 cache asynchronously
+func WithTieredWriteBehind() Option {
+	return func(o *Options) {
+		o.TieredWriteBehind = true
+	}
+}
+
+// panicked reports the recovered value of a panic to OnPanic, if set.
+// It must be called from the deferred func that recovered the panic,
+// so that the stack of the panic is reported.
+func (o Options) panicked(r any) {
+	if o.OnPanic == nil {
+		return
+	}
+	defer func() {
+		recover()
+	}()
+	o.OnPanic(r, debug.Stack())
+}
+
+func newOptions(opts []Option) Options {
+	var o Options
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	o.traceSeq = &atomic.Uint64{}
+	return o
+}
@@ -0,0 +1,208 @@
+package lru
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// typeRegistry holds the concrete types of keys and values that may be persisted,
+// by name, so that values held as any can be reconstructed with their original type.
+type typeRegistry struct {
+	lck   sync.RWMutex
+	names map[reflect.Type]string
+	types map[string]reflect.Type
+}
+
+var registeredTypes = newTypeRegistry()
+
+func newTypeRegistry() *typeRegistry {
+	r := &typeRegistry{
+		names: map[reflect.Type]string{},
+		types: map[string]reflect.Type{},
+	}
+	for _, sample := range []any{
+		false, "", []byte(nil),
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0),
+		float32(0), float64(0), complex64(0), complex128(0),
+	} {
+		r.register(sample)
+	}
+	return r
+}
+
+// typeName returns the name under which the type is registered, which is qualified
+// by the package path of named types, including those within composite types, so
+// that types of different packages do not clash
+func typeName(t reflect.Type) string {
+	if t.Name() != "" && t.PkgPath() != "" {
+		return t.PkgPath() + "." + t.Name()
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return "*" + typeName(t.Elem())
+	case reflect.Slice:
+		return "[]" + typeName(t.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), typeName(t.Elem()))
+	case reflect.Map:
+		return "map[" + typeName(t.Key()) + "]" + typeName(t.Elem())
+	case reflect.Chan:
+		elem := typeName(t.Elem())
+		switch t.ChanDir() {
+		case reflect.RecvDir:
+			return "<-chan " + elem
+		case reflect.SendDir:
+			return "chan<- " + elem
+		}
+		if t.Elem().Kind() == reflect.Chan && t.Elem().ChanDir() == reflect.RecvDir {
+			return "chan (" + elem + ")"
+		}
+		return "chan " + elem
+	}
+	return t.String()
+}
+
+func (r *typeRegistry) register(sample any) error {
+	if sample == nil {
+		return ErrInvalidTypeSample
+	}
+
+	t := reflect.TypeOf(sample)
+	name := typeName(t)
+
+	r.lck.Lock()
+	defer r.lck.Unlock()
+
+	if existing, ok := r.types[name]; ok && existing != t {
+		return fmt.Errorf("%w: %s", ErrTypeAlreadyRegistered, name)
+	}
+	r.names[t] = name
+	r.types[name] = t
+	return nil
+}
+
+// encode returns the name of the type of v and its gob encoding.  A nil v is
+// encoded as an empty name.
+func (r *typeRegistry) encode(v any) (string, []byte, error) {
+	if v == nil {
+		return "", nil, nil
+	}
+
+	r.lck.RLock()
+	name, ok := r.names[reflect.TypeOf(v)]
+	r.lck.RUnlock()
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %T", ErrUnregisteredType, v)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return "", nil, err
+	}
+	return name, buf.Bytes(), nil
+}
+
+// decode reconstructs the value of the named type from its gob encoding
+func (r *typeRegistry) decode(name string, data []byte) (any, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	r.lck.RLock()
+	t, ok := r.types[name]
+	r.lck.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnregisteredType, name)
+	}
+
+	v := reflect.New(t)
+	if err := gob.NewDecoder(bytes.NewReader(data)).DecodeValue(v); err != nil {
+		return nil, err
+	}
+	return v.Elem().Interface(), nil
+}
+
+var ErrInvalidTypeSample = errors.New("type sample must not be nil")
+var ErrTypeAlreadyRegistered = errors.New("a different type is already registered with that name")
+var ErrUnregisteredType = errors.New("type has not been registered")
+
+// RegisterType records the concrete type of sample, so that keys and values of that
+// type can be persisted by WriteSnapshot and reconstructed by ReadSnapshot.  As with
+// gob.Register, types must be registered before use by both the writer and reader,
+// and must be encodable by encoding/gob.  The builtin boolean, numeric and string
+// types, and []byte, are registered already.
+func RegisterType(sample any) error {
+	return registeredTypes.register(sample)
+}
+
+// persistedKeyVal is the form in which each KeyVal is persisted
+type persistedKeyVal struct {
+	KeyType   string
+	Key       []byte
+	ValueType string
+	Value     []byte
+}
+
+// WriteSnapshot writes the items (typically as returned by Snapshot or Drain) to w,
+// so that they may later be read by ReadSnapshot, for example to Restore a cache in
+// another process.  ErrUnregisteredType is returned if the type of any key or value
+// has not been registered with RegisterType.
+func WriteSnapshot(w io.Writer, vals []KeyVal) error {
+	return registeredTypes.writeSnapshot(w, vals)
+}
+
+// writeSnapshot writes the items to w, encoding their types from the registry
+func (r *typeRegistry) writeSnapshot(w io.Writer, vals []KeyVal) error {
+	enc := gob.NewEncoder(w)
+	for _, kv := range vals {
+		var p persistedKeyVal
+		var err error
+		if p.KeyType, p.Key, err = r.encode(kv.Key); err != nil {
+			return err
+		}
+		if p.ValueType, p.Value, err = r.encode(kv.Value); err != nil {
+			return err
+		}
+		if err := enc.Encode(&p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadSnapshot reads the items written by WriteSnapshot from r, in the order they
+// were written, reconstructing each key and value with its registered type.
+func ReadSnapshot(r io.Reader) ([]KeyVal, error) {
+	return registeredTypes.readSnapshot(r)
+}
+
+// readSnapshot reads the items from rd, decoding their types from the registry
+func (r *typeRegistry) readSnapshot(rd io.Reader) ([]KeyVal, error) {
+	dec := gob.NewDecoder(rd)
+	vals := []KeyVal{}
+	for {
+		var p persistedKeyVal
+		if err := dec.Decode(&p); err != nil {
+			if err == io.EOF {
+				return vals, nil
+			}
+			return nil, err
+		}
+
+		key, err := r.decode(p.KeyType, p.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := r.decode(p.ValueType, p.Value)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, KeyVal{Key: key, Value: value})
+	}
+}
@@ -0,0 +1,97 @@
+package lru
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	randv2 "math/rand/v2"
+	"reflect"
+	"testing"
+)
+
+type persistedPoint struct {
+	X, Y int
+}
+
+func TestWriteSnapshot(t *testing.T) {
+	ctx := context.Background()
+
+	// A registry of its own ensures the test does not depend on prior registrations
+	types := newTypeRegistry()
+
+	if err := types.register(persistedPoint{}); err != nil {
+		t.Fatalf("TestWriteSnapshot failed.  Unexpected error: %v", err)
+	}
+	if err := RegisterType(nil); err != ErrInvalidTypeSample {
+		t.Fatalf("TestWriteSnapshot failed.  Expected error: %v, got error: %v", ErrInvalidTypeSample, err)
+	}
+
+	lru, _ := NewBasicCache(ctx, 0, 0)
+	defer lru.Close()
+
+	lru.Put(ctx, "a", persistedPoint{1, 2})
+	lru.Put(ctx, 2, &persistedPoint{3, 4})
+	lru.Put(ctx, persistedPoint{5, 6}, []byte("b"))
+
+	// Pointer types must be registered separately
+	vals, _ := lru.Snapshot()
+	var buf bytes.Buffer
+	if err := types.writeSnapshot(&buf, vals); !errors.Is(err, ErrUnregisteredType) {
+		t.Fatalf("TestWriteSnapshot failed.  Expected error: %v, got error: %v", ErrUnregisteredType, err)
+	}
+	types.register(&persistedPoint{})
+
+	buf.Reset()
+	if err := types.writeSnapshot(&buf, vals); err != nil {
+		t.Fatalf("TestWriteSnapshot failed.  Unexpected error: %v", err)
+	}
+
+	read, err := types.readSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("TestWriteSnapshot failed.  Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(read, vals) {
+		t.Fatalf("TestWriteSnapshot failed.  Expected %v, got %v", vals, read)
+	}
+
+	restored, _ := NewBasicCache(ctx, 0, 0)
+	defer restored.Close()
+	restored.Restore(ctx, read)
+	if v, ok, _ := restored.Get(ctx, "a"); !ok || v != (persistedPoint{1, 2}) {
+		t.Fatalf("TestWriteSnapshot failed.  Expected restored value, got %v, %v", v, ok)
+	}
+}
+
+func TestRegisterType_CompositeTypes(t *testing.T) {
+	types := newTypeRegistry()
+
+	// Element types of the same name from different packages do not clash
+	for _, sample := range []any{
+		[]rand.Zipf{}, []randv2.Zipf{},
+		[2]rand.Zipf{}, [2]randv2.Zipf{},
+		map[string]rand.Zipf{}, map[string]randv2.Zipf{},
+		map[rand.Zipf]int{}, map[randv2.Zipf]int{},
+		make(chan rand.Zipf), make(chan randv2.Zipf),
+	} {
+		if err := types.register(sample); err != nil {
+			t.Fatalf("TestRegisterType_CompositeTypes failed.  Unexpected error registering %T: %v", sample, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		sample   any
+		expected string
+	}{
+		{[]int{}, "[]int"},
+		{[]rand.Zipf{}, "[]math/rand.Zipf"},
+		{map[string]*randv2.Zipf{}, "map[string]*math/rand/v2.Zipf"},
+		{[3]persistedPoint{}, "[3]github.com/gford1000-go/lru.persistedPoint"},
+		{make(<-chan rand.Zipf), "<-chan math/rand.Zipf"},
+		{make(chan (<-chan rand.Zipf)), "chan (<-chan math/rand.Zipf)"},
+	} {
+		if name := typeName(reflect.TypeOf(tc.sample)); name != tc.expected {
+			t.Fatalf("TestRegisterType_CompositeTypes failed.  Expected %v, got %v", tc.expected, name)
+		}
+	}
+}
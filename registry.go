@@ -0,0 +1,63 @@
+package lru
+
+import (
+	"errors"
+	"sync"
+)
+
+// Registry holds caches by name, so that they may be looked up, and closed together.
+// It is safe for concurrent use, and the zero value is an empty Registry.
+type Registry struct {
+	lck    sync.RWMutex
+	caches map[string]Cache
+}
+
+var ErrInvalidRegistryCache = errors.New("cache must not be nil")
+var ErrCacheAlreadyRegistered = errors.New("a cache is already registered with that name")
+
+// Register adds the cache to the registry with the specified name, which must be unique.
+// The cache is assumed to be owned by the registry once it is added.
+func (r *Registry) Register(name string, c Cache) error {
+	if c == nil {
+		return ErrInvalidRegistryCache
+	}
+
+	r.lck.Lock()
+	defer r.lck.Unlock()
+
+	if _, ok := r.caches[name]; ok {
+		return ErrCacheAlreadyRegistered
+	}
+	if r.caches == nil {
+		r.caches = map[string]Cache{}
+	}
+	r.caches[name] = c
+	return nil
+}
+
+// Get returns the cache registered with the specified name
+func (r *Registry) Get(name string) (Cache, bool) {
+	r.lck.RLock()
+	defer r.lck.RUnlock()
+
+	c, ok := r.caches[name]
+	return c, ok
+}
+
+// CloseAll closes all the registered caches, and removes them from the registry
+func (r *Registry) CloseAll() {
+	r.lck.Lock()
+	defer r.lck.Unlock()
+
+	for _, c := range r.caches {
+		c.Close()
+	}
+	r.caches = map[string]Cache{}
+}
+
+// NewRegistry creates a new, empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		caches: map[string]Cache{},
+	}
+}
@@ -0,0 +1,40 @@
+package lru
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+
+	r := NewRegistry()
+
+	c, _ := NewBasicCache(ctx, 0, 0)
+
+	if err := r.Register("users", c); err != nil {
+		t.Fatalf("TestRegistry failed.  Expected success, but got error %v", err)
+	}
+	if err := r.Register("users", c); err != ErrCacheAlreadyRegistered {
+		t.Fatalf("TestRegistry failed.  Expected error: %v, got error: %v", ErrCacheAlreadyRegistered, err)
+	}
+	if err := r.Register("other", nil); err != ErrInvalidRegistryCache {
+		t.Fatalf("TestRegistry failed.  Expected error: %v, got error: %v", ErrInvalidRegistryCache, err)
+	}
+
+	if got, ok := r.Get("users"); !ok || got != c {
+		t.Fatal("TestRegistry failed.  Expected registered cache to be returned")
+	}
+	if _, ok := r.Get("missing"); ok {
+		t.Fatal("TestRegistry failed.  Expected missing cache not to be found")
+	}
+
+	r.CloseAll()
+
+	if _, ok := r.Get("users"); ok {
+		t.Fatal("TestRegistry failed.  Expected registry to be empty after CloseAll")
+	}
+	if err := c.Put(ctx, "a", 1); err != ErrAttemptToUseInvalidCache {
+		t.Fatalf("TestRegistry failed.  Expected error: %v, got error: %v", ErrAttemptToUseInvalidCache, err)
+	}
+}
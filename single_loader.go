@@ -0,0 +1,66 @@
+package lru
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// SingleLoader returns a Loader that adapts fn, which loads the value of a single key,
+// calling fn for each requested key in turn.  An error returned by fn is reported in
+// the LoaderResult of its key, as is a panic, and a nil value indicates that the key
+// was not found.
+// Keys not yet loaded when ctx completes are reported with ErrInvalidContext.
+func SingleLoader(fn func(ctx context.Context, key Key) (any, error)) Loader {
+	return ConcurrentSingleLoader(fn, 1)
+}
+
+// ConcurrentSingleLoader behaves as SingleLoader, but calls fn concurrently for
+// up to limit keys at a time.  A limit less than 1 is treated as 1.
+func ConcurrentSingleLoader(fn func(ctx context.Context, key Key) (any, error), limit int) Loader {
+	limit = max(1, limit)
+
+	return func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		res := make([]LoaderResult, len(keys))
+
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, limit)
+		for i, k := range keys {
+			res[i].Key = k
+
+			if ctx.Err() != nil {
+				res[i].Err = ErrInvalidContext
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				res[i].Err = ErrInvalidContext
+				continue
+			case sem <- struct{}{}:
+			}
+			// Both cases may be ready once a call completes, with either chosen,
+			// so the context is checked again before fn is called
+			if ctx.Err() != nil {
+				<-sem
+				res[i].Err = ErrInvalidContext
+				continue
+			}
+
+			wg.Add(1)
+			go func(r *LoaderResult) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				// fn is called on a separate goroutine, so a panic is reported against its key
+				defer func() {
+					if p := recover(); p != nil {
+						r.Value, r.Err = nil, fmt.Errorf("unexpected error: %v", p)
+					}
+				}()
+				r.Value, r.Err = fn(ctx, r.Key)
+			}(&res[i])
+		}
+		wg.Wait()
+
+		return res, nil
+	}
+}
@@ -0,0 +1,100 @@
+package lru
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSingleLoader(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	loader := SingleLoader(func(ctx context.Context, key Key) (any, error) {
+		switch key {
+		case "missing":
+			return nil, nil
+		case "bad":
+			return nil, errFailed
+		}
+		return key.(string) + "!", nil
+	})
+
+	ctx := context.Background()
+
+	lru, _ := NewLoadingCache(ctx, loader, 0, 0)
+	defer lru.Close()
+
+	res, err := lru.GetBatch(ctx, []Key{"a", "missing", "bad"})
+	if err != nil {
+		t.Fatalf("TestSingleLoader failed.  Unexpected error: %v", err)
+	}
+	if !res[0].OK || res[0].Value != "a!" {
+		t.Fatalf("TestSingleLoader failed.  Unexpected result %v", res[0])
+	}
+	if res[1].OK || !errors.Is(res[1].Err, ErrLoaderReturnedNil) {
+		t.Fatalf("TestSingleLoader failed.  Expected missing not to be found, got %v", res[1])
+	}
+	if res[2].OK || !errors.Is(res[2].Err, errFailed) {
+		t.Fatalf("TestSingleLoader failed.  Expected error: %v, got error: %v", errFailed, res[2].Err)
+	}
+}
+
+func TestConcurrentSingleLoader(t *testing.T) {
+	var active, peak atomic.Int64
+
+	loader := ConcurrentSingleLoader(func(ctx context.Context, key Key) (any, error) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return key, nil
+	}, 3)
+
+	keys := []Key{}
+	for i := 0; i < 10; i++ {
+		keys = append(keys, i)
+	}
+
+	res, err := loader(context.Background(), keys)
+	if err != nil || len(res) != len(keys) {
+		t.Fatalf("TestConcurrentSingleLoader failed.  Unexpected result: %v, %v", res, err)
+	}
+	for i, r := range res {
+		if r.Key != i || r.Value != i || r.Err != nil {
+			t.Fatalf("TestConcurrentSingleLoader failed.  Unexpected result %v", r)
+		}
+	}
+	if p := peak.Load(); p < 2 || p > 3 {
+		t.Fatalf("TestConcurrentSingleLoader failed.  Expected at most 3 concurrent calls, got %d", p)
+	}
+}
+
+func TestConcurrentSingleLoader_Cancel(t *testing.T) {
+	for n := 0; n < 20; n++ {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		var calls atomic.Int64
+		loader := ConcurrentSingleLoader(func(ctx context.Context, key Key) (any, error) {
+			calls.Add(1)
+			cancel()
+			return key, nil
+		}, 1)
+
+		res, _ := loader(ctx, []Key{1, 2, 3})
+
+		// No further calls are made once the context is cancelled by the first
+		if c := calls.Load(); c != 1 {
+			t.Fatalf("TestConcurrentSingleLoader_Cancel failed.  Expected 1 call, got %d", c)
+		}
+		if !errors.Is(res[1].Err, ErrInvalidContext) || !errors.Is(res[2].Err, ErrInvalidContext) {
+			t.Fatalf("TestConcurrentSingleLoader_Cancel failed.  Expected error: %v, got %v, %v", ErrInvalidContext, res[1].Err, res[2].Err)
+		}
+	}
+}
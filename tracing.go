@@ -0,0 +1,44 @@
+package lru
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startSpan returns the span to which the events of an operation are added.
+// If a Tracer is provided then a child span with the specified name is started,
+// together with the context that holds it; otherwise the span already present
+// in the context is used.
+// If tracing is disabled, or the operation is not sampled, then a nil span
+// is returned, and no events should be added.
+// The returned func must be called when the operation completes.
+func startSpan(ctx context.Context, o Options, name string) (context.Context, trace.Span, func()) {
+	if o.DisableTracing || !o.traceSampled() {
+		return ctx, nil, func() {}
+	}
+	tracer := o.Tracer
+	if tracer == nil {
+		return ctx, trace.SpanFromContext(ctx), func() {}
+	}
+	ctx, span := tracer.Start(ctx, name)
+	return ctx, span, func() { span.End() }
+}
+
+// traceSampled reports whether the current operation should be traced, which is
+// one in every TraceSampleRate operations, or every operation if this is not set
+func (o Options) traceSampled() bool {
+	if o.TraceSampleRate <= 1 || o.traceSeq == nil {
+		return true
+	}
+	return (o.traceSeq.Add(1)-1)%uint64(o.TraceSampleRate) == 0
+}
+
+// keyString renders the key for diagnostics, using KeyStringer if provided
+func (o Options) keyString(key Key) string {
+	if o.KeyStringer != nil {
+		return o.KeyStringer(key)
+	}
+	return fmt.Sprint(key)
+}
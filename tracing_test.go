@@ -0,0 +1,268 @@
+package lru
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordingTracer records the names of the spans that are started
+type recordingTracer struct {
+	noop.Tracer
+	lck   sync.Mutex
+	names []string
+	spans map[string]*recordingSpan
+}
+
+func (r *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	r.lck.Lock()
+	defer r.lck.Unlock()
+	r.names = append(r.names, name)
+	if r.spans == nil {
+		r.spans = map[string]*recordingSpan{}
+	}
+	span := &recordingSpan{attrs: map[attribute.Key]attribute.Value{}}
+	r.spans[name] = span
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+func (r *recordingTracer) span(name string) *recordingSpan {
+	r.lck.Lock()
+	defer r.lck.Unlock()
+	return r.spans[name]
+}
+
+// recordingSpan records the attributes, events and status set on it
+type recordingSpan struct {
+	noop.Span
+	lck    sync.Mutex
+	attrs  map[attribute.Key]attribute.Value
+	events map[string][]attribute.KeyValue
+	status codes.Code
+	ended  bool
+}
+
+func (s *recordingSpan) AddEvent(name string, options ...trace.EventOption) {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	if s.events == nil {
+		s.events = map[string][]attribute.KeyValue{}
+	}
+	cfg := trace.NewEventConfig(options...)
+	s.events[name] = cfg.Attributes()
+}
+
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	for _, a := range kv {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordingSpan) SetStatus(code codes.Code, description string) {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	s.status = code
+}
+
+func (s *recordingSpan) End(options ...trace.SpanEndOption) {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	s.ended = true
+}
+
+func (r *recordingTracer) started(name string) bool {
+	r.lck.Lock()
+	defer r.lck.Unlock()
+	for _, n := range r.names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWithTracer(t *testing.T) {
+	tracer := &recordingTracer{}
+
+	ctx := context.Background()
+
+	lru, _ := NewLoadingCache(ctx, NewMapLoader(map[Key]any{"a": 1}), 0, 0, WithTracer(tracer))
+	defer lru.Close()
+
+	if _, ok, _ := lru.Get(ctx, "a"); !ok {
+		t.Fatal("TestWithTracer failed.  Expected ok = true, got ok = false")
+	}
+
+	for _, name := range []string{oTELLoadingCacheGetBatchSpan, oTELBasicCacheGetBatchSpan, oTELLoaderSpan, oTELBasicCachePutBatchSpan} {
+		if !tracer.started(name) {
+			t.Fatalf("TestWithTracer failed.  Expected span %s to be started", name)
+		}
+	}
+}
+
+func TestWithTracingDisabled(t *testing.T) {
+	tracer := &recordingTracer{}
+
+	ctx := context.Background()
+
+	lru, _ := NewLoadingCache(ctx, NewMapLoader(map[Key]any{"a": 1}), 0, 0, WithTracer(tracer), WithTracingDisabled())
+	defer lru.Close()
+
+	if _, ok, _ := lru.Get(ctx, "a"); !ok {
+		t.Fatal("TestWithTracingDisabled failed.  Expected ok = true, got ok = false")
+	}
+
+	for _, name := range []string{oTELLoadingCacheGetBatchSpan, oTELBasicCacheGetBatchSpan, oTELLoaderSpan, oTELBasicCachePutBatchSpan} {
+		if tracer.started(name) {
+			t.Fatalf("TestWithTracingDisabled failed.  Expected span %s not to be started", name)
+		}
+	}
+}
+
+func TestWithTracer_LoaderSpan(t *testing.T) {
+	tracer := &recordingTracer{}
+
+	ctx := context.Background()
+
+	lru, _ := NewLoadingCache(ctx, NewMapLoader(map[Key]any{"a": 1}), 0, 0, WithTracer(tracer))
+	defer lru.Close()
+
+	lru.GetBatch(ctx, []Key{"a", "b"})
+
+	span := tracer.span(oTELLoaderSpan)
+	if span == nil {
+		t.Fatal("TestWithTracer_LoaderSpan failed.  Expected loader span to be started")
+	}
+	span.lck.Lock()
+	defer span.lck.Unlock()
+	if !span.ended {
+		t.Fatal("TestWithTracer_LoaderSpan failed.  Expected loader span to be ended")
+	}
+	if v := span.attrs[oTELLoaderRequestedAttr]; v.AsInt64() != 2 {
+		t.Fatalf("TestWithTracer_LoaderSpan failed.  Expected 2 keys requested, got %v", v.Emit())
+	}
+	if v := span.attrs[oTELLoaderLoadedAttr]; v.AsInt64() != 1 {
+		t.Fatalf("TestWithTracer_LoaderSpan failed.  Expected 1 key loaded, got %v", v.Emit())
+	}
+	if span.status != codes.Unset {
+		t.Fatalf("TestWithTracer_LoaderSpan failed.  Expected unset status, got %v", span.status)
+	}
+}
+
+func TestWithTracer_LoaderSpanError(t *testing.T) {
+	tracer := &recordingTracer{}
+
+	ctx := context.Background()
+
+	loader := func(ctx context.Context, keys []Key) ([]LoaderResult, error) {
+		return nil, errors.New("failed")
+	}
+
+	lru, _ := NewLoadingCache(ctx, loader, 0, 0, WithTracer(tracer))
+	defer lru.Close()
+
+	lru.Get(ctx, "a")
+
+	span := tracer.span(oTELLoaderSpan)
+	if span == nil {
+		t.Fatal("TestWithTracer_LoaderSpanError failed.  Expected loader span to be started")
+	}
+	span.lck.Lock()
+	defer span.lck.Unlock()
+	if span.status != codes.Error {
+		t.Fatalf("TestWithTracer_LoaderSpanError failed.  Expected error status, got %v", span.status)
+	}
+}
+
+func TestWithTraceSampleRate(t *testing.T) {
+	tracer := &recordingTracer{}
+
+	ctx := context.Background()
+
+	lru, _ := NewBasicCache(ctx, 0, 0, WithTracer(tracer), WithTraceSampleRate(4))
+	defer lru.Close()
+
+	for i := 0; i < 8; i++ {
+		lru.Put(ctx, i, i)
+		lru.Get(ctx, i)
+	}
+
+	// Puts and Gets are sampled together, so one in four of the 16 operations is traced
+	tracer.lck.Lock()
+	defer tracer.lck.Unlock()
+	if n := len(tracer.names); n != 4 {
+		t.Fatalf("TestWithTraceSampleRate failed.  Expected 4 spans to be started, got %d: %v", n, tracer.names)
+	}
+}
+
+func TestWithKeyStringer(t *testing.T) {
+	type key struct {
+		ID any
+	}
+
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		opts []Option
+		keys []string
+	}{
+		{nil, []string{"{1}", "{1}"}},
+		{[]Option{WithKeyStringer(func(k Key) string { return fmt.Sprintf("%#v", k) })}, []string{`lru.key{ID:1}`, `lru.key{ID:"1"}`}},
+	} {
+		tracer := &recordingTracer{}
+		lru, _ := NewBasicCache(ctx, 0, 0, append(test.opts, WithTracer(tracer))...)
+
+		for i, k := range []Key{key{1}, key{"1"}} {
+			lru.Get(ctx, k)
+
+			span := tracer.span(oTELBasicCacheGetBatchSpan)
+			var rendered string
+			for _, a := range span.events[oTELBasicCacheGetBatchStarted] {
+				if a.Key == "Key" {
+					rendered = a.Value.AsString()
+				}
+			}
+			if rendered != test.keys[i] {
+				t.Fatalf("TestWithKeyStringer failed.  Expected key rendered as %s, got %s", test.keys[i], rendered)
+			}
+		}
+
+		lru.Close()
+	}
+}
+
+func TestWithTracer_PartitionedCache(t *testing.T) {
+	ctx := context.Background()
+
+	for _, disabled := range []bool{false, true} {
+		tracer := &recordingTracer{}
+
+		opts := []Option{WithTracer(tracer)}
+		if disabled {
+			opts = append(opts, WithTracingDisabled())
+		}
+
+		a, _ := NewBasicCache(ctx, 0, 0)
+		partitioner := func(key Key) (Partition, error) { return "A", nil }
+		cache, _ := NewPartitionedCache(ctx, partitioner, []PartitionInfo{{Name: "A", Cache: a}}, opts...)
+
+		cache.PutBatch(ctx, []KeyVal{{Key: "a", Value: 1}})
+		cache.Get(ctx, "a")
+		cache.Close()
+
+		for _, name := range []string{oTELPartitionedCacheGetBatchSpan, oTELPartitionedCachePutBatchSpan} {
+			if tracer.started(name) == disabled {
+				t.Fatalf("TestWithTracer_PartitionedCache failed.  Expected span %s started = %v", name, !disabled)
+			}
+		}
+	}
+}